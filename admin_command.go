@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+)
+
+const adminUsage = `usage:
+  fix-ticket-system admin create --email <email> --password-stdin [--organization Default] [--force]
+  fix-ticket-system admin purge-users [--grace-period 720h]`
+
+// runAdminCommand handles `fix-ticket-system admin <subcommand>`
+func runAdminCommand(args []string, stdin io.Reader, stdout io.Writer, userService *service.UserService, organizationService *service.OrganizationService) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runAdminCreate(args[1:], stdin, stdout, userService, organizationService)
+	case "purge-users":
+		return runAdminPurgeUsers(args[1:], stdout, userService)
+	default:
+		return errors.New(adminUsage)
+	}
+}
+
+// runAdminCreate creates the first super admin of the installation. Once an
+// admin exists it refuses unless --force is given, which is meant to regain
+// access when every admin is locked out.
+func runAdminCreate(args []string, stdin io.Reader, stdout io.Writer, userService *service.UserService, organizationService *service.OrganizationService) error {
+	fs := flag.NewFlagSet("admin create", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	email := fs.String("email", "", "email address of the admin user")
+	organization := fs.String("organization", models.DefaultOrganizationName, "organization the admin user belongs to, created if missing")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from standard input")
+	force := fs.Bool("force", false, "create the super admin even though an admin already exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+	if !*passwordStdin {
+		return errors.New("--password-stdin is required")
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+
+	hasAdmin, err := userService.HasAdmin()
+	if err != nil {
+		return err
+	}
+	if hasAdmin && !*force {
+		return errors.New("an admin already exists, use the admin API or --force")
+	}
+
+	org, err := organizationService.EnsureOrganization(*organization)
+	if err != nil {
+		return err
+	}
+
+	user, err := userService.CreateUser(org.ID, *email, password, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if user, err = userService.SetSuperAdmin(user.ID, true); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Created super admin %s (%s) in organization %s\n", user.Email, user.ID, org.Name)
+	return nil
+}
+
+// runAdminPurgeUsers permanently deletes users deactivated longer ago than the grace period
+func runAdminPurgeUsers(args []string, stdout io.Writer, userService *service.UserService) error {
+	fs := flag.NewFlagSet("admin purge-users", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	gracePeriod := fs.Duration("grace-period", 30*24*time.Hour, "how long deactivated users are kept before they are purged")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	purged, err := userService.PurgeDeactivatedUsers(*gracePeriod)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Purged %d deactivated users\n", purged)
+	return nil
+}
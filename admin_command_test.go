@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUserService(t *testing.T) (*service.UserService, *service.OrganizationService) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Ticket{}, &models.Session{}, &models.SupersededRefreshToken{}, &models.APIKey{}, &models.PasswordResetToken{}, &models.Team{}, &models.Organization{})
+	assert.NoError(t, err)
+	return service.NewUserService(db, service.DefaultPasswordManager), service.NewOrganizationService(db)
+}
+
+func TestAdminCreate(t *testing.T) {
+	userService, orgService := setupUserService(t)
+	var out bytes.Buffer
+
+	err := runAdminCommand([]string{"create", "--email", "root@example.com", "--password-stdin"}, strings.NewReader("secret123\n"), &out, userService, orgService)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "root@example.com")
+
+	user, err := userService.GetUserByEmail("root@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.True(t, user.SuperAdmin)
+	assert.True(t, userService.CheckPassword(user, "secret123"))
+
+	org, err := orgService.GetOrganization(user.OrganizationID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultOrganizationName, org.Name)
+}
+
+func TestAdminCreate_RefusesWhenAdminExists(t *testing.T) {
+	userService, orgService := setupUserService(t)
+	err := runAdminCommand([]string{"create", "--email", "first@example.com", "--password-stdin", "--organization", "Acme"}, strings.NewReader("secret123\n"), &bytes.Buffer{}, userService, orgService)
+	assert.NoError(t, err)
+
+	err = runAdminCommand([]string{"create", "--email", "second@example.com", "--password-stdin"}, strings.NewReader("secret123\n"), &bytes.Buffer{}, userService, orgService)
+	assert.EqualError(t, err, "an admin already exists, use the admin API or --force")
+}
+
+func TestAdminCreate_RefusesWhenOrganizationAdminExists(t *testing.T) {
+	userService, orgService := setupUserService(t)
+	org, err := orgService.EnsureOrganization("Acme")
+	assert.NoError(t, err)
+	_, err = userService.CreateUser(org.ID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	err = runAdminCommand([]string{"create", "--email", "root@example.com", "--password-stdin"}, strings.NewReader("secret123\n"), &bytes.Buffer{}, userService, orgService)
+	assert.EqualError(t, err, "an admin already exists, use the admin API or --force")
+
+	// --force is the way back in when every admin is locked out
+	err = runAdminCommand([]string{"create", "--email", "root@example.com", "--password-stdin", "--force"}, strings.NewReader("secret123\n"), &bytes.Buffer{}, userService, orgService)
+	assert.NoError(t, err)
+	root, err := userService.GetUserByEmail("root@example.com")
+	assert.NoError(t, err)
+	assert.True(t, root.SuperAdmin)
+}
+
+func TestAdminCreate_InvalidArgs(t *testing.T) {
+	userService, orgService := setupUserService(t)
+
+	err := runAdminCommand([]string{"delete"}, strings.NewReader(""), &bytes.Buffer{}, userService, orgService)
+	assert.Error(t, err)
+
+	err = runAdminCommand([]string{"create", "--email", "root@example.com"}, strings.NewReader("secret123\n"), &bytes.Buffer{}, userService, orgService)
+	assert.EqualError(t, err, "--password-stdin is required")
+}
+
+func TestAdminPurgeUsers(t *testing.T) {
+	userService, orgService := setupUserService(t)
+	user, err := userService.CreateUser(uuid.New(), "leaver@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	_, err = userService.DeactivateUser(user.ID)
+	assert.NoError(t, err)
+
+	// Still within the default grace period
+	var out bytes.Buffer
+	err = runAdminCommand([]string{"purge-users"}, strings.NewReader(""), &out, userService, orgService)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Purged 0 deactivated users")
+
+	out.Reset()
+	err = runAdminCommand([]string{"purge-users", "--grace-period", "0s"}, strings.NewReader(""), &out, userService, orgService)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Purged 1 deactivated users")
+
+	_, err = userService.GetUserByID(user.ID)
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -36,11 +37,100 @@ func InitDB() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	// Auto-migrate the schema
-	db.AutoMigrate(&models.Ticket{})
+	db.AutoMigrate(&models.Ticket{}, &models.User{}, &models.Session{}, &models.SupersededRefreshToken{}, &models.RolePermission{}, &models.APIKey{}, &models.LoginThrottle{}, &models.PasswordResetToken{}, &models.Team{}, &models.Organization{}, &models.AuditEvent{}, &models.Workflow{})
+	if err := MigrateTicketUserReferences(db); err != nil {
+		log.Fatalf("Failed to migrate ticket user references: %v", err)
+	}
+	if err := MigrateOrganizations(db); err != nil {
+		log.Fatalf("Failed to migrate organizations: %v", err)
+	}
 	// Set the global DB variable
 	DB = db
 }
 
+// MigrateTicketUserReferences moves tickets from the legacy created_by and
+// assigned_to email columns to the created_by_id and assigned_to_id user
+// references. A legacy column is dropped once every email in it maps to a
+// user; otherwise it is kept so the unmapped emails are not lost.
+func MigrateTicketUserReferences(db *gorm.DB) error {
+	migrator := db.Migrator()
+	rebuilt := false
+	for _, ref := range []struct{ legacy, column string }{
+		{"created_by", "created_by_id"},
+		{"assigned_to", "assigned_to_id"},
+	} {
+		if !migrator.HasColumn(&models.Ticket{}, ref.legacy) {
+			continue
+		}
+
+		pending := fmt.Sprintf("%s IS NULL AND %s IS NOT NULL AND %s <> ''", ref.column, ref.legacy, ref.legacy)
+		update := fmt.Sprintf("UPDATE tickets SET %s = (SELECT users.id FROM users WHERE users.email = tickets.%s) WHERE %s",
+			ref.column, ref.legacy, pending)
+		if err := db.Exec(update).Error; err != nil {
+			return fmt.Errorf("failed to map %s to users: %w", ref.legacy, err)
+		}
+
+		var unmapped int64
+		if err := db.Table("tickets").Where(pending).Count(&unmapped).Error; err != nil {
+			return fmt.Errorf("failed to count unmapped %s: %w", ref.legacy, err)
+		}
+		if unmapped == 0 {
+			if err := migrator.DropColumn(&models.Ticket{}, ref.legacy); err != nil {
+				return fmt.Errorf("failed to drop %s: %w", ref.legacy, err)
+			}
+			rebuilt = true
+			continue
+		}
+
+		log.Printf("Warning: %d tickets have a %s email without a matching user; keeping the %s column", unmapped, ref.legacy, ref.legacy)
+		// New tickets no longer write the legacy column
+		relaxed, err := relaxLegacyColumn(db, ref.legacy)
+		if err != nil {
+			return fmt.Errorf("failed to relax %s: %w", ref.legacy, err)
+		}
+		rebuilt = rebuilt || relaxed
+	}
+
+	// SQLite changes columns by rebuilding the table, which loses its indexes
+	if rebuilt && db.Dialector.Name() == "sqlite" {
+		if err := db.AutoMigrate(&models.Ticket{}); err != nil {
+			return fmt.Errorf("failed to restore ticket indexes: %w", err)
+		}
+	}
+	return nil
+}
+
+// legacyTicketColumns declares the legacy email columns nullable
+type legacyTicketColumns struct {
+	CreatedBy  *string
+	AssignedTo *string
+}
+
+func (legacyTicketColumns) TableName() string {
+	return "tickets"
+}
+
+// relaxLegacyColumn drops NOT NULL from a legacy email column and reports
+// whether the tickets table had to be rebuilt for it
+func relaxLegacyColumn(db *gorm.DB, column string) (bool, error) {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return false, db.Exec(fmt.Sprintf("ALTER TABLE tickets ALTER COLUMN %s DROP NOT NULL", column)).Error
+	case "sqlite":
+		columns, err := db.Migrator().ColumnTypes(&legacyTicketColumns{})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range columns {
+			if nullable, ok := c.Nullable(); c.Name() == column && ok && !nullable {
+				// SQLite cannot alter a column in place
+				return true, db.Migrator().AlterColumn(&legacyTicketColumns{}, column)
+			}
+		}
+	}
+	return false, nil
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -49,3 +139,50 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// MigrateOrganizations moves users, tickets and teams created before
+// organizations existed into the default organization. The oldest admin of
+// such an installation becomes super admin; other admins stay admins of the
+// default organization and can be promoted by a super admin.
+func MigrateOrganizations(db *gorm.DB) error {
+	// Team names used to be unique across the installation
+	if db.Migrator().HasIndex(&models.Team{}, "idx_teams_name") {
+		if err := db.Migrator().DropIndex(&models.Team{}, "idx_teams_name"); err != nil {
+			return fmt.Errorf("failed to drop team name index: %w", err)
+		}
+	}
+
+	var orgs int64
+	if err := db.Model(&models.Organization{}).Count(&orgs).Error; err != nil {
+		return fmt.Errorf("failed to count organizations: %w", err)
+	}
+	if orgs > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		org := models.Organization{ID: uuid.New(), Name: models.DefaultOrganizationName}
+		if err := tx.Create(&org).Error; err != nil {
+			return fmt.Errorf("failed to create default organization: %w", err)
+		}
+		for _, model := range []interface{}{&models.User{}, &models.Ticket{}, &models.Team{}} {
+			if err := tx.Model(model).Where("organization_id IS NULL").Update("organization_id", org.ID).Error; err != nil {
+				return fmt.Errorf("failed to move data into the default organization: %w", err)
+			}
+		}
+
+		var admin models.User
+		result := tx.Where("role = ?", models.RoleAdmin).Order("created_at, id").Limit(1).Find(&admin)
+		if result.Error != nil {
+			return fmt.Errorf("failed to find the oldest admin: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := tx.Model(&admin).Update("super_admin", true).Error; err != nil {
+			return fmt.Errorf("failed to promote admin: %w", err)
+		}
+		log.Printf("Moved existing data into the %s organization and promoted its oldest admin %s to super admin", org.Name, admin.Email)
+		return nil
+	})
+}
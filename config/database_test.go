@@ -3,8 +3,15 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -23,3 +30,112 @@ func TestGetEnv(t *testing.T) {
 func TestInitDB_Skip(t *testing.T) {
 	t.Skip("Skipping InitDB test as it requires a real Postgres instance or mocking.")
 }
+
+type legacyTicket struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	Title       string    `gorm:"not null"`
+	Description string    `gorm:"not null"`
+	CreatedBy   string    `gorm:"not null"`
+	AssignedTo  string
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
+
+func (legacyTicket) TableName() string {
+	return "tickets"
+}
+
+func TestMigrateTicketUserReferences(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Schema as it was before tickets referenced users by ID
+	require.NoError(t, db.AutoMigrate(&legacyTicket{}))
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Ticket{}))
+
+	jane := models.User{ID: uuid.New(), Email: "jane@example.com", Password: "x", Role: models.RoleUser, Status: models.UserStatusActive}
+	john := models.User{ID: uuid.New(), Email: "john@example.com", Password: "x", Role: models.RoleUser, Status: models.UserStatusActive}
+	require.NoError(t, db.Create(&jane).Error)
+	require.NoError(t, db.Create(&john).Error)
+
+	insert := "INSERT INTO tickets (id, title, description, created_by, assigned_to, created_at, updated_at) VALUES (?, 't', 'd', ?, ?, ?, ?)"
+	now := time.Now()
+	assigned, unassigned, orphaned := uuid.New(), uuid.New(), uuid.New()
+	require.NoError(t, db.Exec(insert, assigned, "jane@example.com", "john@example.com", now, now).Error)
+	require.NoError(t, db.Exec(insert, unassigned, "john@example.com", "", now, now).Error)
+	require.NoError(t, db.Exec(insert, orphaned, "gone@example.com", "jane@example.com", now, now).Error)
+
+	require.NoError(t, MigrateTicketUserReferences(db))
+
+	var ticket models.Ticket
+	require.NoError(t, db.First(&ticket, "id = ?", assigned).Error)
+	assert.Equal(t, jane.ID, *ticket.CreatedByID)
+	assert.Equal(t, john.ID, *ticket.AssignedToID)
+
+	var other models.Ticket
+	require.NoError(t, db.First(&other, "id = ?", unassigned).Error)
+	assert.Equal(t, john.ID, *other.CreatedByID)
+	assert.Nil(t, other.AssignedToID)
+
+	var orphan models.Ticket
+	require.NoError(t, db.First(&orphan, "id = ?", orphaned).Error)
+	assert.Nil(t, orphan.CreatedByID)
+	assert.Equal(t, jane.ID, *orphan.AssignedToID)
+
+	// Every assignee mapped, but one reporter email has no user
+	assert.False(t, db.Migrator().HasColumn("tickets", "assigned_to"))
+	assert.True(t, db.Migrator().HasColumn("tickets", "created_by"))
+
+	// New tickets leave the kept column empty, and rebuilding the table for
+	// that kept its indexes
+	ticket = models.Ticket{ID: uuid.New(), OrganizationID: uuid.New(), Title: "t", Description: "d", CreatedByID: &jane.ID}
+	require.NoError(t, db.Create(&ticket).Error)
+	assert.True(t, db.Migrator().HasIndex(&models.Ticket{}, "idx_tickets_org_created"))
+	var count int64
+	require.NoError(t, db.Model(&models.Ticket{}).Count(&count).Error)
+	assert.Equal(t, int64(4), count)
+
+	// Running again is a no-op
+	require.NoError(t, MigrateTicketUserReferences(db))
+}
+
+func TestMigrateOrganizations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Ticket{}, &models.Team{}, &models.Organization{}))
+
+	// Rows written before organizations existed have no organization
+	now := time.Now()
+	admin, newer, agent, ticket := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	insertUser := "INSERT INTO users (id, email, password, role, created_at, updated_at) VALUES (?, ?, 'x', ?, ?, ?)"
+	require.NoError(t, db.Exec(insertUser, newer, "lead@example.com", models.RoleAdmin, now, now).Error)
+	require.NoError(t, db.Exec(insertUser, admin, "admin@example.com", models.RoleAdmin, now.Add(-time.Hour), now).Error)
+	require.NoError(t, db.Exec(insertUser, agent, "agent@example.com", models.RoleAgent, now, now).Error)
+	require.NoError(t, db.Exec("INSERT INTO tickets (id, title, description, created_at, updated_at) VALUES (?, 't', 'd', ?, ?)", ticket, now, now).Error)
+
+	require.NoError(t, MigrateOrganizations(db))
+
+	var org models.Organization
+	require.NoError(t, db.First(&org, "name = ?", models.DefaultOrganizationName).Error)
+
+	var users []models.User
+	require.NoError(t, db.Order("email").Find(&users).Error)
+	require.Len(t, users, 3)
+	for _, u := range users {
+		assert.Equal(t, org.ID, u.OrganizationID)
+	}
+	assert.True(t, users[0].SuperAdmin, "the oldest admin of a single-tenant installation keeps managing everything")
+	assert.False(t, users[1].SuperAdmin)
+	assert.False(t, users[2].SuperAdmin, "other admins only manage the default organization")
+	assert.Equal(t, models.RoleAdmin, users[2].Role)
+
+	var migrated models.Ticket
+	require.NoError(t, db.First(&migrated, "id = ?", ticket).Error)
+	assert.Equal(t, org.ID, migrated.OrganizationID)
+
+	// Running again is a no-op
+	require.NoError(t, MigrateOrganizations(db))
+	var orgs int64
+	db.Model(&models.Organization{}).Count(&orgs)
+	assert.EqualValues(t, 1, orgs)
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"fix-ticket-system/config"
 	"fix-ticket-system/metrics"
 	"fix-ticket-system/middleware"
 	"fix-ticket-system/models"
+	"fix-ticket-system/repository"
 	"fix-ticket-system/routes"
 	"fix-ticket-system/service"
 
@@ -16,6 +23,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 var ticketService service.TicketServiceInterface
@@ -28,6 +37,29 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// trustedProxies reads the comma-separated TRUSTED_PROXIES; none by default
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// newRouter returns the engine serving the API with the Prometheus middleware.
+// X-Forwarded-For only names the client IP, which logins are throttled by,
+// when the request comes from one of the trusted proxies.
+func newRouter(trustedProxies []string) (*gin.Engine, error) {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	r.Use(metrics.PrometheusMiddleware())
+	return r, nil
+}
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -36,24 +68,123 @@ func main() {
 
 	// Initialize database
 	config.InitDB()
+	if err := repository.MigrateTicketSearch(config.DB); err != nil {
+		if !errors.Is(err, repository.ErrSearchNotSupported) {
+			log.Fatalf("Failed to migrate ticket search: %v", err)
+		}
+		log.Printf("Warning: ticket search is disabled: %v", err)
+	}
+
+	passwordManager, err := loadPasswordManager()
+	if err != nil {
+		log.Fatalf("Failed to configure password hashing: %v", err)
+	}
 
 	// Initialize services
 	ticketService = service.NewTicketService()
-	userService := service.NewUserService(config.DB)
+	userService := service.NewUserService(config.DB, passwordManager)
+	sessionService := service.NewSessionService(config.DB)
+	rbacService := service.NewRBACService(config.DB)
+	apiKeyService := service.NewAPIKeyService(config.DB)
+	throttleService := service.NewLoginThrottleService(config.DB, service.DefaultLoginThrottleConfig)
+	teamService := service.NewTeamService(config.DB)
+	workflowService := service.NewWorkflowService(config.DB)
+	organizationService := service.NewOrganizationService(config.DB)
+	auditService := service.NewAuditService(config.DB)
+	totpService := service.NewTOTPService(config.DB, getEnv("TOTP_ISSUER", "Fix Ticket System"))
+	if err := rbacService.SeedDefaults(); err != nil {
+		log.Fatalf("Failed to seed role permissions: %v", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdminCommand(os.Args[2:], os.Stdin, os.Stdout, userService, organizationService); err != nil {
+			log.Fatalf("admin: %v", err)
+		}
+		return
+	}
 
 	// Initialize auth middleware
-	authMiddleware := middleware.NewAuthMiddleware(userService, getEnv("JWT_SECRET", "your-secret-key"))
+	keyRing, err := loadKeyRing()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	authMiddleware := middleware.NewAuthMiddleware(userService, sessionService, rbacService, apiKeyService, organizationService, auditService, keyRing)
 
 	// Initialize router
-	r := gin.Default()
-
-	// Add Prometheus middleware
-	r.Use(metrics.PrometheusMiddleware())
+	r, err := newRouter(trustedProxies())
+	if err != nil {
+		log.Fatalf("Failed to configure router: %v", err)
+	}
 
 	// Register routes
-	InitializeRoutes(r)
-	adminRoutes := routes.NewAdminRoutes(userService, authMiddleware)
+	InitializeRoutes(r, authMiddleware)
+	authenticator, err := loadAuthenticator(userService, organizationService)
+	if err != nil {
+		log.Fatalf("Failed to configure LDAP authentication: %v", err)
+	}
+	authRoutes := routes.NewAuthRoutes(userService, authenticator, sessionService, throttleService, authMiddleware)
+	authRoutes.Register(r)
+	adminRoutes := routes.NewAdminRoutes(userService, sessionService, apiKeyService, rbacService, throttleService, auditService, authMiddleware)
 	adminRoutes.Register(r)
+	apiKeyRoutes := routes.NewAPIKeyRoutes(apiKeyService, userService, authMiddleware)
+	apiKeyRoutes.Register(r)
+	twoFactorRoutes := routes.NewTwoFactorRoutes(totpService, sessionService, throttleService, authMiddleware)
+	twoFactorRoutes.Register(r)
+	meRoutes := routes.NewMeRoutes(userService, sessionService, authMiddleware)
+	meRoutes.Register(r)
+	teamRoutes := routes.NewTeamRoutes(teamService, userService, ticketService, authMiddleware)
+	teamRoutes.Register(r)
+	workflowRoutes := routes.NewWorkflowRoutes(workflowService, ticketService, authMiddleware)
+	workflowRoutes.Register(r)
+	organizationRoutes := routes.NewOrganizationRoutes(organizationService, userService, authMiddleware)
+	organizationRoutes.Register(r)
+	scimRoutes := routes.NewSCIMRoutes(userService, teamService, sessionService, apiKeyService, authMiddleware)
+	scimRoutes.Register(r)
+
+	// Single sign-on is only enabled when an OIDC issuer is configured
+	if issuer := getEnv("OIDC_ISSUER", ""); issuer != "" {
+		roleMapping, err := service.ParseRoleMapping(getEnv("OIDC_ROLE_MAPPING", ""))
+		if err != nil {
+			log.Fatalf("Failed to parse OIDC_ROLE_MAPPING: %v", err)
+		}
+		defaultRole := models.Role(getEnv("OIDC_DEFAULT_ROLE", string(models.RoleUser)))
+		if !defaultRole.IsValid() {
+			log.Fatalf("Invalid OIDC_DEFAULT_ROLE %q", defaultRole)
+		}
+		stateSecret := []byte(getEnv("OIDC_STATE_SECRET", ""))
+		if len(stateSecret) == 0 {
+			// Logins then only complete on the instance that started them
+			log.Printf("Warning: OIDC_STATE_SECRET is not set, using an ephemeral secret")
+			stateSecret = make([]byte, 32)
+			if _, err := rand.Read(stateSecret); err != nil {
+				log.Fatalf("Failed to generate OIDC state secret: %v", err)
+			}
+		}
+		oidcService := service.NewOIDCService(service.OIDCConfig{
+			Issuer:       issuer,
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+			GroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			RoleMapping:  roleMapping,
+			DefaultRole:  defaultRole,
+			StateSecret:  stateSecret,
+		}, nil)
+		oidcOrg, err := organizationService.EnsureOrganization(getEnv("OIDC_ORGANIZATION", models.DefaultOrganizationName))
+		if err != nil {
+			log.Fatalf("Failed to load OIDC_ORGANIZATION: %v", err)
+		}
+		oidcRoutes := routes.NewOIDCRoutes(oidcService, userService, sessionService, authMiddleware, oidcOrg.ID)
+		oidcRoutes.Register(r)
+	}
+
+	// Password reset needs a mail relay to deliver reset links
+	if smtpAddr := getEnv("SMTP_ADDR", ""); smtpAddr != "" {
+		mailer := service.NewSMTPMailer(smtpAddr, getEnv("SMTP_FROM", "no-reply@localhost"), getEnv("SMTP_USERNAME", ""), getEnv("SMTP_PASSWORD", ""))
+		resetService := service.NewPasswordResetService(config.DB, mailer, passwordManager, getEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"))
+		passwordResetRoutes := routes.NewPasswordResetRoutes(resetService, sessionService, throttleService)
+		passwordResetRoutes.Register(r)
+	}
 
 	// Start server
 	port := getEnv("PORT", "8080")
@@ -63,8 +194,144 @@ func main() {
 	}
 }
 
+// RouteGuard authenticates and authorizes requests to the ticket routes.
+// It is implemented by middleware.AuthMiddleware.
+type RouteGuard interface {
+	RequireAuth() gin.HandlerFunc
+	RequirePermission(permission models.Permission) gin.HandlerFunc
+}
+
+// loadKeyRing builds the access token key ring from JWT_KEYS_DIR, JWT_ACTIVE_KEY_ID and JWT_SECRET
+func loadKeyRing() (*middleware.KeyRing, error) {
+	var secret []byte
+	if s := getEnv("JWT_SECRET", ""); s != "" {
+		secret = []byte(s)
+	}
+	dir := getEnv("JWT_KEYS_DIR", "")
+
+	if secret == nil && dir == "" {
+		// Never fall back to a well-known secret; tokens just won't survive a restart
+		log.Printf("Warning: neither JWT_KEYS_DIR nor JWT_SECRET is set, using an ephemeral signing key")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return middleware.LoadKeyRing(dir, getEnv("JWT_ACTIVE_KEY_ID", ""), secret)
+}
+
+// loadPasswordManager builds the password hashing and policy from PASSWORD_HASHER,
+// the ARGON2_* and BCRYPT_COST parameters and the PASSWORD_* policy settings.
+// Hashes of the other algorithm, or with other parameters, are upgraded on login.
+func loadPasswordManager() (*service.PasswordManager, error) {
+	policy := service.DefaultPasswordPolicy
+	var err error
+	if policy.MinLength, err = getEnvInt("PASSWORD_MIN_LENGTH", policy.MinLength); err != nil {
+		return nil, err
+	}
+	if policy.MaxLength, err = getEnvInt("PASSWORD_MAX_LENGTH", policy.MaxLength); err != nil {
+		return nil, err
+	}
+	if path := getEnv("PASSWORD_BREACH_LIST", ""); path != "" {
+		if err := policy.LoadBreachList(path); err != nil {
+			return nil, err
+		}
+	}
+
+	params := service.DefaultArgon2idParams
+	memory, err := getEnvInt("ARGON2_MEMORY_KIB", int(params.Memory))
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := getEnvInt("ARGON2_ITERATIONS", int(params.Iterations))
+	if err != nil {
+		return nil, err
+	}
+	parallelism, err := getEnvInt("ARGON2_PARALLELISM", int(params.Parallelism))
+	if err != nil {
+		return nil, err
+	}
+	if memory < 1 || iterations < 1 || parallelism < 1 || parallelism > 255 {
+		return nil, errors.New("invalid ARGON2_* parameters")
+	}
+	params.Memory, params.Iterations, params.Parallelism = uint32(memory), uint32(iterations), uint8(parallelism)
+	argon2id := service.NewArgon2idHasher(params)
+
+	cost, err := getEnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	bcryptHasher := service.NewBcryptHasher(cost)
+
+	switch hasher := getEnv("PASSWORD_HASHER", "argon2id"); hasher {
+	case "argon2id":
+		return service.NewPasswordManager(&policy, argon2id, bcryptHasher), nil
+	case "bcrypt":
+		return service.NewPasswordManager(&policy, bcryptHasher, argon2id), nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q, expected argon2id or bcrypt", hasher)
+	}
+}
+
+// loadAuthenticator checks logins against the LDAP directory when LDAP_URL is
+// set. Local accounts are checked first, so they stay available for break-glass
+// access when the directory is not.
+func loadAuthenticator(userService *service.UserService, organizationService *service.OrganizationService) (service.Authenticator, error) {
+	local := service.NewLocalAuthenticator(userService)
+	ldapURL := getEnv("LDAP_URL", "")
+	if ldapURL == "" {
+		return local, nil
+	}
+
+	roleMapping, err := service.ParseRoleMapping(getEnv("LDAP_ROLE_MAPPING", ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LDAP_ROLE_MAPPING: %w", err)
+	}
+	defaultRole := models.Role(getEnv("LDAP_DEFAULT_ROLE", string(models.RoleUser)))
+	if !defaultRole.IsValid() {
+		return nil, fmt.Errorf("invalid LDAP_DEFAULT_ROLE %q", defaultRole)
+	}
+	org, err := organizationService.EnsureOrganization(getEnv("LDAP_ORGANIZATION", models.DefaultOrganizationName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LDAP_ORGANIZATION: %w", err)
+	}
+
+	ldapAuthenticator := service.NewLDAPAuthenticator(service.LDAPConfig{
+		URL:            ldapURL,
+		StartTLS:       getEnv("LDAP_START_TLS", "") == "true",
+		BindDN:         getEnv("LDAP_BIND_DN", ""),
+		BindPassword:   getEnv("LDAP_BIND_PASSWORD", ""),
+		UserBaseDN:     getEnv("LDAP_USER_BASE_DN", ""),
+		UserFilter:     getEnv("LDAP_USER_FILTER", ""),
+		EmailAttribute: getEnv("LDAP_EMAIL_ATTRIBUTE", ""),
+		IDAttribute:    getEnv("LDAP_ID_ATTRIBUTE", ""),
+		GroupBaseDN:    getEnv("LDAP_GROUP_BASE_DN", ""),
+		GroupFilter:    getEnv("LDAP_GROUP_FILTER", ""),
+		GroupAttribute: getEnv("LDAP_GROUP_ATTRIBUTE", ""),
+		RoleMapping:    roleMapping,
+		DefaultRole:    defaultRole,
+	}, userService, org.ID)
+	return service.NewChainAuthenticator(local, ldapAuthenticator), nil
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return n, nil
+}
+
 // InitializeRoutes initializes the application's routes
-func InitializeRoutes(router *gin.Engine) {
+func InitializeRoutes(router *gin.Engine, guard RouteGuard) {
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -80,22 +347,39 @@ func InitializeRoutes(router *gin.Engine) {
 	{
 		// Ticket routes
 		tickets := api.Group("/tickets")
+		tickets.Use(guard.RequireAuth())
 		{
-			tickets.POST("/", createTicket)
-			tickets.GET("/", getTickets)
-			tickets.GET("/:id", getTicket)
+			tickets.POST("/", guard.RequirePermission(models.PermissionTicketCreate), createTicket)
+			tickets.GET("/", guard.RequirePermission(models.PermissionTicketRead), getTickets)
+			tickets.GET("/search", guard.RequirePermission(models.PermissionTicketRead), searchTickets)
+			tickets.GET("/:id", guard.RequirePermission(models.PermissionTicketRead), getTicket)
 			tickets.PUT("/:id", updateTicket)
+			tickets.PATCH("/:id", patchTicket)
+			tickets.GET("/:id/transitions", guard.RequirePermission(models.PermissionTicketRead), getTicketTransitions)
+			tickets.POST("/:id/transitions", transitionTicket)
 			tickets.DELETE("/:id", deleteTicket)
 		}
+
+		// Tickets of the current user
+		me := api.Group("/me")
+		me.Use(guard.RequireAuth())
+		{
+			me.GET("/tickets", getMyTickets)
+		}
 	}
 }
 
 // Handler functions
 func createTicket(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
 	var input struct {
 		Title       string `json:"title" binding:"required"`
 		Description string `json:"description" binding:"required"`
-		CreatedBy   string `json:"created_by" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -104,7 +388,8 @@ func createTicket(c *gin.Context) {
 		return
 	}
 
-	ticket, err := ticketService.CreateTicket(input.Title, input.Description, input.CreatedBy)
+	orgID, _ := middleware.CurrentOrganization(c)
+	ticket, err := ticketService.CreateTicket(orgID, input.Title, input.Description, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -113,8 +398,179 @@ func createTicket(c *gin.Context) {
 	c.JSON(http.StatusCreated, ticket)
 }
 
+// getTickets returns one page of tickets as a JSON array. The number of tickets
+// matching the filters is sent in the X-Total-Count header and the next page,
+// if any, in the Link header.
 func getTickets(c *gin.Context) {
-	tickets, err := ticketService.GetAllTickets()
+	query, err := parseTicketQuery(c)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_input").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	page, err := ticketService.ListTickets(orgID, query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("cursor", page.NextCursor)
+		next.RawQuery = params.Encode()
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	tickets := page.Tickets
+	if tickets == nil {
+		tickets = []models.Ticket{}
+	}
+	c.JSON(http.StatusOK, tickets)
+}
+
+// searchTickets returns the tickets matching the words of q, best match first,
+// with their rank and highlighted matches
+func searchTickets(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", value)})
+			return
+		}
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	results, err := ticketService.SearchTickets(orgID, c.Query("q"), limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEmptySearch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one word"})
+		case errors.Is(err, repository.ErrSearchNotSupported):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// parseTicketQuery reads the filters, sort and page of a ticket listing.
+// Filters taking several values accept them comma separated or repeated;
+// "me" stands for the current user.
+func parseTicketQuery(c *gin.Context) (repository.TicketQuery, error) {
+	var query repository.TicketQuery
+	for _, value := range queryList(c, "status") {
+		status := models.Status(value)
+		if !status.IsValid() {
+			return query, fmt.Errorf("invalid status %q", value)
+		}
+		query.Statuses = append(query.Statuses, status)
+	}
+	for _, value := range queryList(c, "priority") {
+		priority := models.Priority(value)
+		if !priority.IsValid() {
+			return query, fmt.Errorf("invalid priority %q", value)
+		}
+		query.Priorities = append(query.Priorities, priority)
+	}
+
+	if value := c.Query("assignee"); value == "none" {
+		query.Unassigned = true
+	} else if value != "" {
+		id, err := parseUserParam(c, value)
+		if err != nil {
+			return query, fmt.Errorf("invalid assignee %q", value)
+		}
+		query.AssigneeID = &id
+	}
+	if value := c.Query("reporter"); value != "" {
+		id, err := parseUserParam(c, value)
+		if err != nil {
+			return query, fmt.Errorf("invalid reporter %q", value)
+		}
+		query.ReporterID = &id
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"updated_after":  &query.UpdatedAfter,
+		"updated_before": &query.UpdatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s %q, expected RFC 3339 time or date", param, value)
+		}
+		*target = &t
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		query.Sort = strings.TrimPrefix(sort, "-")
+		query.Descending = strings.HasPrefix(sort, "-")
+		if !repository.IsTicketSort(query.Sort) {
+			return query, fmt.Errorf("invalid sort %q", sort)
+		}
+	} else {
+		// Newest tickets first
+		query.Descending = true
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+		query.Limit = limit
+	}
+	query.Cursor = c.Query("cursor")
+	return query, nil
+}
+
+func queryList(c *gin.Context, param string) []string {
+	var values []string
+	for _, value := range c.QueryArray(param) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func parseUserParam(c *gin.Context, value string) (uuid.UUID, error) {
+	if value == "me" {
+		user, _ := middleware.CurrentUser(c)
+		return user.ID, nil
+	}
+	return uuid.Parse(value)
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func getMyTickets(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	tickets, err := ticketService.GetTicketsForUser(orgID, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -131,7 +587,8 @@ func getTicket(c *gin.Context) {
 		return
 	}
 
-	ticket, err := ticketService.GetTicket(id)
+	orgID, _ := middleware.CurrentOrganization(c)
+	ticket, err := ticketService.GetTicket(orgID, id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
 		return
@@ -153,7 +610,8 @@ func updateTicket(c *gin.Context) {
 		Description string          `json:"description" binding:"required"`
 		Status      models.Status   `json:"status" binding:"required"`
 		Priority    models.Priority `json:"priority" binding:"required"`
-		AssignedTo  string          `json:"assigned_to"`
+		AssignedTo  *uuid.UUID      `json:"assigned_to_id"`
+		TeamID      *uuid.UUID      `json:"team_id"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -162,8 +620,41 @@ func updateTicket(c *gin.Context) {
 		return
 	}
 
-	ticket, err := ticketService.UpdateTicket(id, input.Title, input.Description, input.Status, input.Priority, input.AssignedTo)
+	orgID, _ := middleware.CurrentOrganization(c)
+	existing, err := ticketService.GetTicket(orgID, id)
 	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	// Users with ticket:update may edit any ticket, others only tickets they reported or are assigned to
+	user, _ := middleware.CurrentUser(c)
+	if !middleware.HasPermission(c, models.PermissionTicketUpdate) && !existing.IsReportedBy(user) && !existing.IsAssignedTo(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to modify this ticket"})
+		return
+	}
+	if (existing.AssigneeChanged(input.AssignedTo) || existing.TeamChanged(input.TeamID)) && !middleware.HasPermission(c, models.PermissionTicketAssign) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to assign this ticket"})
+		return
+	}
+
+	ticket, err := ticketService.UpdateTicket(orgID, id, input.Title, input.Description, input.Status, input.Priority, input.AssignedTo, input.TeamID)
+	if err != nil {
+		if respondTransitionError(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrTeamNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team not found"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidAssignee) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee must be an active user"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidTicketPatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -171,6 +662,188 @@ func updateTicket(c *gin.Context) {
 	c.JSON(http.StatusOK, ticket)
 }
 
+// patchTicket changes only the fields named in a JSON Merge Patch (RFC 7396)
+// or JSON Patch (RFC 6902) document. Plain application/json is read as a merge
+// patch.
+func patchTicket(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_id").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var apply func(ticketDocument, []byte) (service.TicketPatch, error)
+	switch c.ContentType() {
+	case mergePatchContentType, "application/json":
+		apply = applyMergePatch
+	case jsonPatchContentType:
+		apply = applyJSONPatch
+	default:
+		c.Header("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported patch format"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_input").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	existing, err := ticketService.GetTicket(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	// Users with ticket:update may edit any ticket, others only tickets they reported or are assigned to
+	user, _ := middleware.CurrentUser(c)
+	if !middleware.HasPermission(c, models.PermissionTicketUpdate) && !existing.IsReportedBy(user) && !existing.IsAssignedTo(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to modify this ticket"})
+		return
+	}
+
+	patch, err := apply(newTicketDocument(existing), body)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_input").Inc()
+		switch {
+		case errors.Is(err, errPatchTestFailed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, errUnprocessablePatch):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if len(patch.Fields) == 0 {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	assigneeChanged := patch.Has(models.TicketFieldAssignedTo) && existing.AssigneeChanged(patch.AssignedTo)
+	teamChanged := patch.Has(models.TicketFieldTeam) && existing.TeamChanged(patch.TeamID)
+	if (assigneeChanged || teamChanged) && !middleware.HasPermission(c, models.PermissionTicketAssign) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to assign this ticket"})
+		return
+	}
+
+	ticket, err := ticketService.PatchTicket(orgID, id, patch)
+	if err != nil {
+		if respondTransitionError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidTicketPatch):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTeamNotFound):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Team not found"})
+		case errors.Is(err, service.ErrInvalidAssignee):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Assignee must be an active user"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// getTicketTransitions lists the status changes the ticket's workflow allows
+// from its current status
+func getTicketTransitions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_id").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	ticket, err := ticketService.GetTicket(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	workflow, err := ticketService.GetWorkflow(orgID, ticket.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": ticket.Status, "workflow": workflow, "transitions": workflow.TransitionsFrom(ticket.Status)})
+}
+
+// transitionTicket moves a ticket to another status along its workflow
+func transitionTicket(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_id").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	var input struct {
+		Status models.Status `json:"status" binding:"required"`
+		Reason string        `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		metrics.ErrorTotal.WithLabelValues("invalid_input").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	existing, err := ticketService.GetTicket(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	// Users with ticket:update may move any ticket, others only tickets they reported or are assigned to
+	user, _ := middleware.CurrentUser(c)
+	if !middleware.HasPermission(c, models.PermissionTicketUpdate) && !existing.IsReportedBy(user) && !existing.IsAssignedTo(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to modify this ticket"})
+		return
+	}
+
+	ticket, err := ticketService.TransitionTicket(orgID, id, input.Status, input.Reason)
+	if err != nil {
+		if respondTransitionError(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// respondTransitionError answers status changes the workflow refuses: 409 for
+// changes not allowed from the current status, 422 for unmet requirements. It
+// reports whether err was one of them.
+func respondTransitionError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrTransitionNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTransitionRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
 func deleteTicket(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -179,7 +852,21 @@ func deleteTicket(c *gin.Context) {
 		return
 	}
 
-	if err := ticketService.DeleteTicket(id); err != nil {
+	orgID, _ := middleware.CurrentOrganization(c)
+	existing, err := ticketService.GetTicket(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	// Users with ticket:delete may delete any ticket, others only tickets they reported
+	user, _ := middleware.CurrentUser(c)
+	if !middleware.HasPermission(c, models.PermissionTicketDelete) && !existing.IsReportedBy(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this ticket"})
+		return
+	}
+
+	if err := ticketService.DeleteTicket(orgID, id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
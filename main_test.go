@@ -7,14 +7,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"fix-ticket-system/middleware"
 	"fix-ticket-system/models"
+	"fix-ticket-system/repository"
+	"fix-ticket-system/routes"
 	"fix-ticket-system/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 // MockTicketService is a mock for the ticket service
@@ -24,35 +31,113 @@ type MockTicketService struct {
 
 var _ service.TicketServiceInterface = (*MockTicketService)(nil)
 
-func (m *MockTicketService) CreateTicket(title, description, createdBy string) (*models.Ticket, error) {
-	args := m.Called(title, description, createdBy)
+func (m *MockTicketService) CreateTicket(orgID uuid.UUID, title, description string, createdBy uuid.UUID) (*models.Ticket, error) {
+	args := m.Called(orgID, title, description, createdBy)
 	return args.Get(0).(*models.Ticket), args.Error(1)
 }
 
-func (m *MockTicketService) GetTicket(id uuid.UUID) (*models.Ticket, error) {
-	args := m.Called(id)
+func (m *MockTicketService) GetTicket(orgID, id uuid.UUID) (*models.Ticket, error) {
+	args := m.Called(orgID, id)
 	return args.Get(0).(*models.Ticket), args.Error(1)
 }
 
-func (m *MockTicketService) GetAllTickets() ([]models.Ticket, error) {
-	args := m.Called()
+func (m *MockTicketService) ListTickets(orgID uuid.UUID, query repository.TicketQuery) (*repository.TicketPage, error) {
+	args := m.Called(orgID, query)
+	page, _ := args.Get(0).(*repository.TicketPage)
+	return page, args.Error(1)
+}
+
+func (m *MockTicketService) SearchTickets(orgID uuid.UUID, query string, limit int) ([]repository.TicketSearchResult, error) {
+	args := m.Called(orgID, query, limit)
+	results, _ := args.Get(0).([]repository.TicketSearchResult)
+	return results, args.Error(1)
+}
+
+func (m *MockTicketService) GetTicketsForUser(orgID, userID uuid.UUID) ([]models.Ticket, error) {
+	args := m.Called(orgID, userID)
+	return args.Get(0).([]models.Ticket), args.Error(1)
+}
+
+func (m *MockTicketService) GetTicketsForTeam(orgID, teamID uuid.UUID) ([]models.Ticket, error) {
+	args := m.Called(orgID, teamID)
 	return args.Get(0).([]models.Ticket), args.Error(1)
 }
 
-func (m *MockTicketService) UpdateTicket(id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo string) (*models.Ticket, error) {
-	args := m.Called(id, title, description, status, priority, assignedTo)
+func (m *MockTicketService) UpdateTicket(orgID, id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo, teamID *uuid.UUID) (*models.Ticket, error) {
+	args := m.Called(orgID, id, title, description, status, priority, assignedTo, teamID)
+	return args.Get(0).(*models.Ticket), args.Error(1)
+}
+
+func (m *MockTicketService) PatchTicket(orgID, id uuid.UUID, patch service.TicketPatch) (*models.Ticket, error) {
+	args := m.Called(orgID, id, patch)
 	return args.Get(0).(*models.Ticket), args.Error(1)
 }
 
-func (m *MockTicketService) DeleteTicket(id uuid.UUID) error {
-	args := m.Called(id)
+func (m *MockTicketService) TransitionTicket(orgID, id uuid.UUID, to models.Status, reason string) (*models.Ticket, error) {
+	args := m.Called(orgID, id, to, reason)
+	return args.Get(0).(*models.Ticket), args.Error(1)
+}
+
+func (m *MockTicketService) GetWorkflow(orgID uuid.UUID, teamID *uuid.UUID) (*models.Workflow, error) {
+	args := m.Called(orgID, teamID)
+	return args.Get(0).(*models.Workflow), args.Error(1)
+}
+
+func (m *MockTicketService) DeleteTicket(orgID, id uuid.UUID) error {
+	args := m.Called(orgID, id)
 	return args.Error(0)
 }
 
+var testOrgID = uuid.New()
+
+var testUser = &models.User{ID: uuid.New(), OrganizationID: testOrgID, Email: "test@example.com", Role: models.RoleUser}
+
+func idPtr(id uuid.UUID) *uuid.UUID {
+	return &id
+}
+
+// fakeGuard stands in for middleware.AuthMiddleware and authenticates every
+// request as user, acting in the organization testOrgID
+type fakeGuard struct {
+	user        *models.User
+	permissions []models.Permission
+}
+
+func (g *fakeGuard) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g.user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			return
+		}
+		c.Set("user", g.user)
+		c.Set("organization_id", testOrgID)
+		c.Set("permissions", g.permissions)
+		c.Next()
+	}
+}
+
+func (g *fakeGuard) RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !middleware.HasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing permission " + string(permission)})
+			return
+		}
+		c.Next()
+	}
+}
+
 func setupRouter() *gin.Engine {
+	return setupRouterAs(testUser)
+}
+
+func setupRouterAs(user *models.User) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	InitializeRoutes(r)
+	var permissions []models.Permission
+	if user != nil {
+		permissions = models.DefaultRolePermissions[user.Role]
+	}
+	InitializeRoutes(r, &fakeGuard{user: user, permissions: permissions})
 	return r
 }
 
@@ -75,16 +160,17 @@ func TestCreateTicket(t *testing.T) {
 		ID:          uuid.New(),
 		Title:       "Test Title",
 		Description: "Test Description",
-		CreatedBy:   "test@example.com",
+		CreatedByID: &testUser.ID,
+		CreatedBy:   &models.UserSummary{ID: testUser.ID, Email: testUser.Email},
 	}
 
-	mockService.On("CreateTicket", "Test Title", "Test Description", "test@example.com").Return(expectedTicket, nil)
+	mockService.On("CreateTicket", testOrgID, "Test Title", "Test Description", testUser.ID).Return(expectedTicket, nil)
 
 	r := setupRouter()
 	reqBody, _ := json.Marshal(map[string]string{
 		"title":       "Test Title",
 		"description": "Test Description",
-		"created_by":  "test@example.com",
+		"created_by":  "spoofed@example.com",
 	})
 	req := httptest.NewRequest("POST", "/api/v1/tickets/", bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
@@ -98,7 +184,8 @@ func TestCreateTicket(t *testing.T) {
 	assert.Equal(t, expectedTicket.ID, response.ID)
 	assert.Equal(t, expectedTicket.Title, response.Title)
 	assert.Equal(t, expectedTicket.Description, response.Description)
-	assert.Equal(t, expectedTicket.CreatedBy, response.CreatedBy)
+	require.NotNil(t, response.CreatedBy)
+	assert.Equal(t, testUser.Email, response.CreatedBy.Email)
 }
 
 func TestGetTickets(t *testing.T) {
@@ -106,10 +193,11 @@ func TestGetTickets(t *testing.T) {
 	ticketService = mockService
 
 	expectedTickets := []models.Ticket{
-		{ID: uuid.New(), Title: "T1", Description: "D1", CreatedBy: "a@example.com"},
-		{ID: uuid.New(), Title: "T2", Description: "D2", CreatedBy: "b@example.com"},
+		{ID: uuid.New(), Title: "T1", Description: "D1", CreatedByID: idPtr(uuid.New())},
+		{ID: uuid.New(), Title: "T2", Description: "D2", CreatedByID: idPtr(uuid.New())},
 	}
-	mockService.On("GetAllTickets").Return(expectedTickets, nil)
+	mockService.On("ListTickets", testOrgID, repository.TicketQuery{Descending: true}).
+		Return(&repository.TicketPage{Tickets: expectedTickets, Total: 2}, nil)
 
 	r := setupRouter()
 	req := httptest.NewRequest("GET", "/api/v1/tickets/", nil)
@@ -117,15 +205,63 @@ func TestGetTickets(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Empty(t, w.Header().Get("Link"))
 	var response []models.Ticket
 	json.Unmarshal(w.Body.Bytes(), &response)
 	assert.Len(t, response, 2)
 }
 
+func TestGetTickets_Query(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	assignee := uuid.New()
+	after := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mockService.On("ListTickets", testOrgID, repository.TicketQuery{
+		Statuses:     []models.Status{models.StatusOpen, models.StatusInProgress},
+		Priorities:   []models.Priority{models.PriorityHigh},
+		AssigneeID:   &assignee,
+		ReporterID:   &testUser.ID,
+		CreatedAfter: &after,
+		Sort:         repository.SortPriority,
+		Descending:   true,
+		Limit:        10,
+	}).Return(&repository.TicketPage{Tickets: []models.Ticket{{ID: uuid.New()}}, Total: 25, NextCursor: "next-page"}, nil)
+
+	r := setupRouter()
+	req := httptest.NewRequest("GET", "/api/v1/tickets/?status=open,in_progress&priority=high&assignee="+assignee.String()+
+		"&reporter=me&created_after=2024-03-01&sort=-priority&limit=10", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "25", w.Header().Get("X-Total-Count"))
+	assert.Contains(t, w.Header().Get("Link"), "cursor=next-page")
+	assert.Contains(t, w.Header().Get("Link"), "sort=-priority")
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+	mockService.AssertExpectations(t)
+}
+
+func TestGetTickets_InvalidQuery(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+	mockService.On("ListTickets", testOrgID, repository.TicketQuery{Descending: true, Cursor: "garbage"}).
+		Return(nil, repository.ErrInvalidCursor)
+
+	r := setupRouter()
+	for _, query := range []string{"status=Pending!", "priority=urgent", "assignee=bob", "created_before=yesterday", "sort=title", "limit=0", "cursor=garbage"} {
+		req := httptest.NewRequest("GET", "/api/v1/tickets/?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
 func TestGetTickets_Error(t *testing.T) {
 	mockService := new(MockTicketService)
 	ticketService = mockService
-	mockService.On("GetAllTickets").Return([]models.Ticket{}, fmt.Errorf("db error"))
+	mockService.On("ListTickets", testOrgID, repository.TicketQuery{Descending: true}).Return(nil, fmt.Errorf("db error"))
 
 	r := setupRouter()
 	req := httptest.NewRequest("GET", "/api/v1/tickets/", nil)
@@ -136,13 +272,51 @@ func TestGetTickets_Error(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "db error")
 }
 
+func TestSearchTickets(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+	results := []repository.TicketSearchResult{{
+		Ticket:         models.Ticket{ID: uuid.New(), Title: "Printer is jammed"},
+		Rank:           0.8,
+		TitleHighlight: "<mark>Printer</mark> is jammed",
+	}}
+	mockService.On("SearchTickets", testOrgID, "printer", 0).Return(results, nil)
+	mockService.On("SearchTickets", testOrgID, "printer", 5).Return(results, nil)
+	mockService.On("SearchTickets", testOrgID, "", 0).Return(nil, repository.ErrEmptySearch)
+	mockService.On("SearchTickets", testOrgID, "vpn", 0).Return(nil, repository.ErrSearchNotSupported)
+
+	r := setupRouter()
+	for query, status := range map[string]int{
+		"q=printer":         http.StatusOK,
+		"q=printer&limit=5": http.StatusOK,
+		"q=printer&limit=0": http.StatusBadRequest,
+		"":                  http.StatusBadRequest,
+		"q=vpn":             http.StatusNotImplemented,
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/tickets/search?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, query)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/tickets/search?q=printer", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var response []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, "Printer is jammed", response[0]["title"])
+	assert.Equal(t, "<mark>Printer</mark> is jammed", response[0]["title_highlight"])
+	assert.Equal(t, 0.8, response[0]["rank"])
+}
+
 func TestGetTicket(t *testing.T) {
 	mockService := new(MockTicketService)
 	ticketService = mockService
 
 	id := uuid.New()
-	expectedTicket := &models.Ticket{ID: id, Title: "T", Description: "D", CreatedBy: "a@example.com"}
-	mockService.On("GetTicket", id).Return(expectedTicket, nil)
+	expectedTicket := &models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: idPtr(uuid.New())}
+	mockService.On("GetTicket", testOrgID, id).Return(expectedTicket, nil)
 
 	r := setupRouter()
 	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
@@ -160,7 +334,7 @@ func TestGetTicket_NotFound(t *testing.T) {
 	ticketService = mockService
 
 	id := uuid.New()
-	mockService.On("GetTicket", id).Return((*models.Ticket)(nil), fmt.Errorf("not found"))
+	mockService.On("GetTicket", testOrgID, id).Return((*models.Ticket)(nil), fmt.Errorf("not found"))
 
 	r := setupRouter()
 	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
@@ -189,19 +363,21 @@ func TestUpdateTicket(t *testing.T) {
 	ticketService = mockService
 
 	id := uuid.New()
+	assignee := uuid.New()
 	expectedTicket := &models.Ticket{
-		ID: id, Title: "Updated", Description: "Updated", CreatedBy: "a@example.com",
-		Status: models.StatusInProgress, Priority: models.PriorityHigh, AssignedTo: "assignee@example.com",
+		ID: id, Title: "Updated", Description: "Updated", CreatedByID: &testUser.ID,
+		Status: models.StatusInProgress, Priority: models.PriorityHigh, AssignedToID: &assignee,
 	}
-	mockService.On("UpdateTicket", id, "Updated", "Updated", models.StatusInProgress, models.PriorityHigh, "assignee@example.com").Return(expectedTicket, nil)
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: &testUser.ID, AssignedToID: &assignee}, nil)
+	mockService.On("UpdateTicket", testOrgID, id, "Updated", "Updated", models.StatusInProgress, models.PriorityHigh, &assignee, (*uuid.UUID)(nil)).Return(expectedTicket, nil)
 
 	r := setupRouter()
 	reqBody, _ := json.Marshal(map[string]interface{}{
-		"title":       "Updated",
-		"description": "Updated",
-		"status":      models.StatusInProgress,
-		"priority":    models.PriorityHigh,
-		"assigned_to": "assignee@example.com",
+		"title":          "Updated",
+		"description":    "Updated",
+		"status":         models.StatusInProgress,
+		"priority":       models.PriorityHigh,
+		"assigned_to_id": assignee,
 	})
 	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
@@ -220,7 +396,31 @@ func TestUpdateTicket_NotFound(t *testing.T) {
 	ticketService = mockService
 
 	id := uuid.New()
-	mockService.On("UpdateTicket", id, "Updated", "Updated", models.StatusInProgress, models.PriorityHigh, "assignee@example.com").Return((*models.Ticket)(nil), fmt.Errorf("not found"))
+	mockService.On("GetTicket", testOrgID, id).Return((*models.Ticket)(nil), fmt.Errorf("not found"))
+
+	r := setupRouter()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":          "Updated",
+		"description":    "Updated",
+		"status":         models.StatusInProgress,
+		"priority":       models.PriorityHigh,
+		"assigned_to_id": uuid.New(),
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Ticket not found")
+}
+
+func TestUpdateTicket_Forbidden(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: idPtr(uuid.New())}, nil)
 
 	r := setupRouter()
 	reqBody, _ := json.Marshal(map[string]interface{}{
@@ -228,15 +428,14 @@ func TestUpdateTicket_NotFound(t *testing.T) {
 		"description": "Updated",
 		"status":      models.StatusInProgress,
 		"priority":    models.PriorityHigh,
-		"assigned_to": "assignee@example.com",
 	})
 	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Contains(t, w.Body.String(), "not found")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertNotCalled(t, "UpdateTicket", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestUpdateTicket_InvalidID(t *testing.T) {
@@ -245,11 +444,11 @@ func TestUpdateTicket_InvalidID(t *testing.T) {
 
 	r := setupRouter()
 	reqBody, _ := json.Marshal(map[string]interface{}{
-		"title":       "Updated",
-		"description": "Updated",
-		"status":      models.StatusInProgress,
-		"priority":    models.PriorityHigh,
-		"assigned_to": "assignee@example.com",
+		"title":          "Updated",
+		"description":    "Updated",
+		"status":         models.StatusInProgress,
+		"priority":       models.PriorityHigh,
+		"assigned_to_id": uuid.New(),
 	})
 	req := httptest.NewRequest("PUT", "/api/v1/tickets/invalid-uuid", bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
@@ -265,7 +464,8 @@ func TestDeleteTicket(t *testing.T) {
 	ticketService = mockService
 
 	id := uuid.New()
-	mockService.On("DeleteTicket", id).Return(nil)
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: &testUser.ID}, nil)
+	mockService.On("DeleteTicket", testOrgID, id).Return(nil)
 
 	r := setupRouter()
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
@@ -281,15 +481,56 @@ func TestDeleteTicket_NotFound(t *testing.T) {
 	ticketService = mockService
 
 	id := uuid.New()
-	mockService.On("DeleteTicket", id).Return(fmt.Errorf("not found"))
+	mockService.On("GetTicket", testOrgID, id).Return((*models.Ticket)(nil), fmt.Errorf("not found"))
 
 	r := setupRouter()
 	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Contains(t, w.Body.String(), "not found")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Ticket not found")
+}
+
+func TestDeleteTicket_Forbidden(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: idPtr(uuid.New()), AssignedToID: &testUser.ID}, nil)
+
+	r := setupRouter()
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertNotCalled(t, "DeleteTicket", mock.Anything, id)
+}
+
+func TestDeleteTicket_Admin(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: idPtr(uuid.New())}, nil)
+	mockService.On("DeleteTicket", testOrgID, id).Return(nil)
+
+	r := setupRouterAs(&models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin})
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/tickets/%s", id.String()), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTicketRoutes_RequireAuth(t *testing.T) {
+	r := setupRouterAs(nil)
+	req := httptest.NewRequest("GET", "/api/v1/tickets/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
 func TestDeleteTicket_InvalidID(t *testing.T) {
@@ -304,3 +545,503 @@ func TestDeleteTicket_InvalidID(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "Invalid ticket ID")
 }
+
+func TestUpdateTicket_AssignRequiresPermission(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: &testUser.ID}, nil)
+
+	r := setupRouter()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":          "Updated",
+		"description":    "Updated",
+		"status":         models.StatusOpen,
+		"priority":       models.PriorityHigh,
+		"assigned_to_id": uuid.New(),
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowed to assign")
+}
+
+func TestCreateTicket_ViewerForbidden(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	r := setupRouterAs(&models.User{ID: uuid.New(), Email: "viewer@example.com", Role: models.RoleViewer})
+	reqBody, _ := json.Marshal(map[string]string{"title": "T", "description": "D"})
+	req := httptest.NewRequest("POST", "/api/v1/tickets/", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "ticket:create")
+}
+
+func TestGetMyTickets(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	mockService.On("GetTicketsForUser", testOrgID, testUser.ID).Return([]models.Ticket{
+		{ID: uuid.New(), Title: "Mine", CreatedByID: &testUser.ID},
+		{ID: uuid.New(), Title: "Assigned", CreatedByID: idPtr(uuid.New()), AssignedToID: &testUser.ID},
+	}, nil)
+
+	r := setupRouter()
+	req := httptest.NewRequest("GET", "/api/v1/me/tickets", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []models.Ticket
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response, 2)
+	mockService.AssertExpectations(t)
+}
+
+func TestUpdateTicket_TeamRequiresAssignPermission(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID}, nil)
+
+	r := setupRouter()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":       "T",
+		"description": "D",
+		"status":      models.StatusOpen,
+		"priority":    models.PriorityMedium,
+		"team_id":     uuid.New(),
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertNotCalled(t, "UpdateTicket", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateTicket_UnknownTeam(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	teamID := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: idPtr(uuid.New())}, nil)
+	mockService.On("UpdateTicket", testOrgID, id, "T", "D", models.StatusOpen, models.PriorityMedium, (*uuid.UUID)(nil), &teamID).Return((*models.Ticket)(nil), service.ErrTeamNotFound)
+
+	r := setupRouterAs(&models.User{ID: uuid.New(), Email: "agent@example.com", Role: models.RoleAgent})
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":       "T",
+		"description": "D",
+		"status":      models.StatusOpen,
+		"priority":    models.PriorityMedium,
+		"team_id":     teamID,
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Team not found")
+}
+
+func TestUpdateTicket_InvalidAssignee(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	assignee := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: idPtr(uuid.New())}, nil)
+	mockService.On("UpdateTicket", testOrgID, id, "T", "D", models.StatusOpen, models.PriorityMedium, &assignee, (*uuid.UUID)(nil)).Return((*models.Ticket)(nil), service.ErrInvalidAssignee)
+
+	r := setupRouterAs(&models.User{ID: uuid.New(), Email: "agent@example.com", Role: models.RoleAgent})
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":          "T",
+		"description":    "D",
+		"status":         models.StatusOpen,
+		"priority":       models.PriorityMedium,
+		"assigned_to_id": assignee,
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "active user")
+}
+
+func patchRequest(id uuid.UUID, contentType, body string) *http.Request {
+	req := httptest.NewRequest("PATCH", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestPatchTicket_MergePatch(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	assignee := uuid.New()
+	existing := &models.Ticket{
+		ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID,
+		Status: models.StatusOpen, Priority: models.PriorityLow, AssignedToID: &assignee,
+	}
+	patched := &models.Ticket{
+		ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID,
+		Status: models.StatusInProgress, Priority: models.PriorityLow,
+	}
+	mockService.On("GetTicket", testOrgID, id).Return(existing, nil)
+	mockService.On("PatchTicket", testOrgID, id, mock.MatchedBy(func(patch service.TicketPatch) bool {
+		return len(patch.Fields) == 2 && patch.Has(models.TicketFieldStatus) && patch.Has(models.TicketFieldAssignedTo) &&
+			patch.Status == models.StatusInProgress && patch.AssignedTo == nil
+	})).Return(patched, nil)
+
+	r := setupRouterAs(&models.User{ID: uuid.New(), Email: "agent@example.com", Role: models.RoleAgent})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/merge-patch+json", `{"status": "in_progress", "assigned_to_id": null}`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.Ticket
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.StatusInProgress, response.Status)
+	mockService.AssertExpectations(t)
+}
+
+func TestPatchTicket_JSONPatch(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	existing := &models.Ticket{
+		ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID,
+		Status: models.StatusOpen, Priority: models.PriorityLow,
+	}
+	mockService.On("GetTicket", testOrgID, id).Return(existing, nil)
+	mockService.On("PatchTicket", testOrgID, id, service.TicketPatch{
+		Fields:   []models.TicketField{models.TicketFieldPriority},
+		Priority: models.PriorityHigh,
+	}).Return(existing, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/json-patch+json",
+		`[{"op": "test", "path": "/priority", "value": "low"}, {"op": "replace", "path": "/priority", "value": "high"}]`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestPatchTicket_Errors(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"unsupported content type", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"malformed merge patch", "application/merge-patch+json", `[1]`, http.StatusBadRequest},
+		{"read-only field", "application/merge-patch+json", `{"created_by_id": null}`, http.StatusUnprocessableEntity},
+		{"wrong type", "application/merge-patch+json", `{"title": 3}`, http.StatusUnprocessableEntity},
+		{"null title", "application/merge-patch+json", `{"title": null}`, http.StatusUnprocessableEntity},
+		{"unknown operation", "application/json-patch+json", `[{"op": "swap", "path": "/title"}]`, http.StatusBadRequest},
+		{"failed test", "application/json-patch+json", `[{"op": "test", "path": "/status", "value": "closed"}]`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockTicketService)
+			ticketService = mockService
+			mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{
+				ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID, Status: models.StatusOpen,
+			}, nil)
+
+			r := setupRouter()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, patchRequest(id, tt.contentType, tt.body))
+
+			assert.Equal(t, tt.code, w.Code)
+			mockService.AssertNotCalled(t, "PatchTicket", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestPatchTicket_UnsupportedContentTypeListsFormats(t *testing.T) {
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(uuid.New(), "application/xml", `<ticket/>`))
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Contains(t, w.Header().Get("Accept-Patch"), "application/json-patch+json")
+}
+
+func TestPatchTicket_Forbidden(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: idPtr(uuid.New())}, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/merge-patch+json", `{"title": "Updated"}`))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertNotCalled(t, "PatchTicket", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatchTicket_AssignRequiresPermission(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID}, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/merge-patch+json", fmt.Sprintf(`{"assigned_to_id": %q}`, uuid.New())))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowed to assign")
+}
+
+func TestPatchTicket_InvalidValue(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID}, nil)
+	mockService.On("PatchTicket", testOrgID, id, mock.Anything).Return((*models.Ticket)(nil), fmt.Errorf("%w: invalid status", service.ErrInvalidTicketPatch))
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/json", `{"status": "archived"}`))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid status")
+}
+
+func TestPatchTicket_Empty(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID}, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, patchRequest(id, "application/merge-patch+json", `{}`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertNotCalled(t, "PatchTicket", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func transitionRequest(id uuid.UUID, body map[string]interface{}) *http.Request {
+	reqBody, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/v1/tickets/%s/transitions", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestTransitionTicket(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: &testUser.ID, Status: models.StatusClosed}, nil)
+	mockService.On("TransitionTicket", testOrgID, id, models.StatusOpen, "Still broken").
+		Return(&models.Ticket{ID: id, Status: models.StatusOpen, StatusReason: "Still broken"}, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, transitionRequest(id, map[string]interface{}{"status": "open", "reason": "Still broken"}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.Ticket
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.StatusOpen, response.Status)
+	assert.Equal(t, "Still broken", response.StatusReason)
+	mockService.AssertExpectations(t)
+}
+
+func TestTransitionTicket_Refused(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"not allowed", fmt.Errorf("%w: a ticket cannot go from closed to resolved", service.ErrTransitionNotAllowed), http.StatusConflict},
+		{"requirements not met", fmt.Errorf("%w: the ticket needs an assignee", service.ErrTransitionRejected), http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockTicketService)
+			ticketService = mockService
+
+			id := uuid.New()
+			mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: &testUser.ID, Status: models.StatusClosed}, nil)
+			mockService.On("TransitionTicket", testOrgID, id, models.StatusResolved, "").Return((*models.Ticket)(nil), tt.err)
+
+			r := setupRouter()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, transitionRequest(id, map[string]interface{}{"status": "resolved"}))
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.Contains(t, w.Body.String(), tt.err.Error())
+		})
+	}
+}
+
+func TestTransitionTicket_Forbidden(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, CreatedByID: idPtr(uuid.New()), Status: models.StatusOpen}, nil)
+
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, transitionRequest(id, map[string]interface{}{"status": "in_progress"}))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertNotCalled(t, "TransitionTicket", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestTransitionTicket_MissingStatus(t *testing.T) {
+	r := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, transitionRequest(uuid.New(), map[string]interface{}{"reason": "No status"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetTicketTransitions(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	team := uuid.New()
+	workflow := &models.Workflow{
+		ID:   uuid.New(),
+		Name: "Support",
+		Statuses: []models.WorkflowStatus{
+			{Key: "triage", Name: "Triage", Category: models.CategoryTodo},
+			{Key: "waiting_on_customer", Name: "Waiting on customer", Category: models.CategoryInProgress},
+			{Key: "done", Name: "Done", Category: models.CategoryDone},
+		},
+		Transitions: []models.TicketTransition{
+			{From: "triage", To: "waiting_on_customer"},
+			{From: "triage", To: "done", RequiresReason: true},
+			{From: "waiting_on_customer", To: "done"},
+		},
+	}
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Status: "triage", TeamID: &team}, nil)
+	mockService.On("GetWorkflow", testOrgID, &team).Return(workflow, nil)
+
+	r := setupRouter()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/tickets/%s/transitions", id.String()), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Status      models.Status             `json:"status"`
+		Workflow    models.Workflow           `json:"workflow"`
+		Transitions []models.TicketTransition `json:"transitions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.Status("triage"), response.Status)
+	assert.Equal(t, workflow.ID, response.Workflow.ID)
+	assert.Equal(t, workflow.Transitions[:2], response.Transitions)
+}
+
+func TestUpdateTicket_TransitionNotAllowed(t *testing.T) {
+	mockService := new(MockTicketService)
+	ticketService = mockService
+
+	id := uuid.New()
+	mockService.On("GetTicket", testOrgID, id).Return(&models.Ticket{ID: id, Title: "T", Description: "D", CreatedByID: &testUser.ID, Status: models.StatusClosed}, nil)
+	mockService.On("UpdateTicket", testOrgID, id, "T", "D", models.StatusInProgress, models.PriorityLow, (*uuid.UUID)(nil), (*uuid.UUID)(nil)).
+		Return((*models.Ticket)(nil), fmt.Errorf("%w: a ticket cannot go from closed to in_progress", service.ErrTransitionNotAllowed))
+
+	r := setupRouter()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"title":       "T",
+		"description": "D",
+		"status":      models.StatusInProgress,
+		"priority":    models.PriorityLow,
+	})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/tickets/%s", id.String()), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot go from closed")
+}
+
+// setupLoginRouter serves the login route on a router trusting the proxies,
+// locking an IP after two failures
+func setupLoginRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.RolePermission{}, &models.LoginThrottle{}))
+
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	throttleService := service.NewLoginThrottleService(db, service.LoginThrottleConfig{
+		AccountFreeAttempts: 10,
+		IPFreeAttempts:      2,
+		BaseDelay:           time.Minute,
+		MaxDelay:            time.Minute,
+		ResetAfter:          time.Hour,
+	})
+	auth := middleware.NewAuthMiddleware(userService, sessionService, service.NewRBACService(db), service.NewAPIKeyService(db), service.NewOrganizationService(db), service.NewAuditService(db), middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+
+	r, err := newRouter(trustedProxies)
+	require.NoError(t, err)
+	routes.NewAuthRoutes(userService, service.NewLocalAuthenticator(userService), sessionService, throttleService, auth).Register(r)
+	return r
+}
+
+// failLogins sends a wrong password for a new account per attempt, each with
+// another X-Forwarded-For, and returns the status of the last attempt
+func failLogins(r *gin.Engine, attempts int) int {
+	var code int
+	for i := 0; i < attempts; i++ {
+		body, _ := json.Marshal(map[string]string{"email": fmt.Sprintf("user%d@example.com", i), "password": "wrong"})
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		code = w.Code
+	}
+	return code
+}
+
+func TestRouter_ForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	// A forged X-Forwarded-For does not give every attempt a fresh IP
+	r := setupLoginRouter(t, trustedProxies())
+	assert.Equal(t, http.StatusTooManyRequests, failLogins(r, 4))
+
+	// Behind a trusted proxy the forwarded client IPs are counted apart
+	r = setupLoginRouter(t, []string{"192.0.2.1"})
+	assert.Equal(t, http.StatusUnauthorized, failLogins(r, 4))
+
+	_, err := newRouter([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
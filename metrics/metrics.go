@@ -44,6 +44,23 @@ var (
 		[]string{"status"},
 	)
 
+	// Authentication metrics
+	LoginFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_failures_total",
+			Help: "Total number of failed login attempts",
+		},
+		[]string{"reason"},
+	)
+
+	LoginLockedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_locked_total",
+			Help: "Total number of login attempts rejected because of a lockout",
+		},
+		[]string{"scope"},
+	)
+
 	// Error metrics
 	ErrorTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
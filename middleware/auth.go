@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"fix-ticket-system/models"
 	"fix-ticket-system/service"
@@ -12,16 +15,88 @@ import (
 	"github.com/google/uuid"
 )
 
+// AccessTokenTTL is how long an access token issued by GenerateToken stays valid
+const AccessTokenTTL = 15 * time.Minute
+
+// ImpersonationTTL is how long an impersonation token stays valid. It cannot be refreshed.
+const ImpersonationTTL = 10 * time.Minute
+
+// ImpersonatedByHeader labels every response to a request made while impersonating
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// OrganizationHeader lets super admins act in an organization other than their own
+const OrganizationHeader = "X-Organization-ID"
+
 type AuthMiddleware struct {
-	userService *service.UserService
-	jwtSecret   []byte
+	userService         *service.UserService
+	sessionService      *service.SessionService
+	rbacService         *service.RBACService
+	apiKeyService       *service.APIKeyService
+	organizationService *service.OrganizationService
+	auditService        *service.AuditService
+	keyRing             *KeyRing
 }
 
-func NewAuthMiddleware(userService *service.UserService, jwtSecret string) *AuthMiddleware {
+func NewAuthMiddleware(userService *service.UserService, sessionService *service.SessionService, rbacService *service.RBACService, apiKeyService *service.APIKeyService, organizationService *service.OrganizationService, auditService *service.AuditService, keyRing *KeyRing) *AuthMiddleware {
 	return &AuthMiddleware{
-		userService: userService,
-		jwtSecret:   []byte(jwtSecret),
+		userService:         userService,
+		sessionService:      sessionService,
+		rbacService:         rbacService,
+		apiKeyService:       apiKeyService,
+		organizationService: organizationService,
+		auditService:        auditService,
+		keyRing:             keyRing,
+	}
+}
+
+// JWKS returns the public keys used to verify access tokens
+func (m *AuthMiddleware) JWKS() map[string]interface{} {
+	return m.keyRing.JWKS()
+}
+
+// GenerateToken issues an access token for the given user, bound to a session
+// and the user's organization, signed with the active key of the key ring
+func (m *AuthMiddleware) GenerateToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":     user.ID.String(),
+		"user_id": user.ID.String(),
+		"sid":     sessionID.String(),
+		"org":     user.OrganizationID.String(),
+		"role":    string(user.Role),
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL).Unix(),
+	}
+
+	signed, err := m.keyRing.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// GenerateImpersonationToken issues a short-lived access token that acts as
+// user on behalf of admin. The admin is named by the "act" claim (RFC 8693) and
+// the token is bound to the admin's session, so signing out the admin ends the
+// impersonation.
+func (m *AuthMiddleware) GenerateImpersonationToken(admin, user *models.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":     user.ID.String(),
+		"user_id": user.ID.String(),
+		"act":     map[string]interface{}{"sub": admin.ID.String()},
+		"sid":     sessionID.String(),
+		"org":     user.OrganizationID.String(),
+		"role":    string(user.Role),
+		"iat":     now.Unix(),
+		"exp":     now.Add(ImpersonationTTL).Unix(),
+	}
+
+	signed, err := m.keyRing.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
+	return signed, nil
 }
 
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
@@ -40,43 +115,317 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-			return m.jwtSecret, nil
-		})
+		var (
+			userID         uuid.UUID
+			scopes         []models.Permission
+			tokenOrg       *uuid.UUID
+			impersonatorID *uuid.UUID
+		)
+		if strings.HasPrefix(parts[1], service.APIKeyPrefix) {
+			key, err := m.apiKeyService.Authenticate(parts[1])
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				c.Abort()
+				return
+			}
+			userID = key.UserID
+			scopes = key.Scopes
+			c.Set("api_key_id", key.ID)
+		} else {
+			token, err := m.parseAccessToken(parts[1])
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			userID = token.userID
+			tokenOrg = &token.orgID
+			impersonatorID = token.impersonatorID
+			c.Set("session_id", token.session.ID)
+			c.Set("mfa_verified", token.session.MFAVerifiedAt != nil)
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		user, err := m.userService.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if !user.IsActive() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + string(user.Status)})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Tokens issued before the user moved organization are no longer valid
+		if tokenOrg != nil && *tokenOrg != user.OrganizationID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token was issued for another organization"})
 			c.Abort()
 			return
 		}
 
-		userID, err := uuid.Parse(claims["user_id"].(string))
+		var impersonator *models.User
+		if impersonatorID != nil {
+			impersonator, err = m.loadImpersonator(*impersonatorID, user)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		orgID, status, err := m.resolveOrganization(c, user)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+			c.JSON(status, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		user, err := m.userService.GetUserByID(userID)
+		permissions, err := m.rbacService.PermissionsForRole(user.Role)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
+		// API keys are limited to the scopes they were issued with
+		if scopes != nil {
+			permissions = intersectPermissions(permissions, scopes)
+		}
+
 		c.Set("user", user)
+		c.Set("organization_id", orgID)
+		c.Set("permissions", permissions)
+		if impersonator == nil {
+			c.Next()
+			return
+		}
+
+		// Requests made while impersonating are audited before they run, so
+		// no action goes unrecorded
+		c.Set("impersonator", impersonator)
+		c.Header(ImpersonatedByHeader, impersonator.ID.String())
+		event := &models.AuditEvent{
+			OrganizationID: user.OrganizationID,
+			ActorID:        impersonator.ID,
+			UserID:         user.ID,
+			Action:         models.AuditActionImpersonationRequest,
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+		}
+		if err := m.auditService.Record(event); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+		// The request already ran, a missing status is the lesser evil
+		_ = m.auditService.SetStatus(event.ID, c.Writer.Status())
+	}
+}
+
+// loadImpersonator returns the admin behind an impersonation token, who must
+// still be allowed to impersonate the user
+func (m *AuthMiddleware) loadImpersonator(id uuid.UUID, user *models.User) (*models.User, error) {
+	admin, err := m.userService.GetUserByID(id)
+	if err != nil || !admin.IsActive() || !CanImpersonate(admin, user) {
+		return nil, errors.New("Impersonation is no longer allowed")
+	}
+	return admin, nil
+}
+
+// CanImpersonate reports whether admin may act as user: admins within their
+// organization, super admins anywhere. Only super admins may act as super admins.
+func CanImpersonate(admin, user *models.User) bool {
+	if admin.ID == user.ID {
+		return false
+	}
+	if user.SuperAdmin && !admin.SuperAdmin {
+		return false
+	}
+	return admin.SuperAdmin || (admin.Role == models.RoleAdmin && admin.OrganizationID == user.OrganizationID)
+}
+
+// resolveOrganization returns the organization the request acts in: the
+// user's own, or for super admins the one named by OrganizationHeader. On
+// failure it also returns the HTTP status to answer with.
+func (m *AuthMiddleware) resolveOrganization(c *gin.Context, user *models.User) (uuid.UUID, int, error) {
+	header := c.GetHeader(OrganizationHeader)
+	if header == "" {
+		return user.OrganizationID, 0, nil
+	}
+
+	orgID, err := uuid.Parse(header)
+	if err != nil {
+		return uuid.Nil, http.StatusBadRequest, errors.New("Invalid organization ID")
+	}
+	if orgID == user.OrganizationID {
+		return orgID, 0, nil
+	}
+	if !user.SuperAdmin {
+		return uuid.Nil, http.StatusForbidden, errors.New("Access to organization denied")
+	}
+	if _, err := m.organizationService.GetOrganization(orgID); err != nil {
+		if errors.Is(err, service.ErrOrganizationNotFound) {
+			return uuid.Nil, http.StatusNotFound, errors.New("Organization not found")
+		}
+		return uuid.Nil, http.StatusInternalServerError, err
+	}
+	return orgID, 0, nil
+}
+
+// accessToken is the verified content of an access token
+type accessToken struct {
+	session *models.Session
+	userID  uuid.UUID
+	orgID   uuid.UUID
+	// impersonatorID is set on impersonation tokens, whose session belongs to the impersonator
+	impersonatorID *uuid.UUID
+}
+
+// parseAccessToken validates a JWT access token and returns the user, session
+// and organization it is bound to
+func (m *AuthMiddleware) parseAccessToken(raw string) (*accessToken, error) {
+	token, err := m.keyRing.Parse(raw)
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("Invalid token claims")
+	}
+
+	rawID, _ := claims["user_id"].(string)
+	userID, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, errors.New("Invalid user ID in token")
+	}
+
+	rawSessionID, _ := claims["sid"].(string)
+	sessionID, err := uuid.Parse(rawSessionID)
+	if err != nil {
+		return nil, errors.New("Invalid session ID in token")
+	}
+
+	rawOrgID, _ := claims["org"].(string)
+	orgID, err := uuid.Parse(rawOrgID)
+	if err != nil {
+		return nil, errors.New("Invalid organization ID in token")
+	}
+
+	result := &accessToken{userID: userID, orgID: orgID}
+	sessionOwner := userID
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		rawActorID, _ := act["sub"].(string)
+		actorID, err := uuid.Parse(rawActorID)
+		if err != nil {
+			return nil, errors.New("Invalid actor ID in token")
+		}
+		result.impersonatorID = &actorID
+		sessionOwner = actorID
+	}
+
+	session, err := m.sessionService.GetSession(sessionID)
+	if err != nil || session.UserID != sessionOwner || !session.IsActive() {
+		return nil, errors.New("Session has been revoked")
+	}
+	result.session = session
+
+	return result, nil
+}
+
+func intersectPermissions(granted, scopes []models.Permission) []models.Permission {
+	result := make([]models.Permission, 0, len(scopes))
+	for _, p := range granted {
+		for _, scope := range scopes {
+			if p == scope {
+				result = append(result, p)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// CurrentUser returns the authenticated user stored in the context by RequireAuth
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		return nil, false
+	}
+	u, ok := user.(*models.User)
+	return u, ok
+}
+
+// Impersonator returns the admin acting as the current user, stored in the
+// context by RequireAuth for requests made with an impersonation token
+func Impersonator(c *gin.Context) (*models.User, bool) {
+	value, exists := c.Get("impersonator")
+	if !exists {
+		return nil, false
+	}
+	u, ok := value.(*models.User)
+	return u, ok
+}
+
+// APIKeyID returns the API key the request was authenticated with, stored in
+// the context by RequireAuth
+func APIKeyID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("api_key_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := value.(uuid.UUID)
+	return id, ok
+}
+
+// DenyImpersonation rejects requests made while impersonating. It guards
+// changes to a user's credentials, which would outlive the impersonation.
+// It must run after RequireAuth.
+func (m *AuthMiddleware) DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := Impersonator(c); impersonating {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
+// CurrentOrganization returns the organization the request acts in, stored in
+// the context by RequireAuth
+func CurrentOrganization(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("organization_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := value.(uuid.UUID)
+	return id, ok
+}
+
+// RequireAdmin only lets through users whose role grants user:manage in the
+// organization the request acts in, and super admins. Which roles administer an
+// organization is thus decided by the role permissions alone, and never locks
+// super admins out. Users who enabled two-factor authentication must also have
+// verified a code in the current session, and API keys must carry the
+// user:manage scope.
 func (m *AuthMiddleware) RequireAdmin() gin.HandlerFunc {
+	return m.requireElevated(func(c *gin.Context, u *models.User) bool {
+		return u.SuperAdmin || HasPermission(c, models.PermissionUserManage)
+	}, "Admin access required")
+}
+
+// RequireSuperAdmin only lets through super admins, with the same two-factor
+// requirement as RequireAdmin
+func (m *AuthMiddleware) RequireSuperAdmin() gin.HandlerFunc {
+	return m.requireElevated(func(_ *gin.Context, u *models.User) bool {
+		return u.SuperAdmin
+	}, "Super admin access required")
+}
+
+func (m *AuthMiddleware) requireElevated(allowed func(*gin.Context, *models.User) bool, denied string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := c.Get("user")
 		if !exists {
@@ -86,8 +435,42 @@ func (m *AuthMiddleware) RequireAdmin() gin.HandlerFunc {
 		}
 
 		u, ok := user.(*models.User)
-		if !ok || u.Role != models.RoleAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		if !ok || !allowed(c, u) {
+			c.JSON(http.StatusForbidden, gin.H{"error": denied})
+			c.Abort()
+			return
+		}
+
+		// An API key only acts as an admin when it was granted the scope to
+		// manage users, not merely because its owner is one
+		if _, viaKey := APIKeyID(c); viaKey && !HasPermission(c, models.PermissionUserManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks scope " + string(models.PermissionUserManage)})
+			c.Abort()
+			return
+		}
+
+		if u.TOTPEnabled && !c.GetBool("mfa_verified") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor verification required", "code": "mfa_required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through users whose role grants the permission.
+// It must run after RequireAuth.
+func (m *AuthMiddleware) RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission " + string(permission)})
 			c.Abort()
 			return
 		}
@@ -95,3 +478,21 @@ func (m *AuthMiddleware) RequireAdmin() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// HasPermission reports whether the permissions loaded by RequireAuth include permission
+func HasPermission(c *gin.Context, permission models.Permission) bool {
+	value, exists := c.Get("permissions")
+	if !exists {
+		return false
+	}
+	permissions, ok := value.([]models.Permission)
+	if !ok {
+		return false
+	}
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultKeyID is used for the HMAC key derived from JWT_SECRET. Tokens without
+// a kid header, issued before key rotation existed, are checked against it.
+const DefaultKeyID = "default"
+
+// SigningKey is one key of a KeyRing
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is the key used for signing: []byte for HMAC, *rsa.PrivateKey or ed25519.PrivateKey
+	Private interface{}
+	// Public is the key used for verification: []byte for HMAC, *rsa.PublicKey or ed25519.PublicKey
+	Public interface{}
+}
+
+// NewHMACKey returns an HS256 key for the shared secret
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key, picking RS256 or EdDSA
+func NewSigningKey(id string, private interface{}) (*SigningKey, error) {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for key %q", private, id)
+	}
+}
+
+// KeyRing signs access tokens with its active key and verifies tokens signed by
+// any of its keys, so the active key can be rotated without invalidating tokens
+// that are still in flight.
+type KeyRing struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeyRing returns a ring that signs with active and also accepts the other keys
+func NewKeyRing(active *SigningKey, others ...*SigningKey) *KeyRing {
+	ring := &KeyRing{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, k := range others {
+		ring.keys[k.ID] = k
+	}
+	return ring
+}
+
+// LoadKeyRing reads every "<kid>.pem" private key in dir and signs with activeID,
+// which may be omitted when there is a single key. When secret is set it is added
+// as the HMAC key DefaultKeyID, which lets tokens issued with JWT_SECRET keep
+// working during a migration to asymmetric keys.
+func LoadKeyRing(dir, activeID string, secret []byte) (*KeyRing, error) {
+	var keys []*SigningKey
+	if secret != nil {
+		keys = append(keys, NewHMACKey(DefaultKeyID, secret))
+	}
+
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			id := strings.TrimSuffix(filepath.Base(path), ".pem")
+			key, err := loadPEMKey(id, path)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("an active key ID is required when several keys are configured")
+		}
+		activeID = keys[0].ID
+	}
+
+	var active *SigningKey
+	var others []*SigningKey
+	for _, k := range keys {
+		if k.ID == activeID {
+			active = k
+		} else {
+			others = append(others, k)
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+
+	return NewKeyRing(active, others...), nil
+}
+
+func loadPEMKey(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %q: %w", id, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q is not PEM encoded", id)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return nil, fmt.Errorf("failed to parse key %q: %w", id, err)
+		}
+		private = rsaKey
+	}
+	return NewSigningKey(id, private)
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.Private)
+}
+
+// Parse verifies a token against the ring. Only the algorithms of the ring's
+// keys are accepted, and each key only with its own algorithm.
+func (r *KeyRing) Parse(raw string) (*jwt.Token, error) {
+	return jwt.Parse(raw, r.keyfunc, jwt.WithValidMethods(r.methods()), jwt.WithExpirationRequired())
+}
+
+func (r *KeyRing) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+func (r *KeyRing) methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, k := range r.keys {
+		if !seen[k.Method.Alg()] {
+			seen[k.Method.Alg()] = true
+			methods = append(methods, k.Method.Alg())
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// JWKS returns the public keys of the ring as a JSON Web Key Set.
+// HMAC keys are secret and never published.
+func (r *KeyRing) JWKS() map[string]interface{} {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := []map[string]string{}
+	for _, id := range ids {
+		k := r.keys[id]
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": k.ID,
+				"use": "sig",
+				"alg": k.Method.Alg(),
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": k.ID,
+				"use": "sig",
+				"alg": k.Method.Alg(),
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func newRSAKey(t *testing.T, id string) *SigningKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key
+}
+
+func newEd25519Key(t *testing.T, id string) *SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key
+}
+
+func TestKeyRing_SignAndParse(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *SigningKey
+		alg  string
+	}{
+		{name: "HS256", key: NewHMACKey(DefaultKeyID, []byte("secret")), alg: "HS256"},
+		{name: "RS256", key: newRSAKey(t, "rsa-1"), alg: "RS256"},
+		{name: "EdDSA", key: newEd25519Key(t, "ed-1"), alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := NewKeyRing(tt.key)
+			signed, err := ring.Sign(testClaims())
+			require.NoError(t, err)
+
+			token, err := ring.Parse(signed)
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, token.Method.Alg())
+			assert.Equal(t, tt.key.ID, token.Header["kid"])
+		})
+	}
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	oldKey := newRSAKey(t, "2024")
+	newKey := newEd25519Key(t, "2025")
+
+	oldToken, err := NewKeyRing(oldKey).Sign(testClaims())
+	require.NoError(t, err)
+
+	// After rotation new tokens use the new key, and old tokens still verify
+	ring := NewKeyRing(newKey, oldKey)
+	newToken, err := ring.Sign(testClaims())
+	require.NoError(t, err)
+
+	_, err = ring.Parse(oldToken)
+	assert.NoError(t, err)
+	token, err := ring.Parse(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025", token.Header["kid"])
+
+	// Once the old key is removed its tokens are rejected
+	_, err = NewKeyRing(newKey).Parse(oldToken)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ring := NewKeyRing(rsaKey)
+
+	// An HS256 token "signed" with the public key must not verify
+	pubDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "rsa-1"
+	signed, err := forged.SignedString(pubDER)
+	require.NoError(t, err)
+	_, err = ring.Parse(signed)
+	assert.Error(t, err)
+
+	// Unsigned tokens are rejected
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	signed, err = none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = ring.Parse(signed)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_JWKS(t *testing.T) {
+	ring := NewKeyRing(newRSAKey(t, "rsa-1"), newEd25519Key(t, "ed-1"), NewHMACKey(DefaultKeyID, []byte("secret")))
+
+	keys := ring.JWKS()["keys"].([]map[string]string)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "ed-1", keys[0]["kid"])
+	assert.Equal(t, "OKP", keys[0]["kty"])
+	assert.Equal(t, "rsa-1", keys[1]["kid"])
+	assert.Equal(t, "RS256", keys[1]["alg"])
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"2024", "2025"} {
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id+".pem"), data, 0600))
+	}
+
+	ring, err := LoadKeyRing(dir, "2025", []byte("legacy-secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "2025", ring.active.ID)
+	assert.Len(t, ring.keys, 3)
+
+	_, err = LoadKeyRing(dir, "", nil)
+	assert.Error(t, err)
+	_, err = LoadKeyRing(dir, "missing", nil)
+	assert.Error(t, err)
+	_, err = LoadKeyRing("", "", nil)
+	assert.Error(t, err)
+}
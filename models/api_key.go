@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey is a long-lived, scoped credential for scripts and integrations
+type APIKey struct {
+	ID         uuid.UUID    `json:"id" gorm:"type:uuid;primary_key"`
+	UserID     uuid.UUID    `json:"user_id" gorm:"type:uuid;index;not null"`
+	Name       string       `json:"name" gorm:"not null"`
+	Prefix     string       `json:"prefix" gorm:"not null"` // first characters of the key, shown to help identify it
+	KeyHash    string       `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     []Permission `json:"scopes" gorm:"serializer:json;type:text;not null"`
+	ExpiresAt  *time.Time   `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	RevokedAt  *time.Time   `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	AuditActionImpersonationStart   AuditAction = "impersonation.start"
+	AuditActionImpersonationRequest AuditAction = "impersonation.request"
+)
+
+// AuditEvent records an action an admin took on behalf of a user. Events are
+// kept when either user is purged.
+type AuditEvent struct {
+	ID             uuid.UUID   `json:"id" gorm:"type:uuid;primary_key"`
+	OrganizationID uuid.UUID   `json:"organization_id" gorm:"type:uuid;index;not null"`
+	ActorID        uuid.UUID   `json:"actor_id" gorm:"type:uuid;index;not null"` // the admin
+	UserID         uuid.UUID   `json:"user_id" gorm:"type:uuid;index;not null"`  // the user acted as
+	Action         AuditAction `json:"action" gorm:"type:varchar(50);not null"`
+	Method         string      `json:"method"`
+	Path           string      `json:"path"`
+	Status         int         `json:"status"` // response status, 0 until the request completed
+	CreatedAt      time.Time   `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks recent failed logins for one account or client IP, or
+// wrong two-factor codes of one user
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"column:throttle_key;primaryKey"` // "account:<email>", "ip:<address>" or "2fa:<user ID>"
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// IsLocked reports whether logins for the key are currently blocked
+func (t *LoginThrottle) IsLocked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
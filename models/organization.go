@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultOrganizationName is the organization that existing data is moved into
+// and that users signing in through single sign-on join unless configured otherwise
+const DefaultOrganizationName = "Default"
+
+// Organization is a tenant. Users, tickets and teams belong to exactly one
+// organization and are never visible to another.
+type Organization struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	Name      string    `json:"name" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
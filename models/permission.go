@@ -0,0 +1,48 @@
+package models
+
+// Permission is a single capability that can be granted to a role
+type Permission string
+
+const (
+	PermissionTicketRead   Permission = "ticket:read"
+	PermissionTicketCreate Permission = "ticket:create"
+	PermissionTicketUpdate Permission = "ticket:update"
+	PermissionTicketAssign Permission = "ticket:assign"
+	PermissionTicketDelete Permission = "ticket:delete"
+	PermissionUserManage   Permission = "user:manage"
+)
+
+// AllPermissions lists every permission known to the system
+var AllPermissions = []Permission{
+	PermissionTicketRead,
+	PermissionTicketCreate,
+	PermissionTicketUpdate,
+	PermissionTicketAssign,
+	PermissionTicketDelete,
+	PermissionUserManage,
+}
+
+// IsValid reports whether the permission is known to the system
+func (p Permission) IsValid() bool {
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermission grants a permission to every user with the given role
+type RolePermission struct {
+	Role       Role       `json:"role" gorm:"type:varchar(20);primaryKey"`
+	Permission Permission `json:"permission" gorm:"type:varchar(50);primaryKey"`
+}
+
+// DefaultRolePermissions is the mapping seeded into an empty database
+var DefaultRolePermissions = map[Role][]Permission{
+	RoleAdmin:     AllPermissions,
+	RoleAgent:     {PermissionTicketRead, PermissionTicketCreate, PermissionTicketUpdate, PermissionTicketAssign},
+	RoleRequester: {PermissionTicketRead, PermissionTicketCreate},
+	RoleViewer:    {PermissionTicketRead},
+	RoleUser:      {PermissionTicketRead, PermissionTicketCreate},
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session represents a refresh token issued to a user at login
+type Session struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID           uuid.UUID  `json:"user_id" gorm:"type:uuid;index;not null"`
+	RefreshTokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	MFAVerifiedAt    *time.Time `json:"mfa_verified_at"` // set once a second factor was presented in this session
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// SupersededRefreshToken is a refresh token rotated out of a session. Every
+// token a session ever had is kept, so presenting any of them again revokes
+// the session.
+type SupersededRefreshToken struct {
+	TokenHash string    `gorm:"primaryKey"`
+	SessionID uuid.UUID `gorm:"type:uuid;index;not null"`
+	CreatedAt time.Time
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
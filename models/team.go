@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Team is a group of users that works a shared ticket queue
+type Team struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;uniqueIndex:idx_teams_organization_name"`
+	Name           string     `json:"name" gorm:"uniqueIndex:idx_teams_organization_name;not null"`
+	Description    string     `json:"description"`
+	Members        []User     `json:"members,omitempty" gorm:"many2many:team_members"`
+	WorkflowID     *uuid.UUID `json:"workflow_id" gorm:"type:uuid;index"` // nil follows the organization's default workflow
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
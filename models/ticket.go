@@ -16,6 +16,27 @@ const (
 	StatusClosed     Status = "closed"
 )
 
+// AllStatuses lists the statuses of DefaultWorkflow
+var AllStatuses = []Status{StatusOpen, StatusInProgress, StatusResolved, StatusClosed}
+
+// MaxStatusLength is the longest status key a workflow may define
+const MaxStatusLength = 20
+
+// IsValid reports whether the status is a well-formed status key: lower case
+// letters, digits and underscores, starting with a letter. Which statuses a
+// ticket can be in depends on its workflow.
+func (s Status) IsValid() bool {
+	if len(s) == 0 || len(s) > MaxStatusLength || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
 // Priority represents the priority level of a ticket
 type Priority string
 
@@ -25,30 +46,110 @@ const (
 	PriorityHigh   Priority = "high"
 )
 
+// AllPriorities lists every priority from the least to the most severe
+var AllPriorities = []Priority{PriorityLow, PriorityMedium, PriorityHigh}
+
+// IsValid reports whether the priority is known to the system
+func (p Priority) IsValid() bool {
+	return p.Severity() > 0
+}
+
+// Severity ranks the priority, 1 being the least severe; unknown priorities rank 0
+func (p Priority) Severity() int {
+	for i, known := range AllPriorities {
+		if p == known {
+			return i + 1
+		}
+	}
+	return 0
+}
+
 // Ticket represents a support ticket in the system
 type Ticket struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
-	Title       string    `json:"title" gorm:"not null"`
-	Description string    `json:"description" gorm:"not null"`
-	Status      Status    `json:"status" gorm:"type:varchar(20);not null;default:'open'"`
-	Priority    Priority  `json:"priority" gorm:"type:varchar(20);not null;default:'medium'"`
-	CreatedBy   string    `json:"created_by" gorm:"not null"`
-	AssignedTo  string    `json:"assigned_to"`
-	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"not null"`
+	ID                uuid.UUID    `json:"id" gorm:"type:uuid;primary_key"`
+	OrganizationID    uuid.UUID    `json:"organization_id" gorm:"type:uuid;index;index:idx_tickets_org_created;index:idx_tickets_org_updated"`
+	Title             string       `json:"title" gorm:"not null"`
+	Description       string       `json:"description" gorm:"not null"`
+	Status            Status       `json:"status" gorm:"type:varchar(20);not null;default:'open'"`
+	StatusReason      string       `json:"status_reason"` // why the ticket last changed status, if given
+	Priority          Priority     `json:"priority" gorm:"type:varchar(20);not null;default:'medium'"`
+	CreatedByID       *uuid.UUID   `json:"-" gorm:"type:uuid;index"` // nil once the reporter has been purged
+	CreatedBy         *UserSummary `json:"created_by" gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL"`
+	AssignedToID      *uuid.UUID   `json:"-" gorm:"type:uuid;index"`
+	AssignedTo        *UserSummary `json:"assigned_to" gorm:"foreignKey:AssignedToID;constraint:OnDelete:SET NULL"`
+	TeamID            *uuid.UUID   `json:"team_id" gorm:"type:uuid;index"`
+	NeedsReassignment bool         `json:"needs_reassignment" gorm:"not null;default:false"` // set when the assignee was deactivated
+	CreatedAt         time.Time    `json:"created_at" gorm:"not null;index:idx_tickets_org_created"`
+	UpdatedAt         time.Time    `json:"updated_at" gorm:"not null;index:idx_tickets_org_updated"`
+}
+
+// TicketField names a field of a ticket that can be changed, as it appears in
+// requests
+type TicketField string
+
+const (
+	TicketFieldTitle       TicketField = "title"
+	TicketFieldDescription TicketField = "description"
+	TicketFieldStatus      TicketField = "status"
+	TicketFieldPriority    TicketField = "priority"
+	TicketFieldAssignedTo  TicketField = "assigned_to_id"
+	TicketFieldTeam        TicketField = "team_id"
+)
+
+// EditableTicketFields lists every field of a ticket that can be changed
+var EditableTicketFields = []TicketField{
+	TicketFieldTitle, TicketFieldDescription, TicketFieldStatus, TicketFieldPriority, TicketFieldAssignedTo, TicketFieldTeam,
+}
+
+// IsEditable reports whether the field can be changed
+func (f TicketField) IsEditable() bool {
+	for _, known := range EditableTicketFields {
+		if f == known {
+			return true
+		}
+	}
+	return false
 }
 
 // NewTicket creates a new ticket with default values
-func NewTicket(title, description, createdBy string) *Ticket {
+func NewTicket(organizationID uuid.UUID, title, description string, createdBy uuid.UUID) *Ticket {
 	now := time.Now()
 	return &Ticket{
-		ID:          uuid.New(),
-		Title:       title,
-		Description: description,
-		Status:      StatusOpen,
-		Priority:    PriorityMedium,
-		CreatedBy:   createdBy,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:             uuid.New(),
+		OrganizationID: organizationID,
+		Title:          title,
+		Description:    description,
+		Status:         StatusOpen,
+		Priority:       PriorityMedium,
+		CreatedByID:    &createdBy,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// IsReportedBy reports whether the user opened the ticket
+func (t *Ticket) IsReportedBy(user *User) bool {
+	return user != nil && t.CreatedByID != nil && *t.CreatedByID == user.ID
+}
+
+// IsAssignedTo reports whether the ticket is assigned to the user
+func (t *Ticket) IsAssignedTo(user *User) bool {
+	return user != nil && t.AssignedToID != nil && *t.AssignedToID == user.ID
+}
+
+// AssigneeChanged reports whether assigning the user would change the assignee
+func (t *Ticket) AssigneeChanged(assignedTo *uuid.UUID) bool {
+	return !sameID(t.AssignedToID, assignedTo)
+}
+
+// TeamChanged reports whether assigning the team would change the team queue
+func (t *Ticket) TeamChanged(teamID *uuid.UUID) bool {
+	return !sameID(t.TeamID, teamID)
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
 	}
+	return *a == *b
 }
@@ -11,42 +11,43 @@ func TestNewTicket(t *testing.T) {
 		name        string
 		title       string
 		description string
-		createdBy   string
+		createdBy   uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid ticket",
 			title:       "Test Ticket",
 			description: "Test Description",
-			createdBy:   "test@example.com",
+			createdBy:   uuid.New(),
 			wantErr:     false,
 		},
 		{
 			name:        "Empty title",
 			title:       "",
 			description: "Test Description",
-			createdBy:   "test@example.com",
+			createdBy:   uuid.New(),
 			wantErr:     false, // NewTicket doesn't validate empty title
 		},
 		{
 			name:        "Empty description",
 			title:       "Test Ticket",
 			description: "",
-			createdBy:   "test@example.com",
+			createdBy:   uuid.New(),
 			wantErr:     false, // NewTicket doesn't validate empty description
 		},
 		{
 			name:        "Empty createdBy",
 			title:       "Test Ticket",
 			description: "Test Description",
-			createdBy:   "",
+			createdBy:   uuid.Nil,
 			wantErr:     false, // NewTicket doesn't validate empty createdBy
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ticket := NewTicket(tt.title, tt.description, tt.createdBy)
+			orgID := uuid.New()
+			ticket := NewTicket(orgID, tt.title, tt.description, tt.createdBy)
 
 			if ticket == nil {
 				t.Error("NewTicket() returned nil")
@@ -59,8 +60,11 @@ func TestNewTicket(t *testing.T) {
 			if ticket.Description != tt.description {
 				t.Errorf("NewTicket() description = %v, want %v", ticket.Description, tt.description)
 			}
-			if ticket.CreatedBy != tt.createdBy {
-				t.Errorf("NewTicket() createdBy = %v, want %v", ticket.CreatedBy, tt.createdBy)
+			if ticket.OrganizationID != orgID {
+				t.Errorf("NewTicket() organization = %v, want %v", ticket.OrganizationID, orgID)
+			}
+			if ticket.CreatedByID == nil || *ticket.CreatedByID != tt.createdBy {
+				t.Errorf("NewTicket() createdBy = %v, want %v", ticket.CreatedByID, tt.createdBy)
 			}
 			if ticket.Status != StatusOpen {
 				t.Errorf("NewTicket() status = %v, want %v", ticket.Status, StatusOpen)
@@ -80,3 +84,112 @@ func TestNewTicket(t *testing.T) {
 		})
 	}
 }
+
+func TestTicketOwnership(t *testing.T) {
+	reporter := &User{ID: uuid.New(), Email: "reporter@example.com"}
+	assignee := &User{ID: uuid.New(), Email: "assignee@example.com"}
+	other := &User{ID: uuid.New(), Email: "other@example.com"}
+
+	ticket := NewTicket(uuid.New(), "Title", "Description", reporter.ID)
+	ticket.AssignedToID = &assignee.ID
+
+	tests := []struct {
+		name         string
+		user         *User
+		wantReporter bool
+		wantAssignee bool
+	}{
+		{name: "Reporter", user: reporter, wantReporter: true, wantAssignee: false},
+		{name: "Assignee", user: assignee, wantReporter: false, wantAssignee: true},
+		{name: "Other user", user: other, wantReporter: false, wantAssignee: false},
+		{name: "No user", user: nil, wantReporter: false, wantAssignee: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ticket.IsReportedBy(tt.user); got != tt.wantReporter {
+				t.Errorf("IsReportedBy() = %v, want %v", got, tt.wantReporter)
+			}
+			if got := ticket.IsAssignedTo(tt.user); got != tt.wantAssignee {
+				t.Errorf("IsAssignedTo() = %v, want %v", got, tt.wantAssignee)
+			}
+		})
+	}
+}
+
+func TestTicketAssignmentChanges(t *testing.T) {
+	assignee := uuid.New()
+	other := uuid.New()
+	ticket := NewTicket(uuid.New(), "Title", "Description", uuid.New())
+
+	if ticket.AssigneeChanged(nil) {
+		t.Error("AssigneeChanged(nil) on unassigned ticket = true, want false")
+	}
+	if !ticket.AssigneeChanged(&assignee) {
+		t.Error("AssigneeChanged() on unassigned ticket = false, want true")
+	}
+
+	ticket.AssignedToID = &assignee
+	same := assignee
+	if ticket.AssigneeChanged(&same) {
+		t.Error("AssigneeChanged() with same user = true, want false")
+	}
+	if !ticket.AssigneeChanged(&other) {
+		t.Error("AssigneeChanged() with other user = false, want true")
+	}
+	if !ticket.AssigneeChanged(nil) {
+		t.Error("AssigneeChanged(nil) on assigned ticket = false, want true")
+	}
+
+	if ticket.TeamChanged(nil) {
+		t.Error("TeamChanged(nil) without team = true, want false")
+	}
+}
+
+func TestDefaultWorkflow(t *testing.T) {
+	workflow := DefaultWorkflow
+	if workflow.InitialStatus() != StatusOpen {
+		t.Errorf("new tickets start in %s, want open", workflow.InitialStatus())
+	}
+	for _, transition := range workflow.Transitions {
+		if !workflow.HasStatus(transition.From) || !workflow.HasStatus(transition.To) || transition.From == transition.To {
+			t.Errorf("invalid transition %s -> %s", transition.From, transition.To)
+		}
+	}
+	for _, status := range AllStatuses {
+		if len(workflow.TransitionsFrom(status)) == 0 {
+			t.Errorf("no transition leaves %s", status)
+		}
+	}
+
+	if _, ok := workflow.FindTransition(StatusClosed, StatusResolved); ok {
+		t.Error("closed tickets must not be resolved")
+	}
+	if transition, ok := workflow.FindTransition(StatusInProgress, StatusResolved); !ok || !transition.RequiresAssignee {
+		t.Error("resolving must require an assignee")
+	}
+	if transition, ok := workflow.FindTransition(StatusClosed, StatusOpen); !ok || !transition.RequiresReason {
+		t.Error("reopening must require a reason")
+	}
+
+	// Tickets in a status of another workflow may only enter at the initial status
+	if got := workflow.TransitionsFrom("triage"); len(got) != 1 || got[0].To != StatusOpen {
+		t.Errorf("got transitions %v from an unknown status, want only to open", got)
+	}
+}
+
+func TestStatus_IsValid(t *testing.T) {
+	for status, want := range map[Status]bool{
+		"open":                  true,
+		"waiting_on_customer":   true,
+		"in_review2":            true,
+		"":                      false,
+		"2nd_line":              false,
+		"In Review":             false,
+		"waiting_on_customer_x": false,
+	} {
+		if got := status.IsValid(); got != want {
+			t.Errorf("Status(%q).IsValid() = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -4,37 +4,77 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Role string
 
 const (
-	RoleAdmin Role = "admin"
-	RoleUser  Role = "user"
+	RoleAdmin     Role = "admin"
+	RoleAgent     Role = "agent"
+	RoleRequester Role = "requester"
+	RoleViewer    Role = "viewer"
+	RoleUser      Role = "user"
+)
+
+// AllRoles lists every role known to the system
+var AllRoles = []Role{RoleAdmin, RoleAgent, RoleRequester, RoleViewer, RoleUser}
+
+// IsValid reports whether the role is known to the system
+func (r Role) IsValid() bool {
+	for _, known := range AllRoles {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// UserStatus is the lifecycle state of a user account
+type UserStatus string
+
+const (
+	UserStatusActive      UserStatus = "active"
+	UserStatusSuspended   UserStatus = "suspended"   // temporarily blocked, keeps assigned tickets
+	UserStatusDeactivated UserStatus = "deactivated" // left the organization, purged after a grace period
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"not null"` // "-" means this field won't be included in JSON
-	Role      Role      `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	OrganizationID    uuid.UUID  `json:"organization_id" gorm:"type:uuid;index"`
+	Email             string     `json:"email" gorm:"uniqueIndex;not null"`
+	Password          string     `json:"-" gorm:"not null"`                                    // "-" means this field won't be included in JSON
+	Role              Role       `json:"role" gorm:"type:varchar(20);not null;default:'user'"` // admins manage their own organization
+	SuperAdmin        bool       `json:"super_admin" gorm:"not null;default:false"`            // manages organizations and may act in any of them
+	ServiceAccount    bool       `json:"service_account" gorm:"not null;default:false"`        // service accounts only authenticate with API keys
+	Status            UserStatus `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+	DeactivatedAt     *time.Time `json:"deactivated_at"`
+	TOTPEnabled       bool       `json:"totp_enabled" gorm:"not null;default:false"`
+	TOTPSecret        string     `json:"-"`                                                // base32 secret, set on enrollment
+	TOTPLastStep      int64      `json:"-"`                                                // last accepted time step, prevents code reuse
+	TOTPRecoveryCodes []string   `json:"-" gorm:"serializer:json"`                         // SHA-256 hashes of unused recovery codes
+	ExternalIssuer    *string    `json:"-" gorm:"uniqueIndex:idx_users_external_identity"` // OIDC issuer or LDAP server the user signs in with
+	ExternalSubject   *string    `json:"-" gorm:"uniqueIndex:idx_users_external_identity"` // the user's stable ID at ExternalIssuer
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
-// HashPassword hashes the user's password
-func (u *User) HashPassword() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-	u.Password = string(hashedPassword)
-	return nil
+// UserSummary is the public view of a user embedded in other resources
+type UserSummary struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (UserSummary) TableName() string {
+	return "users"
+}
+
+// IsActive reports whether the user may sign in and use the API
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
 }
 
-// CheckPassword checks if the provided password matches the hashed password
-func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+// HasLocalPassword reports whether the user signs in with a password stored
+// here. Users managed by an identity provider, directory or SCIM have none.
+func (u *User) HasLocalPassword() bool {
+	return u.Password != ""
 }
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StatusCategory groups the statuses of different workflows by how far work
+// on a ticket has come
+type StatusCategory string
+
+const (
+	CategoryTodo       StatusCategory = "todo"
+	CategoryInProgress StatusCategory = "in_progress"
+	CategoryDone       StatusCategory = "done"
+)
+
+// AllStatusCategories lists every status category in the order work goes through them
+var AllStatusCategories = []StatusCategory{CategoryTodo, CategoryInProgress, CategoryDone}
+
+// IsValid reports whether the category is known to the system
+func (c StatusCategory) IsValid() bool {
+	for _, known := range AllStatusCategories {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkflowStatus is a status tickets of a workflow can be in
+type WorkflowStatus struct {
+	Key      Status         `json:"key"`
+	Name     string         `json:"name"`
+	Category StatusCategory `json:"category"`
+}
+
+// TicketTransition is an allowed move of a ticket from one status to another
+type TicketTransition struct {
+	From Status `json:"from"`
+	To   Status `json:"to"`
+	// RequiresAssignee only allows the move for tickets with an assignee
+	RequiresAssignee bool `json:"requires_assignee"`
+	// RequiresReason only allows the move with a reason, kept on the ticket
+	RequiresReason bool `json:"requires_reason"`
+}
+
+// Workflow is the lifecycle of the tickets of the teams using it: the statuses
+// they can be in and the allowed moves between them. New tickets start in the
+// first status. Tickets without a team, or whose team has no workflow, follow
+// the organization's default workflow, or DefaultWorkflow if it has none.
+type Workflow struct {
+	ID             uuid.UUID          `json:"id" gorm:"type:uuid;primary_key"`
+	OrganizationID uuid.UUID          `json:"organization_id" gorm:"type:uuid;uniqueIndex:idx_workflows_organization_name"`
+	Name           string             `json:"name" gorm:"uniqueIndex:idx_workflows_organization_name;not null"`
+	Description    string             `json:"description"`
+	Statuses       []WorkflowStatus   `json:"statuses" gorm:"serializer:json;type:text;not null"`
+	Transitions    []TicketTransition `json:"transitions" gorm:"serializer:json;type:text;not null"`
+	IsDefault      bool               `json:"is_default" gorm:"not null;default:false"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// DefaultWorkflow is followed by organizations without a workflow of their
+// own. Work is resolved by its assignee and closed once resolved; closing
+// unresolved tickets and reopening resolved or closed ones must be explained.
+var DefaultWorkflow = Workflow{
+	Name: "Default",
+	Statuses: []WorkflowStatus{
+		{Key: StatusOpen, Name: "Open", Category: CategoryTodo},
+		{Key: StatusInProgress, Name: "In progress", Category: CategoryInProgress},
+		{Key: StatusResolved, Name: "Resolved", Category: CategoryDone},
+		{Key: StatusClosed, Name: "Closed", Category: CategoryDone},
+	},
+	Transitions: []TicketTransition{
+		{From: StatusOpen, To: StatusInProgress},
+		{From: StatusOpen, To: StatusResolved, RequiresAssignee: true},
+		{From: StatusOpen, To: StatusClosed, RequiresReason: true},
+		{From: StatusInProgress, To: StatusOpen},
+		{From: StatusInProgress, To: StatusResolved, RequiresAssignee: true},
+		{From: StatusInProgress, To: StatusClosed, RequiresReason: true},
+		{From: StatusResolved, To: StatusClosed},
+		{From: StatusResolved, To: StatusOpen, RequiresReason: true},
+		{From: StatusResolved, To: StatusInProgress, RequiresReason: true},
+		{From: StatusClosed, To: StatusOpen, RequiresReason: true},
+	},
+}
+
+// InitialStatus is the status new tickets start in
+func (w *Workflow) InitialStatus() Status {
+	if len(w.Statuses) == 0 {
+		return StatusOpen
+	}
+	return w.Statuses[0].Key
+}
+
+// HasStatus reports whether tickets of the workflow can be in the status
+func (w *Workflow) HasStatus(status Status) bool {
+	for _, known := range w.Statuses {
+		if known.Key == status {
+			return true
+		}
+	}
+	return false
+}
+
+// FindTransition returns the transition between the statuses, if allowed
+func (w *Workflow) FindTransition(from, to Status) (TicketTransition, bool) {
+	for _, transition := range w.Transitions {
+		if transition.From == from && transition.To == to {
+			return transition, true
+		}
+	}
+	return TicketTransition{}, false
+}
+
+// TransitionsFrom lists the transitions allowed from the status. Tickets in a
+// status the workflow does not have, e.g. after their workflow was edited, may
+// only enter it at its initial status.
+func (w *Workflow) TransitionsFrom(status Status) []TicketTransition {
+	transitions := []TicketTransition{}
+	if !w.HasStatus(status) {
+		return append(transitions, TicketTransition{From: status, To: w.InitialStatus()})
+	}
+	for _, transition := range w.Transitions {
+		if transition.From == status {
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTicketPageSize = 50
+	MaxTicketPageSize     = 200
+)
+
+// Fields tickets can be sorted by
+const (
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortPriority  = "priority"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TicketQuery filters, sorts and pages the tickets of an organization. Empty
+// filters match every ticket.
+type TicketQuery struct {
+	Statuses   []models.Status
+	Priorities []models.Priority
+	AssigneeID *uuid.UUID
+	// Unassigned only matches tickets without assignee
+	Unassigned bool
+	ReporterID *uuid.UUID
+	// Ranges include their start and exclude their end
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// Sort is one of the Sort* fields, created_at if empty. Priorities are
+	// ordered by severity.
+	Sort       string
+	Descending bool
+	// Limit is the page size, DefaultTicketPageSize if zero and at most
+	// MaxTicketPageSize
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+// TicketPage is one page of tickets
+type TicketPage struct {
+	Tickets []models.Ticket
+	// Total counts the tickets matching the filters on all pages
+	Total int64
+	// NextCursor continues after this page; empty on the last page
+	NextCursor string
+}
+
+// ticketCursor identifies the last ticket of a page by its sort key. The sort
+// is part of the cursor so a cursor is never applied to a different order.
+type ticketCursor struct {
+	Sort       string     `json:"s"`
+	Descending bool       `json:"d,omitempty"`
+	Time       *time.Time `json:"t,omitempty"`
+	Severity   int        `json:"p,omitempty"`
+	ID         uuid.UUID  `json:"id"`
+}
+
+// IsTicketSort reports whether tickets can be sorted by the field
+func IsTicketSort(field string) bool {
+	return field == SortCreatedAt || field == SortUpdatedAt || field == SortPriority
+}
+
+// List returns one page of the tickets matching the query. Pages are keyset
+// paginated, so tickets created while paging neither shift nor repeat
+// results.
+func (r *TicketRepository) List(orgID uuid.UUID, query TicketQuery) (*TicketPage, error) {
+	if query.Sort == "" {
+		query.Sort = SortCreatedAt
+	}
+	if !IsTicketSort(query.Sort) {
+		return nil, fmt.Errorf("cannot sort tickets by %q", query.Sort)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultTicketPageSize
+	}
+	limit = min(limit, MaxTicketPageSize)
+
+	page := &TicketPage{}
+	if err := r.db.Model(&models.Ticket{}).Where("tickets.organization_id = ?", orgID).
+		Scopes(query.filter).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	column := sortColumn(query.Sort)
+	direction, after := "ASC", ">"
+	if query.Descending {
+		direction, after = "DESC", "<"
+	}
+
+	find := r.tenant(orgID).Scopes(query.filter)
+	if query.Cursor != "" {
+		cursor, err := decodeTicketCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != query.Sort || cursor.Descending != query.Descending {
+			return nil, fmt.Errorf("%w: the cursor belongs to a different sort order", ErrInvalidCursor)
+		}
+		value := cursor.sortValue()
+		find = find.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND tickets.id %s ?))", column, after, column, after), value, value, cursor.ID)
+	}
+
+	var tickets []models.Ticket
+	if err := find.Order(column + " " + direction).Order("tickets.id " + direction).
+		Limit(limit + 1).Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+
+	if len(tickets) > limit {
+		tickets = tickets[:limit]
+		last := tickets[limit-1]
+		cursor := ticketCursor{Sort: query.Sort, Descending: query.Descending, ID: last.ID}
+		switch query.Sort {
+		case SortCreatedAt:
+			cursor.Time = &last.CreatedAt
+		case SortUpdatedAt:
+			cursor.Time = &last.UpdatedAt
+		case SortPriority:
+			cursor.Severity = last.Priority.Severity()
+		}
+		page.NextCursor = cursor.encode()
+	}
+	page.Tickets = tickets
+	return page, nil
+}
+
+func (q TicketQuery) filter(db *gorm.DB) *gorm.DB {
+	if len(q.Statuses) > 0 {
+		db = db.Where("tickets.status IN ?", q.Statuses)
+	}
+	if len(q.Priorities) > 0 {
+		db = db.Where("tickets.priority IN ?", q.Priorities)
+	}
+	if q.Unassigned {
+		db = db.Where("tickets.assigned_to_id IS NULL")
+	}
+	if q.AssigneeID != nil {
+		db = db.Where("tickets.assigned_to_id = ?", *q.AssigneeID)
+	}
+	if q.ReporterID != nil {
+		db = db.Where("tickets.created_by_id = ?", *q.ReporterID)
+	}
+	if q.CreatedAfter != nil {
+		db = db.Where("tickets.created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		db = db.Where("tickets.created_at < ?", *q.CreatedBefore)
+	}
+	if q.UpdatedAfter != nil {
+		db = db.Where("tickets.updated_at >= ?", *q.UpdatedAfter)
+	}
+	if q.UpdatedBefore != nil {
+		db = db.Where("tickets.updated_at < ?", *q.UpdatedBefore)
+	}
+	return db
+}
+
+// sortColumn returns the SQL expression tickets are ordered by
+func sortColumn(sort string) string {
+	if sort != SortPriority {
+		return "tickets." + sort
+	}
+	var severity strings.Builder
+	severity.WriteString("(CASE tickets.priority")
+	for _, priority := range models.AllPriorities {
+		fmt.Fprintf(&severity, " WHEN '%s' THEN %d", priority, priority.Severity())
+	}
+	severity.WriteString(" ELSE 0 END)")
+	return severity.String()
+}
+
+func (c ticketCursor) sortValue() interface{} {
+	if c.Sort == SortPriority {
+		return c.Severity
+	}
+	return *c.Time
+}
+
+func (c ticketCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTicketCursor(value string) (*ticketCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor ticketCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != SortPriority && cursor.Time == nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
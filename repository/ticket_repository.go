@@ -1,13 +1,22 @@
 package repository
 
 import (
+	"errors"
+
 	"fix-ticket-system/config"
 	"fix-ticket-system/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrStatusChanged is returned when a ticket changed status while it was
+// being updated
+var ErrStatusChanged = errors.New("ticket status was changed concurrently")
+
+// TicketRepository stores tickets. Every query is scoped to one organization;
+// tickets of other organizations behave as if they did not exist.
 type TicketRepository struct {
 	db *gorm.DB
 }
@@ -18,29 +27,132 @@ func NewTicketRepository() *TicketRepository {
 	}
 }
 
+// tenant scopes a query to the tickets of the organization and loads the
+// reporter and assignee summaries embedded in responses
+func (r *TicketRepository) tenant(orgID uuid.UUID) *gorm.DB {
+	return r.db.Preload("CreatedBy").Preload("AssignedTo").Where("tickets.organization_id = ?", orgID)
+}
+
+// Create stores the ticket in its organization. Embedded user summaries are
+// never written back.
 func (r *TicketRepository) Create(ticket *models.Ticket) error {
-	return r.db.Create(ticket).Error
+	return r.db.Omit(clause.Associations).Create(ticket).Error
 }
 
-func (r *TicketRepository) GetByID(id uuid.UUID) (*models.Ticket, error) {
+func (r *TicketRepository) GetByID(orgID, id uuid.UUID) (*models.Ticket, error) {
 	var ticket models.Ticket
-	err := r.db.First(&ticket, "id = ?", id).Error
+	err := r.tenant(orgID).First(&ticket, "tickets.id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &ticket, nil
 }
 
-func (r *TicketRepository) GetAll() ([]models.Ticket, error) {
+// GetByParticipant returns the tickets created by or assigned to the user
+func (r *TicketRepository) GetByParticipant(orgID, userID uuid.UUID) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	err := r.tenant(orgID).Where("created_by_id = ? OR assigned_to_id = ?", userID, userID).Find(&tickets).Error
+	return tickets, err
+}
+
+// GetByTeam returns the tickets in the queue of the team
+func (r *TicketRepository) GetByTeam(orgID, teamID uuid.UUID) ([]models.Ticket, error) {
 	var tickets []models.Ticket
-	err := r.db.Find(&tickets).Error
+	err := r.tenant(orgID).Where("team_id = ?", teamID).Find(&tickets).Error
 	return tickets, err
 }
 
+// Workflow returns the workflow followed by the tickets of the team, or by
+// tickets without team if teamID is nil: the team's workflow, else the
+// organization's default workflow, else models.DefaultWorkflow
+func (r *TicketRepository) Workflow(orgID uuid.UUID, teamID *uuid.UUID) (*models.Workflow, error) {
+	var workflows []models.Workflow
+	if teamID != nil {
+		err := r.db.Where("organization_id = ? AND id = (?)", orgID,
+			r.db.Model(&models.Team{}).Select("workflow_id").Where("id = ? AND organization_id = ?", *teamID, orgID)).
+			Limit(1).Find(&workflows).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(workflows) > 0 {
+			return &workflows[0], nil
+		}
+	}
+
+	if err := r.db.Where("organization_id = ? AND is_default = ?", orgID, true).Limit(1).Find(&workflows).Error; err != nil {
+		return nil, err
+	}
+	if len(workflows) > 0 {
+		return &workflows[0], nil
+	}
+	workflow := models.DefaultWorkflow
+	return &workflow, nil
+}
+
+// TeamExists reports whether tickets of the organization can be assigned to the team
+func (r *TicketRepository) TeamExists(orgID, teamID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Team{}).Where("id = ? AND organization_id = ?", teamID, orgID).Count(&count).Error
+	return count > 0, err
+}
+
+// ActiveUserExists reports whether tickets of the organization can be assigned to the user
+func (r *TicketRepository) ActiveUserExists(orgID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).
+		Where("id = ? AND organization_id = ? AND status = ?", userID, orgID, models.UserStatusActive).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Update stores the ticket, which must still belong to its organization.
+// Embedded user summaries are never written back.
 func (r *TicketRepository) Update(ticket *models.Ticket) error {
-	return r.db.Save(ticket).Error
+	result := r.db.Model(ticket).Omit(clause.Associations).
+		Where("organization_id = ?", ticket.OrganizationID).
+		Select("*").Updates(ticket)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateFields stores only the given columns of the ticket, so concurrent
+// changes to other columns are kept
+func (r *TicketRepository) UpdateFields(ticket *models.Ticket, columns []string) error {
+	result := r.db.Model(ticket).Omit(clause.Associations).
+		Where("organization_id = ?", ticket.OrganizationID).
+		Select(columns).Updates(ticket)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateFieldsInStatus is UpdateFields for a ticket that must still be in the
+// status, failing with ErrStatusChanged if its status was changed meanwhile
+func (r *TicketRepository) UpdateFieldsInStatus(ticket *models.Ticket, columns []string, status models.Status) error {
+	result := r.db.Model(ticket).Omit(clause.Associations).
+		Where("organization_id = ? AND status = ?", ticket.OrganizationID, status).
+		Select(columns).Updates(ticket)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.GetByID(ticket.OrganizationID, ticket.ID); err != nil {
+			return err
+		}
+		return ErrStatusChanged
+	}
+	return nil
 }
 
-func (r *TicketRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&models.Ticket{}, "id = ?", id).Error
+func (r *TicketRepository) Delete(orgID, id uuid.UUID) error {
+	return r.db.Where("organization_id = ?", orgID).Delete(&models.Ticket{}, "id = ?", id).Error
 }
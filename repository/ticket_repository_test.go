@@ -4,6 +4,7 @@ import (
 	"fix-ticket-system/config"
 	"fix-ticket-system/models"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -11,23 +12,32 @@ import (
 	"gorm.io/gorm"
 )
 
+var testOrgID = uuid.New()
+
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
 	// Migrate the schema
-	err = db.AutoMigrate(&models.Ticket{})
+	err = db.AutoMigrate(&models.User{}, &models.Ticket{}, &models.Team{}, &models.Workflow{})
 	assert.NoError(t, err)
 
 	return db
 }
 
+func createTestUser(t *testing.T, db *gorm.DB, email string, status models.UserStatus) *models.User {
+	user := &models.User{ID: uuid.New(), OrganizationID: testOrgID, Email: email, Password: "x", Role: models.RoleUser, Status: status}
+	assert.NoError(t, db.Create(user).Error)
+	return user
+}
+
 func TestTicketRepository_Create(t *testing.T) {
 	db := setupTestDB(t)
 	config.DB = db
 	repo := NewTicketRepository()
 
-	ticket := models.NewTicket("Test Ticket", "Test Description", "test@example.com")
+	user := createTestUser(t, db, "test@example.com", models.UserStatusActive)
+	ticket := models.NewTicket(testOrgID, "Test Ticket", "Test Description", user.ID)
 
 	err := repo.Create(ticket)
 	assert.NoError(t, err)
@@ -38,7 +48,7 @@ func TestTicketRepository_Create(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, ticket.Title, found.Title)
 	assert.Equal(t, ticket.Description, found.Description)
-	assert.Equal(t, ticket.CreatedBy, found.CreatedBy)
+	assert.Equal(t, user.ID, *found.CreatedByID)
 }
 
 func TestTicketRepository_GetByID(t *testing.T) {
@@ -47,51 +57,204 @@ func TestTicketRepository_GetByID(t *testing.T) {
 	repo := NewTicketRepository()
 
 	// Create a test ticket
-	ticket := models.NewTicket("Test Ticket", "Test Description", "test@example.com")
-	err := db.Create(ticket).Error
+	reporter := createTestUser(t, db, "reporter@example.com", models.UserStatusActive)
+	assignee := createTestUser(t, db, "assignee@example.com", models.UserStatusActive)
+	ticket := models.NewTicket(testOrgID, "Test Ticket", "Test Description", reporter.ID)
+	ticket.AssignedToID = &assignee.ID
+	err := repo.Create(ticket)
 	assert.NoError(t, err)
 
 	// Test getting existing ticket
-	found, err := repo.GetByID(ticket.ID)
+	found, err := repo.GetByID(testOrgID, ticket.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, ticket.ID, found.ID)
 	assert.Equal(t, ticket.Title, found.Title)
+	if assert.NotNil(t, found.CreatedBy) && assert.NotNil(t, found.AssignedTo) {
+		assert.Equal(t, "reporter@example.com", found.CreatedBy.Email)
+		assert.Equal(t, "assignee@example.com", found.AssignedTo.Email)
+	}
 
 	// Test getting non-existent ticket
 	nonExistentID := uuid.New()
-	_, err = repo.GetByID(nonExistentID)
+	_, err = repo.GetByID(testOrgID, nonExistentID)
 	assert.Error(t, err)
 }
 
-func TestTicketRepository_GetAll(t *testing.T) {
+func TestTicketRepository_List(t *testing.T) {
+	db := setupTestDB(t)
+	config.DB = db
+	repo := NewTicketRepository()
+
+	reporter := createTestUser(t, db, "reporter@example.com", models.UserStatusActive)
+	assignee := createTestUser(t, db, "assignee@example.com", models.UserStatusActive)
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	create := func(title string, priority models.Priority, status models.Status, age time.Duration) *models.Ticket {
+		ticket := models.NewTicket(testOrgID, title, "Description", reporter.ID)
+		ticket.Priority, ticket.Status = priority, status
+		ticket.CreatedAt, ticket.UpdatedAt = base.Add(-age), base.Add(-age)
+		assert.NoError(t, repo.Create(ticket))
+		return ticket
+	}
+	low := create("Low", models.PriorityLow, models.StatusOpen, 3*time.Hour)
+	high := create("High", models.PriorityHigh, models.StatusOpen, 2*time.Hour)
+	medium := create("Medium", models.PriorityMedium, models.StatusClosed, time.Hour)
+	medium.AssignedToID = &assignee.ID
+	assert.NoError(t, repo.Update(medium))
+	assert.NoError(t, db.Create(models.NewTicket(uuid.New(), "Elsewhere", "Description", reporter.ID)).Error)
+
+	page, err := repo.List(testOrgID, TicketQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, []uuid.UUID{low.ID, high.ID, medium.ID}, ticketIDs(page.Tickets))
+	assert.Empty(t, page.NextCursor)
+
+	// Priorities are ordered by severity, not alphabetically
+	page, err = repo.List(testOrgID, TicketQuery{Sort: SortPriority, Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{high.ID, medium.ID, low.ID}, ticketIDs(page.Tickets))
+
+	page, err = repo.List(testOrgID, TicketQuery{Statuses: []models.Status{models.StatusOpen}, Priorities: []models.Priority{models.PriorityHigh, models.PriorityLow}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	page, err = repo.List(testOrgID, TicketQuery{AssigneeID: &assignee.ID, ReporterID: &reporter.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{medium.ID}, ticketIDs(page.Tickets))
+	page, err = repo.List(testOrgID, TicketQuery{Unassigned: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+
+	after, before := base.Add(-2*time.Hour), base.Add(-time.Hour)
+	page, err = repo.List(testOrgID, TicketQuery{CreatedAfter: &after, CreatedBefore: &before})
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{high.ID}, ticketIDs(page.Tickets))
+	page, err = repo.List(testOrgID, TicketQuery{UpdatedAfter: &before})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, page.Tickets)
+}
+
+func TestTicketRepository_ListPages(t *testing.T) {
 	db := setupTestDB(t)
 	config.DB = db
 	repo := NewTicketRepository()
 
-	// Create test tickets
-	tickets := []*models.Ticket{
-		models.NewTicket("Ticket 1", "Description 1", "test1@example.com"),
-		models.NewTicket("Ticket 2", "Description 2", "test2@example.com"),
+	// Equal sort keys are paged by ID
+	for i := 0; i < 5; i++ {
+		ticket := models.NewTicket(testOrgID, "Ticket", "Description", uuid.New())
+		ticket.Priority = models.AllPriorities[i%len(models.AllPriorities)]
+		assert.NoError(t, repo.Create(ticket))
 	}
 
+	for _, sort := range []string{SortCreatedAt, SortUpdatedAt, SortPriority} {
+		for _, descending := range []bool{false, true} {
+			query := TicketQuery{Sort: sort, Descending: descending, Limit: 2}
+			all, err := repo.List(testOrgID, TicketQuery{Sort: sort, Descending: descending})
+			assert.NoError(t, err)
+
+			var paged []models.Ticket
+			for pages := 0; ; pages++ {
+				page, err := repo.List(testOrgID, query)
+				if !assert.NoError(t, err) || !assert.Less(t, pages, 3) {
+					return
+				}
+				assert.Equal(t, int64(5), page.Total)
+				paged = append(paged, page.Tickets...)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			assert.Equal(t, ticketIDs(all.Tickets), ticketIDs(paged), "sort %s descending %v", sort, descending)
+		}
+	}
+
+	first, err := repo.List(testOrgID, TicketQuery{Limit: 2})
+	assert.NoError(t, err)
+	_, err = repo.List(testOrgID, TicketQuery{Sort: SortPriority, Limit: 2, Cursor: first.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = repo.List(testOrgID, TicketQuery{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func ticketIDs(tickets []models.Ticket) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(tickets))
 	for _, ticket := range tickets {
-		err := db.Create(ticket).Error
-		assert.NoError(t, err)
+		ids = append(ids, ticket.ID)
 	}
+	return ids
+}
 
-	// Test getting all tickets
-	found, err := repo.GetAll()
+func TestTicketRepository_GetByParticipant(t *testing.T) {
+	db := setupTestDB(t)
+	config.DB = db
+	repo := NewTicketRepository()
+
+	me := uuid.New()
+	other := uuid.New()
+	created := models.NewTicket(testOrgID, "Created", "Description", me)
+	assigned := models.NewTicket(testOrgID, "Assigned", "Description", other)
+	assigned.AssignedToID = &me
+	unrelated := models.NewTicket(testOrgID, "Unrelated", "Description", other)
+	for _, ticket := range []*models.Ticket{created, assigned, unrelated} {
+		assert.NoError(t, db.Create(ticket).Error)
+	}
+
+	found, err := repo.GetByParticipant(testOrgID, me)
 	assert.NoError(t, err)
 	assert.Len(t, found, 2)
 }
 
+func TestTicketRepository_GetByTeam(t *testing.T) {
+	db := setupTestDB(t)
+	config.DB = db
+	repo := NewTicketRepository()
+
+	team := &models.Team{ID: uuid.New(), OrganizationID: testOrgID, Name: "Network"}
+	assert.NoError(t, db.Create(team).Error)
+	queued := models.NewTicket(testOrgID, "Queued", "Description", uuid.New())
+	queued.TeamID = &team.ID
+	other := models.NewTicket(testOrgID, "Other", "Description", uuid.New())
+	assert.NoError(t, db.Create(queued).Error)
+	assert.NoError(t, db.Create(other).Error)
+
+	found, err := repo.GetByTeam(testOrgID, team.ID)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, queued.ID, found[0].ID)
+
+	exists, err := repo.TeamExists(testOrgID, team.ID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = repo.TeamExists(testOrgID, uuid.New())
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestTicketRepository_ActiveUserExists(t *testing.T) {
+	db := setupTestDB(t)
+	config.DB = db
+	repo := NewTicketRepository()
+
+	active := createTestUser(t, db, "active@example.com", models.UserStatusActive)
+	suspended := createTestUser(t, db, "suspended@example.com", models.UserStatusSuspended)
+
+	exists, err := repo.ActiveUserExists(testOrgID, active.ID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = repo.ActiveUserExists(testOrgID, suspended.ID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = repo.ActiveUserExists(testOrgID, uuid.New())
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestTicketRepository_Update(t *testing.T) {
 	db := setupTestDB(t)
 	config.DB = db
 	repo := NewTicketRepository()
 
 	// Create a test ticket
-	ticket := models.NewTicket("Test Ticket", "Test Description", "test@example.com")
+	ticket := models.NewTicket(testOrgID, "Test Ticket", "Test Description", uuid.New())
 	err := db.Create(ticket).Error
 	assert.NoError(t, err)
 
@@ -115,12 +278,12 @@ func TestTicketRepository_Delete(t *testing.T) {
 	repo := NewTicketRepository()
 
 	// Create a test ticket
-	ticket := models.NewTicket("Test Ticket", "Test Description", "test@example.com")
+	ticket := models.NewTicket(testOrgID, "Test Ticket", "Test Description", uuid.New())
 	err := db.Create(ticket).Error
 	assert.NoError(t, err)
 
 	// Delete the ticket
-	err = repo.Delete(ticket.ID)
+	err = repo.Delete(testOrgID, ticket.ID)
 	assert.NoError(t, err)
 
 	// Verify the ticket was deleted
@@ -129,3 +292,50 @@ func TestTicketRepository_Delete(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
+
+func TestTicketRepository_TenantIsolation(t *testing.T) {
+	db := setupTestDB(t)
+	config.DB = db
+	repo := NewTicketRepository()
+
+	otherOrgID := uuid.New()
+	foreignUser := &models.User{ID: uuid.New(), OrganizationID: otherOrgID, Email: "foreign@example.com", Password: "x", Role: models.RoleUser, Status: models.UserStatusActive}
+	assert.NoError(t, db.Create(foreignUser).Error)
+	foreignTeam := &models.Team{ID: uuid.New(), OrganizationID: otherOrgID, Name: "Network"}
+	assert.NoError(t, db.Create(foreignTeam).Error)
+
+	own := models.NewTicket(testOrgID, "Own", "Description", uuid.New())
+	foreign := models.NewTicket(otherOrgID, "Foreign", "Description", foreignUser.ID)
+	assert.NoError(t, repo.Create(own))
+	assert.NoError(t, repo.Create(foreign))
+
+	all, err := repo.List(testOrgID, TicketQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), all.Total)
+	assert.Equal(t, []uuid.UUID{own.ID}, ticketIDs(all.Tickets))
+
+	_, err = repo.GetByID(testOrgID, foreign.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mine, err := repo.GetByParticipant(testOrgID, foreignUser.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, mine)
+
+	exists, err := repo.ActiveUserExists(testOrgID, foreignUser.ID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = repo.TeamExists(testOrgID, foreignTeam.ID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Deleting or updating through another organization leaves the ticket alone
+	assert.NoError(t, repo.Delete(testOrgID, foreign.ID))
+	found, err := repo.GetByID(otherOrgID, foreign.ID)
+	assert.NoError(t, err)
+
+	found.OrganizationID = testOrgID
+	found.Title = "Hijacked"
+	assert.ErrorIs(t, repo.Update(found), gorm.ErrRecordNotFound)
+	found, err = repo.GetByID(otherOrgID, foreign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Foreign", found.Title)
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTicketSearchLimit = 20
+	MaxTicketSearchLimit     = 100
+)
+
+var (
+	ErrEmptySearch        = errors.New("search query has no words")
+	ErrSearchNotSupported = errors.New("full-text search is not supported by this database")
+)
+
+// Highlighted matches are wrapped in these markers by the database, and turned
+// into <mark> tags once the rest of the text has been HTML escaped
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// TicketSearchResult is a ticket matching a search with its rank, higher
+// ranking first. Ranks only compare results of the same search.
+type TicketSearchResult struct {
+	models.Ticket
+	Rank float64 `json:"rank"`
+	// TitleHighlight is the HTML escaped title with matches in <mark> tags
+	TitleHighlight string `json:"title_highlight"`
+	// DescriptionSnippet is an HTML escaped excerpt of the description around
+	// the matches, which are in <mark> tags
+	DescriptionSnippet string `json:"description_snippet"`
+}
+
+// TicketSearch searches the title and description of tickets. Every word of
+// the query must match, in any form of the word ("printers" finds "printer").
+// Stop words are dropped from the query before it reaches a backend, as
+// Postgres would ignore them while FTS5 would require them. Backends still
+// differ in how they rank and, for a few words, in how they stem: Postgres
+// uses the Snowball stemmer, FTS5 the original Porter one.
+type TicketSearch interface {
+	// Migrate creates or updates the search index
+	Migrate() error
+	// Search returns up to limit tickets of the organization matching the words
+	Search(orgID uuid.UUID, words []string, limit int) ([]TicketSearchHit, error)
+}
+
+// TicketSearchHit is the ranked ID and highlights of a matching ticket, the
+// highlights marked but not yet escaped
+type TicketSearchHit struct {
+	ID                 uuid.UUID
+	Rank               float64
+	TitleHighlight     string
+	DescriptionSnippet string
+}
+
+// NewTicketSearch returns the search backend for the database
+func NewTicketSearch(db *gorm.DB) (TicketSearch, error) {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return &postgresTicketSearch{db: db}, nil
+	case "sqlite":
+		return &sqliteTicketSearch{db: db}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrSearchNotSupported, db.Dialector.Name())
+	}
+}
+
+// MigrateTicketSearch creates the search index of the database's tickets
+func MigrateTicketSearch(db *gorm.DB) error {
+	search, err := NewTicketSearch(db)
+	if err != nil {
+		return err
+	}
+	return search.Migrate()
+}
+
+// Search returns the tickets of the organization matching the query, best
+// match first
+func (r *TicketRepository) Search(orgID uuid.UUID, query string, limit int) ([]TicketSearchResult, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return nil, ErrEmptySearch
+	}
+	if limit <= 0 {
+		limit = DefaultTicketSearchLimit
+	}
+	limit = min(limit, MaxTicketSearchLimit)
+
+	search, err := NewTicketSearch(r.db)
+	if err != nil {
+		return nil, err
+	}
+	hits, err := search.Search(orgID, words, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return []TicketSearchResult{}, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var tickets []models.Ticket
+	if err := r.tenant(orgID).Where("tickets.id IN ?", ids).Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Ticket, len(tickets))
+	for _, ticket := range tickets {
+		byID[ticket.ID] = ticket
+	}
+
+	results := make([]TicketSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		ticket, ok := byID[hit.ID]
+		if !ok {
+			// Deleted since it was found
+			continue
+		}
+		results = append(results, TicketSearchResult{
+			Ticket:             ticket,
+			Rank:               hit.Rank,
+			TitleHighlight:     renderHighlight(hit.TitleHighlight),
+			DescriptionSnippet: renderHighlight(hit.DescriptionSnippet),
+		})
+	}
+	return results, nil
+}
+
+// searchWords splits the query into words the same way for every backend;
+// punctuation, search operators and stop words are ignored
+func searchWords(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	words := make([]string, 0, len(fields))
+	for _, word := range fields {
+		if !stopWords[word] {
+			words = append(words, word)
+		}
+	}
+	if len(words) > 32 {
+		words = words[:32]
+	}
+	return words
+}
+
+// stopWords are the words of Postgres' english dictionary that are too common
+// to be indexed
+var stopWords = func() map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.Fields(`i me my myself we our ours ourselves you your yours yourself
+		yourselves he him his himself she her hers herself it its itself they them their theirs
+		themselves what which who whom this that these those am is are was were be been being have
+		has had having do does did doing a an the and but if or because as until while of at by for
+		with about against between into through during before after above below to from up down in
+		out on off over under again further then once here there when where why how all any both
+		each few more most other some such no nor not only own same so than too very s t can will
+		just don should now`) {
+		words[word] = true
+	}
+	return words
+}()
+
+func renderHighlight(text string) string {
+	text = html.EscapeString(text)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(text)
+}
+
+// postgresTicketSearch ranks tickets with a weighted tsvector kept in a
+// generated column and indexed with GIN. Title matches weigh more than
+// description matches.
+type postgresTicketSearch struct {
+	db *gorm.DB
+}
+
+func (s *postgresTicketSearch) Migrate() error {
+	statements := []string{
+		`ALTER TABLE tickets ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(description, '')), 'B')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_tickets_search_vector ON tickets USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := s.db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate ticket search: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *postgresTicketSearch) Search(orgID uuid.UUID, words []string, limit int) ([]TicketSearchHit, error) {
+	markers := fmt.Sprintf("StartSel=%s, StopSel=%s", highlightStart, highlightStop)
+	var hits []TicketSearchHit
+	err := s.db.Raw(`SELECT tickets.id,
+			ts_rank(tickets.search_vector, query) AS rank,
+			ts_headline('english', tickets.title, query, ? || ', HighlightAll=true') AS title_highlight,
+			ts_headline('english', tickets.description, query, ? || ', MaxFragments=2, MaxWords=24, MinWords=8') AS description_snippet
+		FROM tickets, plainto_tsquery('english', ?) AS query
+		WHERE tickets.organization_id = ? AND tickets.search_vector @@ query
+		ORDER BY rank DESC, tickets.id
+		LIMIT ?`, markers, markers, strings.Join(words, " "), orgID, limit).Scan(&hits).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tickets: %w", err)
+	}
+	return hits, nil
+}
+
+// sqliteTicketSearch uses an FTS5 table indexing the tickets table, kept in
+// sync by triggers. SQLite must be built with FTS5, i.e. with the sqlite_fts5
+// build tag.
+type sqliteTicketSearch struct {
+	db *gorm.DB
+}
+
+func (s *sqliteTicketSearch) Migrate() error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS tickets_fts USING fts5(
+			title, description, content='tickets', content_rowid='rowid', tokenize='porter unicode61')`,
+		`CREATE TRIGGER IF NOT EXISTS tickets_fts_insert AFTER INSERT ON tickets BEGIN
+			INSERT INTO tickets_fts(rowid, title, description) VALUES (new.rowid, new.title, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS tickets_fts_delete AFTER DELETE ON tickets BEGIN
+			INSERT INTO tickets_fts(tickets_fts, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS tickets_fts_update AFTER UPDATE OF title, description ON tickets BEGIN
+			INSERT INTO tickets_fts(tickets_fts, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+			INSERT INTO tickets_fts(rowid, title, description) VALUES (new.rowid, new.title, new.description);
+		END`,
+		// Schema migrations may have rebuilt the tickets table, renumbering
+		// its rows and dropping the triggers, so the index is always rebuilt
+		`INSERT INTO tickets_fts(tickets_fts) VALUES ('rebuild')`,
+	}
+	for _, statement := range statements {
+		if err := s.db.Exec(statement).Error; err != nil {
+			if strings.Contains(err.Error(), "no such module: fts5") {
+				return fmt.Errorf("%w: SQLite was built without FTS5, build with -tags sqlite_fts5", ErrSearchNotSupported)
+			}
+			return fmt.Errorf("failed to migrate ticket search: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteTicketSearch) Search(orgID uuid.UUID, words []string, limit int) ([]TicketSearchHit, error) {
+	// Quoted words are matched literally, so no word is read as an operator
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"`)
+	}
+
+	var hits []TicketSearchHit
+	// bm25 ranks better matches lower; title matches weigh more
+	err := s.db.Raw(`SELECT tickets.id,
+			-bm25(tickets_fts, 4.0, 1.0) AS rank,
+			highlight(tickets_fts, 0, ?, ?) AS title_highlight,
+			snippet(tickets_fts, 1, ?, ?, '…', 24) AS description_snippet
+		FROM tickets_fts JOIN tickets ON tickets.rowid = tickets_fts.rowid
+		WHERE tickets_fts MATCH ? AND tickets.organization_id = ?
+		ORDER BY rank DESC, tickets.id
+		LIMIT ?`, highlightStart, highlightStop, highlightStart, highlightStop, strings.Join(terms, " "), orgID, limit).Scan(&hits).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: tickets_fts") {
+			return nil, fmt.Errorf("%w: the search index has not been created", ErrSearchNotSupported)
+		}
+		return nil, fmt.Errorf("failed to search tickets: %w", err)
+	}
+	return hits, nil
+}
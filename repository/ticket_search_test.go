@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"fix-ticket-system/config"
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSearch returns a repository whose database has the search index. It
+// skips the test when SQLite was built without FTS5 (-tags sqlite_fts5).
+func setupSearch(t *testing.T) *TicketRepository {
+	db := setupTestDB(t)
+	config.DB = db
+	if err := MigrateTicketSearch(db); errors.Is(err, ErrSearchNotSupported) {
+		t.Skip(err)
+	} else {
+		require.NoError(t, err)
+	}
+	return NewTicketRepository()
+}
+
+func createSearchTicket(t *testing.T, repo *TicketRepository, orgID uuid.UUID, title, description string) *models.Ticket {
+	ticket := models.NewTicket(orgID, title, description, uuid.New())
+	require.NoError(t, repo.Create(ticket))
+	return ticket
+}
+
+func TestTicketRepository_Search(t *testing.T) {
+	repo := setupSearch(t)
+	inTitle := createSearchTicket(t, repo, testOrgID, "Printer is jammed", "Paper stuck in tray two")
+	inDescription := createSearchTicket(t, repo, testOrgID, "Third floor", "The printers on the third floor are jammed again")
+	createSearchTicket(t, repo, testOrgID, "VPN drops", "Connection lost every hour")
+	createSearchTicket(t, repo, uuid.New(), "Printer is jammed", "In another organization")
+
+	results, err := repo.Search(testOrgID, "jammed PRINTERS", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	// Title matches rank first
+	assert.Equal(t, inTitle.ID, results[0].ID)
+	assert.Equal(t, inDescription.ID, results[1].ID)
+	assert.Greater(t, results[0].Rank, results[1].Rank)
+	assert.Contains(t, results[0].TitleHighlight, "<mark>Printer</mark>")
+	assert.Contains(t, results[1].DescriptionSnippet, "<mark>printers</mark>")
+	assert.Equal(t, "Printer is jammed", results[0].Title)
+
+	// Every word must match
+	results, err = repo.Search(testOrgID, "printer vpn", 0)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = repo.Search(testOrgID, "jammed", 1)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// Stop words are not required to match, as on Postgres, which does not
+	// index them
+	results, err = repo.Search(testOrgID, "the printers on the third floor", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, inDescription.ID, results[0].ID)
+	results, err = repo.Search(testOrgID, "was the printer jammed", 0)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	_, err = repo.Search(testOrgID, " -*\"() ", 0)
+	assert.ErrorIs(t, err, ErrEmptySearch)
+	_, err = repo.Search(testOrgID, "What is this?", 0)
+	assert.ErrorIs(t, err, ErrEmptySearch)
+}
+
+func TestTicketRepository_SearchFollowsChanges(t *testing.T) {
+	repo := setupSearch(t)
+	ticket := createSearchTicket(t, repo, testOrgID, "Printer is jammed", "Paper stuck")
+
+	ticket.Title = "Scanner is <broken>"
+	require.NoError(t, repo.Update(ticket))
+	results, err := repo.Search(testOrgID, "printer", 0)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = repo.Search(testOrgID, "scanner broken", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "<mark>Scanner</mark> is &lt;<mark>broken</mark>&gt;", results[0].TitleHighlight)
+
+	require.NoError(t, repo.Delete(testOrgID, ticket.ID))
+	results, err = repo.Search(testOrgID, "scanner", 0)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Tickets stored before the index was created are found too
+	for _, statement := range []string{"DROP TRIGGER tickets_fts_insert", "DROP TRIGGER tickets_fts_update", "DROP TRIGGER tickets_fts_delete", "DROP TABLE tickets_fts"} {
+		require.NoError(t, config.DB.Exec(statement).Error)
+	}
+	createSearchTicket(t, repo, testOrgID, "Laptop battery", "Drains quickly")
+	require.NoError(t, MigrateTicketSearch(config.DB))
+	results, err = repo.Search(testOrgID, "battery", 0)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestSearchWords(t *testing.T) {
+	assert.Equal(t, []string{"printer", "3rd", "floor", "café"}, searchWords(`Printer "3rd" floor* -café`))
+	assert.Empty(t, searchWords(" -*\"() "))
+	assert.Equal(t, []string{"printer", "3rd", "floor", "working"}, searchWords("The printer on the 3rd floor is not working"))
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
 	"fix-ticket-system/middleware"
@@ -12,14 +13,24 @@ import (
 )
 
 type AdminRoutes struct {
-	userService *service.UserService
-	auth        *middleware.AuthMiddleware
+	userService     *service.UserService
+	sessionService  *service.SessionService
+	apiKeyService   *service.APIKeyService
+	rbacService     *service.RBACService
+	throttleService *service.LoginThrottleService
+	auditService    *service.AuditService
+	auth            *middleware.AuthMiddleware
 }
 
-func NewAdminRoutes(userService *service.UserService, auth *middleware.AuthMiddleware) *AdminRoutes {
+func NewAdminRoutes(userService *service.UserService, sessionService *service.SessionService, apiKeyService *service.APIKeyService, rbacService *service.RBACService, throttleService *service.LoginThrottleService, auditService *service.AuditService, auth *middleware.AuthMiddleware) *AdminRoutes {
 	return &AdminRoutes{
-		userService: userService,
-		auth:        auth,
+		userService:     userService,
+		sessionService:  sessionService,
+		apiKeyService:   apiKeyService,
+		rbacService:     rbacService,
+		throttleService: throttleService,
+		auditService:    auditService,
+		auth:            auth,
 	}
 }
 
@@ -27,18 +38,67 @@ func (r *AdminRoutes) Register(router *gin.Engine) {
 	admin := router.Group("/api/v1/admin")
 	admin.Use(r.auth.RequireAuth(), r.auth.RequireAdmin())
 
-	admin.POST("/users", r.createUser)
-	admin.GET("/users", r.listUsers)
-	admin.GET("/users/:id", r.getUser)
-	admin.PUT("/users/:id", r.updateUser)
-	admin.DELETE("/users/:id", r.deleteUser)
+	users := admin.Group("/users")
+	users.POST("", r.createUser)
+	users.GET("", r.listUsers)
+	users.GET("/:id", r.getUser)
+	users.PUT("/:id", r.updateUser)
+	users.DELETE("/:id", r.deactivateUser)
+	users.POST("/:id/suspend", r.suspendUser)
+	users.POST("/:id/reactivate", r.reactivateUser)
+	users.DELETE("/:id/sessions", r.revokeUserSessions)
+	users.POST("/:id/unlock", r.unlockUser)
+	users.POST("/:id/impersonate", r.auth.DenyImpersonation(), r.impersonateUser)
+
+	admin.GET("/audit-events", r.listAuditEvents)
+
+	roles := admin.Group("/roles")
+	roles.GET("", r.listRoles)
+	roles.GET("/:role/permissions", r.getRolePermissions)
+	// Role permissions are shared by every organization
+	roles.PUT("/:role/permissions", r.auth.RequireSuperAdmin(), r.setRolePermissions)
+}
+
+// findUser loads the user named by the :id parameter. Users of other
+// organizations are reported as not found.
+func (r *AdminRoutes) findUser(c *gin.Context) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	user, err := r.userService.GetUserInOrganization(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// findManageableUser is findUser for changes; only super admins may change
+// other super admins
+func (r *AdminRoutes) findManageableUser(c *gin.Context) (*models.User, bool) {
+	user, ok := r.findUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	if current, _ := middleware.CurrentUser(c); user.SuperAdmin && (current == nil || !current.SuperAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can manage super admins"})
+		return nil, false
+	}
+
+	return user, true
 }
 
 func (r *AdminRoutes) createUser(c *gin.Context) {
 	var input struct {
 		Email    string      `json:"email" binding:"required,email"`
-		Password string      `json:"password" binding:"required,min=6"`
-		Role     models.Role `json:"role" binding:"required,oneof=admin user"`
+		Password string      `json:"password" binding:"required"`
+		Role     models.Role `json:"role" binding:"required,oneof=admin agent requester viewer user"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -46,8 +106,13 @@ func (r *AdminRoutes) createUser(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userService.CreateUser(input.Email, input.Password, input.Role)
+	orgID, _ := middleware.CurrentOrganization(c)
+	user, err := r.userService.CreateUser(orgID, input.Email, input.Password, input.Role)
 	if err != nil {
+		if errors.Is(err, service.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -56,7 +121,8 @@ func (r *AdminRoutes) createUser(c *gin.Context) {
 }
 
 func (r *AdminRoutes) listUsers(c *gin.Context) {
-	users, err := r.userService.ListUsers()
+	orgID, _ := middleware.CurrentOrganization(c)
+	users, err := r.userService.ListUsers(orgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -66,31 +132,156 @@ func (r *AdminRoutes) listUsers(c *gin.Context) {
 }
 
 func (r *AdminRoutes) getUser(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
+	user, ok := r.findUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (r *AdminRoutes) updateUser(c *gin.Context) {
+	existing, ok := r.findManageableUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email string      `json:"email" binding:"required,email"`
+		Role  models.Role `json:"role" binding:"required,oneof=admin agent requester viewer user"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.userService.UpdateUser(existing.ID, input.Email, input.Role)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// deactivateUser replaces hard deletion; deactivated users are purged after a grace period
+func (r *AdminRoutes) deactivateUser(c *gin.Context) {
+	r.changeStatus(c, r.userService.DeactivateUser)
+}
+
+func (r *AdminRoutes) suspendUser(c *gin.Context) {
+	r.changeStatus(c, r.userService.SuspendUser)
+}
+
+func (r *AdminRoutes) reactivateUser(c *gin.Context) {
+	r.changeStatus(c, r.userService.ReactivateUser)
+}
+
+func (r *AdminRoutes) changeStatus(c *gin.Context, change func(uuid.UUID) (*models.User, error)) {
+	existing, ok := r.findManageableUser(c)
+	if !ok {
+		return
+	}
+	id := existing.ID
+
+	if current, _ := middleware.CurrentUser(c); current != nil && current.ID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the status of your own account"})
 		return
 	}
 
-	user, err := r.userService.GetUserByID(id)
+	user, err := change(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Credentials do not come back with a reactivation
+	if !user.IsActive() {
+		if err := r.sessionService.RevokeUserSessions(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := r.apiKeyService.RevokeUserKeys(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
-func (r *AdminRoutes) updateUser(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
+func (r *AdminRoutes) revokeUserSessions(c *gin.Context) {
+	user, ok := r.findManageableUser(c)
+	if !ok {
+		return
+	}
+
+	if err := r.sessionService.RevokeUserSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked successfully"})
+}
+
+func (r *AdminRoutes) unlockUser(c *gin.Context) {
+	user, ok := r.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := r.throttleService.Unlock(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.throttleService.UnlockTwoFactor(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+func (r *AdminRoutes) listRoles(c *gin.Context) {
+	roles, err := r.rbacService.ListRolePermissions()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func (r *AdminRoutes) getRolePermissions(c *gin.Context) {
+	role := models.Role(c.Param("role"))
+	if !role.IsValid() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	permissions, err := r.rbacService.PermissionsForRole(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role, "permissions": permissions})
+}
+
+func (r *AdminRoutes) setRolePermissions(c *gin.Context) {
+	role := models.Role(c.Param("role"))
+	if !role.IsValid() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
 		return
 	}
 
 	var input struct {
-		Email string      `json:"email" binding:"required,email"`
-		Role  models.Role `json:"role" binding:"required,oneof=admin user"`
+		Permissions []models.Permission `json:"permissions" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -98,26 +289,97 @@ func (r *AdminRoutes) updateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userService.UpdateUser(id, input.Email, input.Role)
+	for _, p := range input.Permissions {
+		if !p.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission " + string(p)})
+			return
+		}
+	}
+
+	permissions, err := r.rbacService.SetRolePermissions(role, input.Permissions)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, gin.H{"role": role, "permissions": permissions})
 }
 
-func (r *AdminRoutes) deleteUser(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
+// impersonateUser issues a short-lived access token acting as the user, for
+// support admins to see what the user sees. Every request made with it is
+// recorded as an audit event.
+func (r *AdminRoutes) impersonateUser(c *gin.Context) {
+	user, ok := r.findUser(c)
+	if !ok {
+		return
+	}
+
+	admin, _ := middleware.CurrentUser(c)
+	sessionID, ok := currentSessionID(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation requires a signed-in session"})
+		return
+	}
+	if !middleware.CanImpersonate(admin, user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot impersonate this user"})
+		return
+	}
+	if !user.IsActive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is " + string(user.Status)})
+		return
+	}
+
+	err := r.auditService.Record(&models.AuditEvent{
+		OrganizationID: user.OrganizationID,
+		ActorID:        admin.ID,
+		UserID:         user.ID,
+		Action:         models.AuditActionImpersonationStart,
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		Status:         http.StatusOK,
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := r.userService.DeleteUser(id); err != nil {
+	token, err := r.auth.GenerateImpersonationToken(admin, user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(middleware.ImpersonationTTL.Seconds()),
+		"user":         user,
+	})
+}
+
+// listAuditEvents lists the audit events of the organization, optionally
+// filtered by the acting admin (actor_id) or the user acted as (user_id)
+func (r *AdminRoutes) listAuditEvents(c *gin.Context) {
+	var filters [2]*uuid.UUID
+	for i, param := range []string{"actor_id", "user_id"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return
+		}
+		filters[i] = &id
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	events, err := r.auditService.ListEvents(orgID, filters[0], filters[1])
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	c.JSON(http.StatusOK, events)
 }
@@ -0,0 +1,302 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loginAs(t *testing.T, r *gin.Engine, email, password string) string {
+	w := login(r, email, password)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.AccessToken
+}
+
+func putWithToken(r *gin.Engine, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("PUT", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRoutes_RolePermissions(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	admin, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "orgadmin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = userService.SetSuperAdmin(admin.ID, true)
+	assert.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+	orgAdminToken := loginAs(t, r, "orgadmin@example.com", "secret123")
+
+	w := getWithToken(r, "/api/v1/admin/roles", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles map[models.Role][]models.Permission
+	json.Unmarshal(w.Body.Bytes(), &roles)
+	assert.Contains(t, roles[models.RoleViewer], models.PermissionTicketRead)
+
+	// Role permissions apply to every organization, so only super admins edit them
+	w = putWithToken(r, "/api/v1/admin/roles/viewer/permissions", orgAdminToken, map[string]interface{}{
+		"permissions": []string{"ticket:read", "ticket:create"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = putWithToken(r, "/api/v1/admin/roles/viewer/permissions", token, map[string]interface{}{
+		"permissions": []string{"ticket:read", "ticket:create"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ticket:create")
+
+	w = putWithToken(r, "/api/v1/admin/roles/viewer/permissions", token, map[string]interface{}{
+		"permissions": []string{"ticket:explode"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = getWithToken(r, "/api/v1/admin/roles/superuser/permissions", token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminRoutes_RequireAdmin(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+	token := loginAs(t, r, "agent@example.com", "secret123")
+
+	w := getWithToken(r, "/api/v1/admin/users", token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAdminRoutes_APIKeyScopes(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	assert.NoError(t, err)
+	token := loginAs(t, r, "root@example.com", "secret123")
+
+	createKey := func(scopes ...string) string {
+		w := postWithToken(r, "/api/v1/api-keys", token, map[string]interface{}{"name": "script", "scopes": scopes})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var created struct {
+			Key string `json:"key"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created.Key
+	}
+
+	// A key does not inherit its owner's admin rights beyond its scopes
+	readOnly := createKey("ticket:read")
+	assert.Equal(t, http.StatusForbidden, getWithToken(r, "/api/v1/admin/roles", readOnly).Code)
+	assert.Equal(t, http.StatusForbidden, putWithToken(r, "/api/v1/admin/roles/viewer/permissions", readOnly, map[string]interface{}{
+		"permissions": []string{"ticket:read", "ticket:delete"},
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken(r, "/api/v1/super/organizations", readOnly).Code)
+
+	manage := createKey("user:manage")
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/admin/roles", manage).Code)
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/super/organizations", manage).Code)
+}
+
+func deleteWithToken(r *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("DELETE", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRoutes_NarrowedAdminRole(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	assert.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	rootToken := loginAs(t, r, "root@example.com", "secret123")
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	// Without user:manage, admins lose the admin routes
+	w := putWithToken(r, "/api/v1/admin/roles/admin/permissions", rootToken, map[string]interface{}{
+		"permissions": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken(r, "/api/v1/admin/users", adminToken).Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken(r, "/api/v1/admin/roles", adminToken).Code)
+
+	// Super admins keep them and can restore the role
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/admin/users", rootToken).Code)
+	w = putWithToken(r, "/api/v1/admin/roles/admin/permissions", rootToken, map[string]interface{}{
+		"permissions": []string{"ticket:read", "user:manage"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/admin/users", adminToken).Code)
+}
+
+func TestAdminRoutes_PermissionGrantsAdminAccess(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	require.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	rootToken := loginAs(t, r, "root@example.com", "secret123")
+	agentToken := loginAs(t, r, "agent@example.com", "secret123")
+
+	assert.Equal(t, http.StatusForbidden, getWithToken(r, "/api/v1/admin/users", agentToken).Code)
+
+	// Granting user:manage to another role opens the admin API to it
+	w := putWithToken(r, "/api/v1/admin/roles/agent/permissions", rootToken, map[string]interface{}{
+		"permissions": []string{"ticket:read", "user:manage"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/admin/users", agentToken).Code)
+}
+
+func TestAdminRoutes_DeactivateAndReactivate(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	admin, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	userToken := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := deleteWithToken(r, "/api/v1/admin/users/"+user.ID.String(), adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"deactivated"`)
+
+	// The user is kept but can no longer sign in or use existing tokens
+	_, err = userService.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(r, "/api/v1/me", userToken).Code)
+	assert.Equal(t, http.StatusForbidden, login(r, "jane@example.com", "secret123").Code)
+
+	w = postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/reactivate", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, login(r, "jane@example.com", "secret123").Code)
+
+	w = deleteWithToken(r, "/api/v1/admin/users/"+admin.ID.String(), adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminRoutes_UpdateUserEmailTaken(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := putWithToken(r, "/api/v1/admin/users/"+user.ID.String(), adminToken, map[string]string{"email": "admin@example.com", "role": "agent"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Keeping the own email is not a conflict
+	w = putWithToken(r, "/api/v1/admin/users/"+user.ID.String(), adminToken, map[string]string{"email": "jane@example.com", "role": "agent"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"agent"`)
+}
+
+func TestAdminRoutes_SuspendBlocksAPIKeys(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	userToken := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/api-keys", userToken, map[string]interface{}{"name": "script", "scopes": []string{"ticket:read"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/suspend", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Suspension revokes the key, so it stays unusable once the user is back
+	w = getWithToken(r, "/api/v1/me", created.Key)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/reactivate", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = getWithToken(r, "/api/v1/me", created.Key)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminRoutes_Impersonation(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	admin, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	require.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	userToken := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/impersonate", userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postWithToken(r, "/api/v1/admin/users/"+root.ID.String()+"/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postWithToken(r, "/api/v1/admin/users/"+admin.ID.String()+"/impersonate", adminToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/impersonate", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 600, response.ExpiresIn)
+	assert.Empty(t, response.RefreshToken)
+
+	// The token acts as the user and labels every response with the admin
+	w = getWithToken(r, "/api/v1/me", response.AccessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "jane@example.com")
+	assert.Equal(t, admin.ID.String(), w.Header().Get(middleware.ImpersonatedByHeader))
+	assert.Empty(t, getWithToken(r, "/api/v1/me", userToken).Header().Get(middleware.ImpersonatedByHeader))
+
+	// Credentials that would outlive the impersonation cannot be created
+	w = postWithToken(r, "/api/v1/api-keys", response.AccessToken, map[string]interface{}{"name": "script", "scopes": []string{"ticket:read"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = getWithToken(r, "/api/v1/admin/audit-events?user_id="+user.ID.String(), adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var events []models.AuditEvent
+	json.Unmarshal(w.Body.Bytes(), &events)
+	require.Len(t, events, 3)
+	statuses := map[string]int{}
+	for _, event := range events {
+		assert.Equal(t, admin.ID, event.ActorID)
+		statuses[string(event.Action)+" "+event.Method+" "+event.Path] = event.Status
+	}
+	assert.Equal(t, http.StatusOK, statuses["impersonation.start POST /api/v1/admin/users/"+user.ID.String()+"/impersonate"])
+	assert.Equal(t, http.StatusOK, statuses["impersonation.request GET /api/v1/me"])
+	assert.Equal(t, http.StatusForbidden, statuses["impersonation.request POST /api/v1/api-keys"])
+
+	// Impersonation ends as soon as the admin loses the right to it
+	_, err = userService.UpdateUser(admin.ID, admin.Email, models.RoleAgent)
+	require.NoError(t, err)
+	w = getWithToken(r, "/api/v1/me", response.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type APIKeyRoutes struct {
+	apiKeyService *service.APIKeyService
+	userService   *service.UserService
+	auth          *middleware.AuthMiddleware
+}
+
+func NewAPIKeyRoutes(apiKeyService *service.APIKeyService, userService *service.UserService, auth *middleware.AuthMiddleware) *APIKeyRoutes {
+	return &APIKeyRoutes{
+		apiKeyService: apiKeyService,
+		userService:   userService,
+		auth:          auth,
+	}
+}
+
+func (r *APIKeyRoutes) Register(router *gin.Engine) {
+	keys := router.Group("/api/v1/api-keys")
+	keys.Use(r.auth.RequireAuth(), r.auth.DenyImpersonation())
+
+	keys.POST("", r.createOwnKey)
+	keys.GET("", r.listOwnKeys)
+	keys.DELETE("/:id", r.revokeOwnKey)
+
+	admin := router.Group("/api/v1/admin")
+	admin.Use(r.auth.RequireAuth(), r.auth.DenyImpersonation(), r.auth.RequireAdmin())
+
+	admin.POST("/service-accounts", r.createServiceAccount)
+	admin.POST("/users/:id/api-keys", r.createUserKey)
+	admin.GET("/users/:id/api-keys", r.listUserKeys)
+	admin.DELETE("/api-keys/:id", r.revokeKey)
+}
+
+type createKeyInput struct {
+	Name          string              `json:"name" binding:"required"`
+	Scopes        []models.Permission `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int                 `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+func (in createKeyInput) expiresAt() *time.Time {
+	if in.ExpiresInDays == 0 {
+		return nil
+	}
+	t := time.Now().Add(time.Duration(in.ExpiresInDays) * 24 * time.Hour)
+	return &t
+}
+
+func (r *APIKeyRoutes) createOwnKey(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	var input createKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A key can never grant more than its owner currently has
+	if !canGrantScopes(c, input.Scopes) {
+		return
+	}
+
+	r.createKey(c, user.ID, input)
+}
+
+func (r *APIKeyRoutes) listOwnKeys(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	r.listKeys(c, user.ID)
+}
+
+func (r *APIKeyRoutes) revokeOwnKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	key, err := r.apiKeyService.GetKey(id)
+	if err != nil || key.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := r.apiKeyService.RevokeKey(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func (r *APIKeyRoutes) createServiceAccount(c *gin.Context) {
+	var input struct {
+		Email string      `json:"email" binding:"required,email"`
+		Role  models.Role `json:"role" binding:"required,oneof=admin agent requester viewer user"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	user, err := r.userService.CreateServiceAccount(orgID, input.Email, input.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func (r *APIKeyRoutes) createUserKey(c *gin.Context) {
+	owner, ok := r.findKeyOwner(c)
+	if !ok {
+		return
+	}
+
+	// A key for a person would let the admin act as them without the audit
+	// trail of impersonation; people create their own keys
+	if !owner.ServiceAccount {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can only be created for service accounts"})
+		return
+	}
+
+	var input createKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Admins cannot hand out more than they hold themselves
+	if !canGrantScopes(c, input.Scopes) {
+		return
+	}
+
+	r.createKey(c, owner.ID, input)
+}
+
+func (r *APIKeyRoutes) listUserKeys(c *gin.Context) {
+	owner, ok := r.findKeyOwner(c)
+	if !ok {
+		return
+	}
+
+	r.listKeys(c, owner.ID)
+}
+
+// findKeyOwner returns the user named by the :id parameter if it belongs to
+// the current organization and the caller may manage it; only super admins
+// may manage the keys of super admins
+func (r *APIKeyRoutes) findKeyOwner(c *gin.Context) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	owner, err := r.userService.GetUserInOrganization(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	if current, _ := middleware.CurrentUser(c); owner.SuperAdmin && (current == nil || !current.SuperAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can manage super admins"})
+		return nil, false
+	}
+
+	return owner, true
+}
+
+// canGrantScopes rejects scopes the caller does not hold in the current request
+func canGrantScopes(c *gin.Context, scopes []models.Permission) bool {
+	for _, scope := range scopes {
+		if scope.IsValid() && !middleware.HasPermission(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant scope " + string(scope)})
+			return false
+		}
+	}
+	return true
+}
+
+func (r *APIKeyRoutes) revokeKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	key, err := r.apiKeyService.GetKey(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	orgID, _ := middleware.CurrentOrganization(c)
+	if _, err := r.userService.GetUserInOrganization(orgID, key.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := r.apiKeyService.RevokeKey(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func (r *APIKeyRoutes) createKey(c *gin.Context, userID uuid.UUID, input createKeyInput) {
+	// Otherwise a leaked or expiring key could replace itself with one that
+	// never expires
+	if _, viaKey := middleware.APIKeyID(c); viaKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create API keys"})
+		return
+	}
+
+	for _, scope := range input.Scopes {
+		if !scope.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope " + string(scope)})
+			return
+		}
+	}
+
+	key, raw, err := r.apiKeyService.CreateKey(userID, input.Name, input.Scopes, input.expiresAt())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The raw key is only ever returned here
+	c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": raw})
+}
+
+func (r *APIKeyRoutes) listKeys(c *gin.Context, userID uuid.UUID) {
+	keys, err := r.apiKeyService.ListKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postWithToken(r *gin.Engine, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	req := postJSONRequest(path, payload)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyRoutes_ServiceAccountKey(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/admin/service-accounts", adminToken, map[string]string{
+		"email": "ci-bot@example.com",
+		"role":  "admin",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var account models.User
+	json.Unmarshal(w.Body.Bytes(), &account)
+	assert.True(t, account.ServiceAccount)
+
+	w = postWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", account.ID), adminToken, map[string]interface{}{
+		"name":            "ci",
+		"scopes":          []string{"ticket:read"},
+		"expires_in_days": 30,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		APIKey models.APIKey `json:"api_key"`
+		Key    string        `json:"key"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NotEmpty(t, created.Key)
+	assert.NotNil(t, created.APIKey.ExpiresAt)
+
+	// The key authenticates, but only within its scopes
+	w = getWithToken(r, "/api/v1/api-keys", created.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Keys cannot mint further keys, which could outlive them
+	w = postWithToken(r, "/api/v1/api-keys", created.Key, map[string]interface{}{
+		"name":   "forever",
+		"scopes": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = getWithToken(r, "/api/v1/admin/users", created.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/admin/api-keys/%s", created.APIKey.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = getWithToken(r, "/api/v1/api-keys", created.Key)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Service accounts cannot log in with a password
+	w = login(r, "ci-bot@example.com", "anything")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPIKeyRoutes_CannotExceedOwnPermissions(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "viewer@example.com", "secret123", models.RoleViewer)
+	assert.NoError(t, err)
+	token := loginAs(t, r, "viewer@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/api-keys", token, map[string]interface{}{
+		"name":   "escalate",
+		"scopes": []string{"ticket:delete"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postWithToken(r, "/api/v1/api-keys", token, map[string]interface{}{
+		"name":   "read-only",
+		"scopes": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestAPIKeyRoutes_AdminKeysForOtherUsers(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	assert.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	account, err := userService.CreateServiceAccount(testOrgID, "ci-bot@example.com", models.RoleAdmin)
+	assert.NoError(t, err)
+	rootToken := loginAs(t, r, "root@example.com", "secret123")
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	// Only super admins may manage the keys of super admins
+	w := postWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", root.ID), adminToken, map[string]interface{}{
+		"name":   "takeover",
+		"scopes": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = getWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", root.ID), adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Admins cannot get a key to act as a person; that is what impersonation is for
+	agent, err := userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+	w = postWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", agent.ID), adminToken, map[string]interface{}{
+		"name":   "act-as",
+		"scopes": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = getWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", agent.ID), adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Admins cannot grant scopes their own role lacks
+	w = putWithToken(r, "/api/v1/admin/roles/admin/permissions", rootToken, map[string]interface{}{
+		"permissions": []string{"ticket:read", "user:manage"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", account.ID), adminToken, map[string]interface{}{
+		"name":   "ci",
+		"scopes": []string{"ticket:delete"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postWithToken(r, fmt.Sprintf("/api/v1/admin/users/%s/api-keys", account.ID), adminToken, map[string]interface{}{
+		"name":   "ci",
+		"scopes": []string{"ticket:read"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
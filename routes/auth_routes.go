@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthRoutes struct {
+	userService     *service.UserService
+	authenticator   service.Authenticator
+	sessionService  *service.SessionService
+	throttleService *service.LoginThrottleService
+	auth            *middleware.AuthMiddleware
+}
+
+func NewAuthRoutes(userService *service.UserService, authenticator service.Authenticator, sessionService *service.SessionService, throttleService *service.LoginThrottleService, auth *middleware.AuthMiddleware) *AuthRoutes {
+	return &AuthRoutes{
+		userService:     userService,
+		authenticator:   authenticator,
+		sessionService:  sessionService,
+		throttleService: throttleService,
+		auth:            auth,
+	}
+}
+
+func (r *AuthRoutes) Register(router *gin.Engine) {
+	auth := router.Group("/api/v1/auth")
+
+	auth.POST("/login", r.login)
+	auth.POST("/refresh", r.refresh)
+	auth.POST("/logout", r.logout)
+
+	router.GET("/.well-known/jwks.json", r.jwks)
+}
+
+func (r *AuthRoutes) login(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.throttleService.Check(input.Email, c.ClientIP()); err != nil {
+		respondThrottleError(c, err)
+		return
+	}
+
+	user, err := r.authenticator.Authenticate(input.Email, input.Password)
+	if err != nil {
+		// A directory that could not be asked is not a wrong password, and must
+		// not lock anyone out
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication is currently unavailable"})
+			return
+		}
+		if err := r.throttleService.RecordFailure(input.Email, c.ClientIP()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if err := r.throttleService.RecordSuccess(input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + string(user.Status)})
+		return
+	}
+
+	session, refreshToken, err := r.sessionService.CreateSession(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithTokens(c, r.auth, user, session, refreshToken)
+}
+
+func (r *AuthRoutes) refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, refreshToken, err := r.sessionService.Refresh(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.userService.GetUserByID(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + string(user.Status)})
+		return
+	}
+
+	respondWithTokens(c, r.auth, user, session, refreshToken)
+}
+
+func (r *AuthRoutes) logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.sessionService.RevokeByRefreshToken(input.RefreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (r *AuthRoutes) jwks(c *gin.Context) {
+	c.JSON(http.StatusOK, r.auth.JWKS())
+}
+
+// respondWithTokens writes the access and refresh tokens of a freshly started or refreshed session
+func respondWithTokens(c *gin.Context, auth *middleware.AuthMiddleware, user *models.User, session *models.Session, refreshToken string) {
+	token, err := auth.GenerateToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  token,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	})
+}
+
+// respondThrottleError answers a lockout with 429 and when to retry
+func respondThrottleError(c *gin.Context, err error) {
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
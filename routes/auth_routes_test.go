@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var testOrgID = uuid.New()
+
+func setupAuthRouter(t *testing.T) (*gin.Engine, *service.UserService) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.SupersededRefreshToken{}, &models.RolePermission{}, &models.APIKey{}, &models.LoginThrottle{}, &models.Ticket{}, &models.Organization{}, &models.AuditEvent{}, &models.Team{}, &models.Workflow{})
+	assert.NoError(t, err)
+
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	rbacService := service.NewRBACService(db)
+	assert.NoError(t, rbacService.SeedDefaults())
+	apiKeyService := service.NewAPIKeyService(db)
+	auditService := service.NewAuditService(db)
+	auth := middleware.NewAuthMiddleware(userService, sessionService, rbacService, apiKeyService, service.NewOrganizationService(db), auditService, middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+
+	throttleService := service.NewLoginThrottleService(db, service.DefaultLoginThrottleConfig)
+
+	r := gin.New()
+	NewAuthRoutes(userService, service.NewLocalAuthenticator(userService), sessionService, throttleService, auth).Register(r)
+	NewAdminRoutes(userService, sessionService, apiKeyService, rbacService, throttleService, auditService, auth).Register(r)
+	NewAPIKeyRoutes(apiKeyService, userService, auth).Register(r)
+	NewMeRoutes(userService, sessionService, auth).Register(r)
+	NewTwoFactorRoutes(service.NewTOTPService(db, "Test"), sessionService, throttleService, auth).Register(r)
+	NewOrganizationRoutes(service.NewOrganizationService(db), userService, auth).Register(r)
+	NewSCIMRoutes(userService, service.NewTeamService(db), sessionService, apiKeyService, auth).Register(r)
+	return r, userService
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func postJSONRequest(path string, payload interface{}) *http.Request {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func postJSON(r *gin.Engine, path string, payload interface{}) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, postJSONRequest(path, payload))
+	return w
+}
+
+func getWithToken(r *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func login(r *gin.Engine, email, password string) *httptest.ResponseRecorder {
+	return postJSON(r, "/api/v1/auth/login", map[string]string{"email": email, "password": password})
+}
+
+func TestLogin_IssuesTokenAcceptedByAuthMiddleware(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	w := login(r, "admin@example.com", "secret123")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, int(middleware.AccessTokenTTL.Seconds()), response.ExpiresIn)
+
+	w = getWithToken(r, "/api/v1/admin/users", response.AccessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLogin_InvalidCredentials(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "user@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+
+	w := login(r, "user@example.com", "wrong-password")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = login(r, "missing@example.com", "secret123")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	var first tokenResponse
+	json.Unmarshal(login(r, "admin@example.com", "secret123").Body.Bytes(), &first)
+
+	w := postJSON(r, "/api/v1/auth/refresh", map[string]string{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var second tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	w = postJSON(r, "/api/v1/auth/logout", map[string]string{"refresh_token": second.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Access tokens bound to the revoked session are rejected
+	w = getWithToken(r, "/api/v1/admin/users", second.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = getWithToken(r, "/api/v1/admin/users", first.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	var first tokenResponse
+	json.Unmarshal(login(r, "admin@example.com", "secret123").Body.Bytes(), &first)
+	w := postJSON(r, "/api/v1/auth/refresh", map[string]string{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var second tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &second)
+
+	// The rotated refresh token can no longer be used, and presenting it ends
+	// the session of whoever holds the current one
+	w = postJSON(r, "/api/v1/auth/refresh", map[string]string{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(r, "/api/v1/auth/refresh", map[string]string{"refresh_token": second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = getWithToken(r, "/api/v1/admin/users", second.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogin_LockoutAndAdminUnlock(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	user, err := userService.CreateUser(testOrgID, "user@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+
+	for i := 0; i < service.DefaultLoginThrottleConfig.AccountFreeAttempts+1; i++ {
+		w := login(r, "user@example.com", "wrong-password")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Even the right password is refused while the account is locked
+	w := login(r, "user@example.com", "secret123")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	w = postWithToken(r, "/api/v1/admin/users/"+user.ID.String()+"/unlock", adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = login(r, "user@example.com", "secret123")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLogin_DirectoryOutageDoesNotLockOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.RolePermission{}, &models.LoginThrottle{}))
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	auth := middleware.NewAuthMiddleware(userService, sessionService, service.NewRBACService(db), service.NewAPIKeyService(db), service.NewOrganizationService(db), service.NewAuditService(db), middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+	unreachable := service.NewLDAPAuthenticator(service.LDAPConfig{URL: "ldap://127.0.0.1:1", UserBaseDN: "ou=users,dc=example,dc=com"}, userService, testOrgID)
+	authenticator := service.NewChainAuthenticator(unreachable, service.NewLocalAuthenticator(userService))
+	r := gin.New()
+	NewAuthRoutes(userService, authenticator, sessionService, service.NewLoginThrottleService(db, service.DefaultLoginThrottleConfig), auth).Register(r)
+	_, err = userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	// Logins the directory would have to answer fail without counting
+	for i := 0; i < service.DefaultLoginThrottleConfig.AccountFreeAttempts+1; i++ {
+		w := login(r, "jane@example.com", "secret123")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	}
+	var throttles int64
+	assert.NoError(t, db.Model(&models.LoginThrottle{}).Count(&throttles).Error)
+	assert.Zero(t, throttles)
+
+	// The local admin still gets in
+	w := login(r, "admin@example.com", "secret123")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
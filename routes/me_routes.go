@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MeRoutes struct {
+	userService    *service.UserService
+	sessionService *service.SessionService
+	auth           *middleware.AuthMiddleware
+}
+
+func NewMeRoutes(userService *service.UserService, sessionService *service.SessionService, auth *middleware.AuthMiddleware) *MeRoutes {
+	return &MeRoutes{
+		userService:    userService,
+		sessionService: sessionService,
+		auth:           auth,
+	}
+}
+
+func (r *MeRoutes) Register(router *gin.Engine) {
+	me := router.Group("/api/v1/me")
+	me.Use(r.auth.RequireAuth())
+
+	me.GET("", r.getProfile)
+	me.PATCH("", r.auth.DenyImpersonation(), r.updateProfile)
+}
+
+func (r *MeRoutes) getProfile(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	c.JSON(http.StatusOK, user)
+}
+
+func (r *MeRoutes) updateProfile(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	var input struct {
+		Email           string `json:"email" binding:"omitempty,email"`
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.ServiceAccount {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Service accounts cannot change their profile"})
+		return
+	}
+
+	updated, err := r.userService.UpdateProfile(user.ID, input.CurrentPassword, input.Email, input.NewPassword)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A new password signs out every other session, which may have been
+	// opened with the old one
+	if input.NewPassword != "" {
+		if sessionID, ok := currentSessionID(c); ok {
+			err = r.sessionService.RevokeOtherSessions(user.ID, sessionID)
+		} else {
+			err = r.sessionService.RevokeUserSessions(user.ID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchWithToken(r *gin.Engine, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("PATCH", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMeRoutes_GetProfile(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	token := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := getWithToken(r, "/api/v1/me", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.Equal(t, models.RoleUser, user.Role)
+	assert.NotContains(t, w.Body.String(), "password")
+}
+
+func TestMeRoutes_ChangePassword(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	token := loginAs(t, r, "jane@example.com", "secret123")
+	otherToken := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := patchWithToken(r, "/api/v1/me", token, map[string]string{"current_password": "wrong", "new_password": "newsecret"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = patchWithToken(r, "/api/v1/me", token, map[string]string{"current_password": "secret123", "new_password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at least 8 characters")
+
+	w = patchWithToken(r, "/api/v1/me", token, map[string]string{"current_password": "secret123", "new_password": "newsecret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The current session stays signed in, other sessions are revoked
+	assert.Equal(t, http.StatusOK, getWithToken(r, "/api/v1/me", token).Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(r, "/api/v1/me", otherToken).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, login(r, "jane@example.com", "secret123").Code)
+	assert.Equal(t, http.StatusOK, login(r, "jane@example.com", "newsecret").Code)
+}
+
+func TestMeRoutes_ChangeEmail(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	token := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := patchWithToken(r, "/api/v1/me", token, map[string]string{"email": "jane.doe@example.com"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the current password is required")
+
+	w = patchWithToken(r, "/api/v1/me", token, map[string]string{"email": "jane.doe@example.com", "current_password": "secret123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "jane.doe@example.com")
+
+	_, err = userService.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	w = patchWithToken(r, "/api/v1/me", token, map[string]string{"email": "john@example.com", "current_password": "secret123"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type OIDCRoutes struct {
+	oidcService    *service.OIDCService
+	userService    *service.UserService
+	sessionService *service.SessionService
+	auth           *middleware.AuthMiddleware
+	organizationID uuid.UUID // organization users join on their first sign-in
+}
+
+func NewOIDCRoutes(oidcService *service.OIDCService, userService *service.UserService, sessionService *service.SessionService, auth *middleware.AuthMiddleware, organizationID uuid.UUID) *OIDCRoutes {
+	return &OIDCRoutes{
+		oidcService:    oidcService,
+		userService:    userService,
+		sessionService: sessionService,
+		auth:           auth,
+		organizationID: organizationID,
+	}
+}
+
+func (r *OIDCRoutes) Register(router *gin.Engine) {
+	oidc := router.Group("/api/v1/auth/oidc")
+
+	oidc.GET("/login", r.login)
+	oidc.GET("/callback", r.callback)
+}
+
+// oidcLoginCookie keeps the pending login in the browser that started it
+const oidcLoginCookie = "oidc_login"
+
+// oidcCookiePath limits the login cookie to the login and callback requests
+const oidcCookiePath = "/api/v1/auth/oidc"
+
+func (r *OIDCRoutes) login(c *gin.Context) {
+	url, login, err := r.oidcService.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Lax, as the provider sends the browser back with a top-level redirect
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLoginCookie, login, int(service.OIDCLoginTTL.Seconds()), oidcCookiePath, "", r.oidcService.SecureCookies(), true)
+	c.Redirect(http.StatusFound, url)
+}
+
+func (r *OIDCRoutes) callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned " + providerErr})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	// A login can only be completed once, by the browser that started it
+	login, _ := c.Cookie(oidcLoginCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLoginCookie, "", -1, oidcCookiePath, "", r.oidcService.SecureCookies(), true)
+
+	identity, err := r.oidcService.Exchange(c.Request.Context(), code, state, login)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidOIDCState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.userService.ProvisionExternalUser(r.organizationID, service.ExternalLogin{
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		Role:        identity.Role,
+		UpdateRole:  identity.RoleMapped,
+		LinkByEmail: true,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrExternalIdentityConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists and cannot sign in through the identity provider"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.ServiceAccount {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Service accounts cannot sign in"})
+		return
+	}
+	if !user.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is " + string(user.Status)})
+		return
+	}
+
+	session, refreshToken, err := r.sessionService.CreateSession(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithTokens(c, r.auth, user, session, refreshToken)
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OrganizationRoutes is the cross-organization tooling of super admins. To act
+// inside an organization, super admins send its ID in the X-Organization-ID
+// header to the regular routes.
+type OrganizationRoutes struct {
+	organizationService *service.OrganizationService
+	userService         *service.UserService
+	auth                *middleware.AuthMiddleware
+}
+
+func NewOrganizationRoutes(organizationService *service.OrganizationService, userService *service.UserService, auth *middleware.AuthMiddleware) *OrganizationRoutes {
+	return &OrganizationRoutes{
+		organizationService: organizationService,
+		userService:         userService,
+		auth:                auth,
+	}
+}
+
+func (r *OrganizationRoutes) Register(router *gin.Engine) {
+	super := router.Group("/api/v1/super")
+	super.Use(r.auth.RequireAuth(), r.auth.DenyImpersonation(), r.auth.RequireSuperAdmin())
+
+	super.GET("/organizations", r.listOrganizations)
+	super.POST("/organizations", r.createOrganization)
+	super.GET("/organizations/:id", r.getOrganization)
+	super.PUT("/organizations/:id", r.renameOrganization)
+	super.DELETE("/organizations/:id", r.deleteOrganization)
+	super.PUT("/users/:id/super-admin", r.setSuperAdmin)
+}
+
+type organizationInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (r *OrganizationRoutes) listOrganizations(c *gin.Context) {
+	orgs, err := r.organizationService.ListOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+func (r *OrganizationRoutes) createOrganization(c *gin.Context) {
+	var input organizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := r.organizationService.CreateOrganization(input.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+func (r *OrganizationRoutes) getOrganization(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	org, err := r.organizationService.GetOrganization(id)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (r *OrganizationRoutes) renameOrganization(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	var input organizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := r.organizationService.RenameOrganization(id, input.Name)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (r *OrganizationRoutes) deleteOrganization(c *gin.Context) {
+	id, ok := parseOrganizationID(c)
+	if !ok {
+		return
+	}
+
+	if err := r.organizationService.DeleteOrganization(id); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
+
+func (r *OrganizationRoutes) setSuperAdmin(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		SuperAdmin *bool `json:"super_admin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if current, _ := middleware.CurrentUser(c); current != nil && current.ID == id && !*input.SuperAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot revoke your own super admin access"})
+		return
+	}
+
+	if _, err := r.userService.GetUserByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user, err := r.userService.SetSuperAdmin(id, *input.SuperAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func parseOrganizationID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, service.ErrOrganizationNotEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization still has users or tickets"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getInOrganization(r *gin.Engine, path, token, orgID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(middleware.OrganizationHeader, orgID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOrganizationRoutes_SuperAdminCRUD(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	require.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	token := loginAs(t, r, "root@example.com", "secret123")
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := getWithToken(r, "/api/v1/super/organizations", adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postWithToken(r, "/api/v1/super/organizations", token, map[string]string{"name": "Acme"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var org models.Organization
+	json.Unmarshal(w.Body.Bytes(), &org)
+	assert.Equal(t, "Acme", org.Name)
+
+	w = putWithToken(r, "/api/v1/super/organizations/"+org.ID.String(), token, map[string]string{"name": "Acme Corp"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Acme Corp")
+
+	_, err = userService.CreateUser(org.ID, "jane@acme.example", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	w = deleteWithToken(r, "/api/v1/super/organizations/"+org.ID.String(), token)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = deleteWithToken(r, "/api/v1/super/organizations/"+uuid.New().String(), token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = putWithToken(r, "/api/v1/super/users/"+root.ID.String()+"/super-admin", token, map[string]bool{"super_admin": false})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOrganizationRoutes_OrganizationHeader(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	root, err := userService.CreateUser(testOrgID, "root@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.SetSuperAdmin(root.ID, true)
+	require.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	token := loginAs(t, r, "root@example.com", "secret123")
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/super/organizations", token, map[string]string{"name": "Acme"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var org models.Organization
+	json.Unmarshal(w.Body.Bytes(), &org)
+	outsider, err := userService.CreateUser(org.ID, "jane@acme.example", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	// Org admins only see their own organization
+	w = getWithToken(r, "/api/v1/admin/users/"+outsider.ID.String(), adminToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = getInOrganization(r, "/api/v1/admin/users", adminToken, org.ID.String())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = getInOrganization(r, "/api/v1/admin/users", token, org.ID.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var users []models.User
+	json.Unmarshal(w.Body.Bytes(), &users)
+	require.Len(t, users, 1)
+	assert.Equal(t, outsider.ID, users[0].ID)
+
+	w = getInOrganization(r, "/api/v1/admin/users", token, uuid.New().String())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = getInOrganization(r, "/api/v1/admin/users", token, "not-a-uuid")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordResetRoutes struct {
+	resetService    *service.PasswordResetService
+	sessionService  *service.SessionService
+	throttleService *service.LoginThrottleService
+}
+
+func NewPasswordResetRoutes(resetService *service.PasswordResetService, sessionService *service.SessionService, throttleService *service.LoginThrottleService) *PasswordResetRoutes {
+	return &PasswordResetRoutes{
+		resetService:    resetService,
+		sessionService:  sessionService,
+		throttleService: throttleService,
+	}
+}
+
+func (r *PasswordResetRoutes) Register(router *gin.Engine) {
+	password := router.Group("/api/v1/auth/password")
+
+	password.POST("/forgot", r.forgot)
+	password.POST("/reset", r.reset)
+}
+
+func (r *PasswordResetRoutes) forgot(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Requests count whether or not the email has an account, so being
+	// throttled reveals nothing either
+	if err := r.throttleService.CheckPasswordReset(input.Email, c.ClientIP()); err != nil {
+		respondThrottleError(c, err)
+		return
+	}
+	if err := r.throttleService.RecordPasswordReset(input.Email, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The response is the same whether or not the email has an account, and
+	// the link is created and mailed in the background so that how long the
+	// response takes does not tell either
+	go func(email string) {
+		if err := r.resetService.RequestReset(email); err != nil {
+			log.Printf("password reset request failed: %v", err)
+		}
+	}(input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email has an account, a reset link has been sent"})
+}
+
+func (r *PasswordResetRoutes) reset(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := r.resetService.ResetPassword(input.Token, input.NewPassword)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) || errors.Is(err, service.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sessions opened with the old password must not outlive it
+	if err := r.sessionService.RevokeUserSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
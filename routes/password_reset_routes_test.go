@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// fakeMailer hands mail to the test instead of sending it
+type fakeMailer struct {
+	sent chan sentMail
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.sent <- sentMail{to: to, subject: subject, body: body}
+	return nil
+}
+
+// nextMail waits for the mail that reset links are sent with in the background
+func (m *fakeMailer) nextMail(t *testing.T) sentMail {
+	select {
+	case mail := <-m.sent:
+		return mail
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+		return sentMail{}
+	}
+}
+
+func setupPasswordResetRouter(t *testing.T) (*gin.Engine, *service.UserService, *fakeMailer) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.RolePermission{}, &models.LoginThrottle{}, &models.PasswordResetToken{})
+	assert.NoError(t, err)
+	// Every connection to :memory: opens its own database, and reset links are
+	// created while the handler goes on
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	rbacService := service.NewRBACService(db)
+	assert.NoError(t, rbacService.SeedDefaults())
+	auth := middleware.NewAuthMiddleware(userService, sessionService, rbacService, service.NewAPIKeyService(db), service.NewOrganizationService(db), service.NewAuditService(db), middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+	mailer := &fakeMailer{sent: make(chan sentMail, 10)}
+
+	r := gin.New()
+	throttleService := service.NewLoginThrottleService(db, service.DefaultLoginThrottleConfig)
+	NewAuthRoutes(userService, service.NewLocalAuthenticator(userService), sessionService, throttleService, auth).Register(r)
+	NewMeRoutes(userService, sessionService, auth).Register(r)
+	NewPasswordResetRoutes(service.NewPasswordResetService(db, mailer, service.DefaultPasswordManager, "http://localhost/reset"), sessionService, throttleService).Register(r)
+	return r, userService, mailer
+}
+
+func TestPasswordResetRoutes_Reset(t *testing.T) {
+	r, userService, mailer := setupPasswordResetRouter(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	token := loginAs(t, r, "jane@example.com", "secret123")
+
+	w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": "jane@example.com"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	mail := mailer.nextMail(t)
+	assert.Equal(t, "jane@example.com", mail.to)
+	resetToken := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(mail.body)[1]
+
+	w = postJSON(r, "/api/v1/auth/password/reset", map[string]string{"token": resetToken, "new_password": "newsecret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Existing sessions are signed out and only the new password works
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(r, "/api/v1/me", token).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(r, "jane@example.com", "secret123").Code)
+	assert.Equal(t, http.StatusOK, login(r, "jane@example.com", "newsecret").Code)
+
+	w = postJSON(r, "/api/v1/auth/password/reset", map[string]string{"token": resetToken, "new_password": "another"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordResetRoutes_UnknownEmail(t *testing.T) {
+	r, _, mailer := setupPasswordResetRouter(t)
+
+	w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Never(t, func() bool { return len(mailer.sent) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestPasswordResetRoutes_Throttle(t *testing.T) {
+	r, userService, mailer := setupPasswordResetRouter(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	// Requests count against the email whether or not it has an account
+	for _, email := range []string{"jane@example.com", "nobody@example.com"} {
+		for i := 0; i < service.DefaultLoginThrottleConfig.ResetEmailFreeRequests+1; i++ {
+			w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": email})
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+		w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": email})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < service.DefaultLoginThrottleConfig.ResetEmailFreeRequests+1; i++ {
+		assert.Equal(t, "jane@example.com", mailer.nextMail(t).to)
+	}
+
+	// One IP cannot spread requests over many emails either
+	for i := 2*service.DefaultLoginThrottleConfig.ResetEmailFreeRequests + 2; i <= service.DefaultLoginThrottleConfig.ResetIPFreeRequests; i++ {
+		w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": fmt.Sprintf("user%d@example.com", i)})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	}
+	w := postJSON(r, "/api/v1/auth/password/forgot", map[string]string{"email": "other@example.com"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
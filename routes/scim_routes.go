@@ -0,0 +1,875 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema   = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema   = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema  = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType   = "application/scim+json"
+	scimMaxResults    = 200
+	scimUsersLocation = "/scim/v2/Users/"
+	scimGroupLocation = "/scim/v2/Groups/"
+)
+
+// SCIMRoutes lets an identity provider provision users and teams (as SCIM
+// groups) of the caller's organization through SCIM 2.0 (RFC 7643, 7644). The
+// provider authenticates with an API key of an admin service account.
+type SCIMRoutes struct {
+	userService    *service.UserService
+	teamService    *service.TeamService
+	sessionService *service.SessionService
+	apiKeyService  *service.APIKeyService
+	auth           *middleware.AuthMiddleware
+}
+
+func NewSCIMRoutes(userService *service.UserService, teamService *service.TeamService, sessionService *service.SessionService, apiKeyService *service.APIKeyService, auth *middleware.AuthMiddleware) *SCIMRoutes {
+	return &SCIMRoutes{
+		userService:    userService,
+		teamService:    teamService,
+		sessionService: sessionService,
+		apiKeyService:  apiKeyService,
+		auth:           auth,
+	}
+}
+
+func (r *SCIMRoutes) Register(router *gin.Engine) {
+	scim := router.Group("/scim/v2")
+	scim.Use(r.auth.RequireAuth(), r.auth.DenyImpersonation(), r.auth.RequireAdmin())
+
+	scim.GET("/ServiceProviderConfig", r.serviceProviderConfig)
+
+	scim.GET("/Users", r.listUsers)
+	scim.POST("/Users", r.createUser)
+	scim.GET("/Users/:id", r.getUser)
+	scim.PUT("/Users/:id", r.replaceUser)
+	scim.PATCH("/Users/:id", r.patchUser)
+	scim.DELETE("/Users/:id", r.deleteUser)
+
+	scim.GET("/Groups", r.listGroups)
+	scim.POST("/Groups", r.createGroup)
+	scim.GET("/Groups/:id", r.getGroup)
+	scim.PUT("/Groups/:id", r.replaceGroup)
+	scim.PATCH("/Groups/:id", r.patchGroup)
+	scim.DELETE("/Groups/:id", r.deleteGroup)
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type scimValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// scimUser is the SCIM view of a user. userName is the email; the role is the
+// primary entry of roles.
+type scimUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Active   *bool       `json:"active,omitempty"`
+	Emails   []scimValue `json:"emails,omitempty"`
+	Roles    []scimValue `json:"roles,omitempty"`
+	Password string      `json:"password,omitempty"` // only accepted on create
+	Meta     *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []scimValue `json:"members"`
+	Meta        *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimPatchRequest struct {
+	Operations []scimPatchOperation `json:"Operations" binding:"required"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+func respondSCIM(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+// respondSCIMError writes a SCIM error; scimType is one of the detail error
+// keywords of RFC 7644 section 3.12, or empty
+func respondSCIMError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	respondSCIM(c, status, body)
+}
+
+func (r *SCIMRoutes) serviceProviderConfig(c *gin.Context) {
+	respondSCIM(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "API key",
+			"description": "An API key of an admin service account, sent as a bearer token",
+		}},
+	})
+}
+
+// scimPage applies the startIndex (1-based) and count query parameters
+func scimPage[T any](c *gin.Context, resources []T) (scimListResponse, bool) {
+	startIndex, count := 1, scimMaxResults
+	if value := c.Query("startIndex"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			respondSCIMError(c, http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+			return scimListResponse{}, false
+		}
+		startIndex = max(n, 1)
+	}
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			respondSCIMError(c, http.StatusBadRequest, "invalidValue", "count must be a number")
+			return scimListResponse{}, false
+		}
+		count = min(max(n, 0), scimMaxResults)
+	}
+
+	from := min(startIndex-1, len(resources))
+	to := min(from+count, len(resources))
+	return scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: to - from,
+		Resources:    resources[from:to],
+	}, true
+}
+
+func parseSCIMFilter(c *gin.Context) (service.SCIMFilter, bool) {
+	filter, err := service.ParseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return nil, false
+	}
+	return filter, true
+}
+
+// Users
+
+func toSCIMUser(user *models.User) scimUser {
+	active := user.IsActive()
+	return scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       user.ID.String(),
+		UserName: user.Email,
+		Active:   &active,
+		Emails:   []scimValue{{Value: user.Email, Primary: true}},
+		Roles:    []scimValue{{Value: string(user.Role), Primary: true}},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimUsersLocation + user.ID.String(),
+		},
+	}
+}
+
+func scimUserAttributes(user *models.User) map[string][]string {
+	return map[string][]string{
+		"id":           {user.ID.String()},
+		"username":     {user.Email},
+		"emails":       {user.Email},
+		"emails.value": {user.Email},
+		"active":       {strconv.FormatBool(user.IsActive())},
+		"roles":        {string(user.Role)},
+		"roles.value":  {string(user.Role)},
+	}
+}
+
+// scimUserState holds the attributes SCIM can change
+type scimUserState struct {
+	email  string
+	role   models.Role
+	active bool
+}
+
+// findSCIMUser loads the user named by the :id parameter. Service accounts
+// are not provisioned through SCIM and are reported as not found.
+func (r *SCIMRoutes) findSCIMUser(c *gin.Context) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	user, err := r.userService.GetUserInOrganization(orgID, id)
+	if err != nil || user.ServiceAccount {
+		respondSCIMError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// findManageableSCIMUser is findSCIMUser for changes, with the rules of the
+// admin API: only super admins change super admins, nobody changes themselves
+func (r *SCIMRoutes) findManageableSCIMUser(c *gin.Context) (*models.User, bool) {
+	user, ok := r.findSCIMUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	current, _ := middleware.CurrentUser(c)
+	if user.SuperAdmin && (current == nil || !current.SuperAdmin) {
+		respondSCIMError(c, http.StatusForbidden, "", "Only super admins can manage super admins")
+		return nil, false
+	}
+	if current != nil && current.ID == user.ID {
+		respondSCIMError(c, http.StatusBadRequest, "mutability", "Cannot change your own account")
+		return nil, false
+	}
+	return user, true
+}
+
+func (r *SCIMRoutes) listUsers(c *gin.Context) {
+	filter, ok := parseSCIMFilter(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	users, err := r.userService.ListUsers(orgID)
+	if err != nil {
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	resources := []scimUser{}
+	for i := range users {
+		if !users[i].ServiceAccount && filter.Matches(scimUserAttributes(&users[i])) {
+			resources = append(resources, toSCIMUser(&users[i]))
+		}
+	}
+
+	list, ok := scimPage(c, resources)
+	if !ok {
+		return
+	}
+	respondSCIM(c, http.StatusOK, list)
+}
+
+func (r *SCIMRoutes) getUser(c *gin.Context) {
+	user, ok := r.findSCIMUser(c)
+	if !ok {
+		return
+	}
+	respondSCIM(c, http.StatusOK, toSCIMUser(user))
+}
+
+// bindSCIMUser reads a full user representation, keeping the current role
+// when none is given
+func bindSCIMUser(c *gin.Context, current scimUserState) (scimUser, scimUserState, bool) {
+	var input scimUser
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return input, current, false
+	}
+
+	state := scimUserState{email: input.UserName, role: current.role, active: true}
+	if input.Active != nil {
+		state.active = *input.Active
+	}
+	if len(input.Roles) > 0 {
+		state.role = primaryRole(input.Roles)
+	}
+	if !validSCIMUserState(c, state) {
+		return input, current, false
+	}
+	return input, state, true
+}
+
+func primaryRole(roles []scimValue) models.Role {
+	for _, role := range roles {
+		if role.Primary {
+			return models.Role(role.Value)
+		}
+	}
+	return models.Role(roles[0].Value)
+}
+
+func validSCIMUserState(c *gin.Context, state scimUserState) bool {
+	if _, err := mail.ParseAddress(state.email); err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		return false
+	}
+	if !state.role.IsValid() {
+		respondSCIMError(c, http.StatusBadRequest, "invalidValue", "Unknown role "+string(state.role))
+		return false
+	}
+	return true
+}
+
+func (r *SCIMRoutes) createUser(c *gin.Context) {
+	input, state, ok := bindSCIMUser(c, scimUserState{role: models.RoleUser})
+	if !ok {
+		return
+	}
+
+	if _, err := r.userService.GetUserByEmail(state.email); err == nil {
+		respondSCIMError(c, http.StatusConflict, "uniqueness", "userName is already taken")
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	var (
+		user *models.User
+		err  error
+	)
+	if input.Password != "" {
+		user, err = r.userService.CreateUser(orgID, state.email, input.Password, state.role)
+	} else {
+		user, err = r.userService.CreateExternalUser(orgID, state.email, state.role)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrWeakPassword) {
+			respondSCIMError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	if !state.active {
+		if user, err = r.userService.DeactivateUser(user.ID); err != nil {
+			respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+
+	c.Header("Location", scimUsersLocation+user.ID.String())
+	respondSCIM(c, http.StatusCreated, toSCIMUser(user))
+}
+
+func (r *SCIMRoutes) replaceUser(c *gin.Context) {
+	user, ok := r.findManageableSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	_, state, ok := bindSCIMUser(c, scimUserState{email: user.Email, role: user.Role, active: user.IsActive()})
+	if !ok {
+		return
+	}
+	r.applyUserState(c, user, state)
+}
+
+func (r *SCIMRoutes) patchUser(c *gin.Context) {
+	user, ok := r.findManageableSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	var input scimPatchRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	state := scimUserState{email: user.Email, role: user.Role, active: user.IsActive()}
+	for _, op := range input.Operations {
+		if err := patchUserState(&state, op); err != nil {
+			respondSCIMError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	if !validSCIMUserState(c, state) {
+		return
+	}
+	r.applyUserState(c, user, state)
+}
+
+// patchUserState applies one PATCH operation. Attributes the user model does
+// not hold, such as names, are ignored so directories can sync full profiles.
+func patchUserState(state *scimUserState, op scimPatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		if strings.EqualFold(op.Path, "roles") {
+			state.role = models.RoleUser
+		}
+		return nil
+	default:
+		return errors.New("unsupported operation " + op.Op)
+	}
+
+	values := map[string]json.RawMessage{}
+	if op.Path == "" {
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return errors.New("value must be an object when no path is given")
+		}
+	} else {
+		values[op.Path] = op.Value
+	}
+
+	for path, value := range values {
+		switch strings.ToLower(path) {
+		case "username":
+			if err := json.Unmarshal(value, &state.email); err != nil {
+				return errors.New("userName must be a string")
+			}
+		case "active":
+			active, err := parseSCIMBool(value)
+			if err != nil {
+				return err
+			}
+			state.active = active
+		case "roles":
+			var roles []scimValue
+			if err := json.Unmarshal(value, &roles); err != nil || len(roles) == 0 {
+				return errors.New("roles must be a list of values")
+			}
+			state.role = primaryRole(roles)
+		}
+	}
+	return nil
+}
+
+// parseSCIMBool accepts JSON booleans and, as some providers send them, the
+// strings "True" and "False"
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, errors.New("active must be a boolean")
+}
+
+// applyUserState saves the changed attributes. Deactivated users lose their
+// sessions and API keys, as with the admin API.
+func (r *SCIMRoutes) applyUserState(c *gin.Context, user *models.User, state scimUserState) {
+	var err error
+	if state.email != user.Email || state.role != user.Role {
+		if user, err = r.userService.UpdateUser(user.ID, state.email, state.role); err != nil {
+			if errors.Is(err, service.ErrEmailTaken) {
+				respondSCIMError(c, http.StatusConflict, "uniqueness", "userName is already taken")
+				return
+			}
+			respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+
+	switch {
+	case state.active && !user.IsActive():
+		user, err = r.userService.ReactivateUser(user.ID)
+	case !state.active && user.IsActive():
+		if user, err = r.userService.DeactivateUser(user.ID); err == nil {
+			err = r.revokeCredentials(user.ID)
+		}
+	}
+	if err != nil {
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	respondSCIM(c, http.StatusOK, toSCIMUser(user))
+}
+
+// deleteUser deactivates the user; like the admin API, SCIM never deletes
+// users outright
+func (r *SCIMRoutes) deleteUser(c *gin.Context) {
+	user, ok := r.findManageableSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	if user.Status != models.UserStatusDeactivated {
+		if _, err := r.userService.DeactivateUser(user.ID); err != nil {
+			respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if err := r.revokeCredentials(user.ID); err != nil {
+			respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeCredentials signs a deactivated user out and revokes their API keys
+func (r *SCIMRoutes) revokeCredentials(userID uuid.UUID) error {
+	if err := r.sessionService.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	return r.apiKeyService.RevokeUserKeys(userID)
+}
+
+// Groups
+
+func toSCIMGroup(team *models.Team) scimGroup {
+	members := make([]scimValue, len(team.Members))
+	for i, member := range team.Members {
+		members[i] = scimValue{Value: member.ID.String(), Display: member.Email, Ref: scimUsersLocation + member.ID.String()}
+	}
+	return scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          team.ID.String(),
+		DisplayName: team.Name,
+		Members:     members,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      team.CreatedAt,
+			LastModified: team.UpdatedAt,
+			Location:     scimGroupLocation + team.ID.String(),
+		},
+	}
+}
+
+func scimGroupAttributes(team *models.Team) map[string][]string {
+	members := make([]string, len(team.Members))
+	for i, member := range team.Members {
+		members[i] = member.ID.String()
+	}
+	return map[string][]string{
+		"id":            {team.ID.String()},
+		"displayname":   {team.Name},
+		"members":       members,
+		"members.value": members,
+	}
+}
+
+func (r *SCIMRoutes) findGroup(c *gin.Context) (*models.Team, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, http.StatusNotFound, "", "Group not found")
+		return nil, false
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.GetTeam(orgID, id)
+	if err != nil {
+		if errors.Is(err, service.ErrTeamNotFound) {
+			respondSCIMError(c, http.StatusNotFound, "", "Group not found")
+			return nil, false
+		}
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, false
+	}
+	return team, true
+}
+
+func (r *SCIMRoutes) listGroups(c *gin.Context) {
+	filter, ok := parseSCIMFilter(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	teams, err := r.teamService.ListTeamsWithMembers(orgID)
+	if err != nil {
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	resources := []scimGroup{}
+	for i := range teams {
+		if filter.Matches(scimGroupAttributes(&teams[i])) {
+			resources = append(resources, toSCIMGroup(&teams[i]))
+		}
+	}
+
+	list, ok := scimPage(c, resources)
+	if !ok {
+		return
+	}
+	respondSCIM(c, http.StatusOK, list)
+}
+
+func (r *SCIMRoutes) getGroup(c *gin.Context) {
+	team, ok := r.findGroup(c)
+	if !ok {
+		return
+	}
+	respondSCIM(c, http.StatusOK, toSCIMGroup(team))
+}
+
+func bindSCIMGroup(c *gin.Context) (string, []uuid.UUID, bool) {
+	var input scimGroup
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return "", nil, false
+	}
+	if input.DisplayName == "" {
+		respondSCIMError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return "", nil, false
+	}
+
+	members, err := scimMemberIDs(input.Members)
+	if err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return "", nil, false
+	}
+	return input.DisplayName, members, true
+}
+
+func scimMemberIDs(values []scimValue) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(values))
+	for i, value := range values {
+		id, err := uuid.Parse(value.Value)
+		if err != nil {
+			return nil, errors.New("invalid member " + value.Value)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func respondGroupNameError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrTeamNameTaken) {
+		respondSCIMError(c, http.StatusConflict, "uniqueness", "displayName is already taken")
+		return
+	}
+	respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+}
+
+func (r *SCIMRoutes) createGroup(c *gin.Context) {
+	name, members, ok := bindSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.CreateTeam(orgID, name, "")
+	if err != nil {
+		respondGroupNameError(c, err)
+		return
+	}
+	updated, err := r.teamService.SetMembers(orgID, team.ID, members)
+	if err != nil {
+		// Do not leave a group behind that the provider believes was not created
+		_ = r.teamService.DeleteTeam(orgID, team.ID)
+		respondTeamMembersError(c, err)
+		return
+	}
+
+	c.Header("Location", scimGroupLocation+updated.ID.String())
+	respondSCIM(c, http.StatusCreated, toSCIMGroup(updated))
+}
+
+func (r *SCIMRoutes) replaceGroup(c *gin.Context) {
+	team, ok := r.findGroup(c)
+	if !ok {
+		return
+	}
+
+	name, members, ok := bindSCIMGroup(c)
+	if !ok {
+		return
+	}
+	r.applyGroup(c, team, name, members)
+}
+
+// groupMemberFilter matches the PATCH path members[value eq "<id>"]
+var groupMemberFilter = regexp.MustCompile(`(?i)^members\[value eq "([^"]+)"\]$`)
+
+func (r *SCIMRoutes) patchGroup(c *gin.Context) {
+	team, ok := r.findGroup(c)
+	if !ok {
+		return
+	}
+
+	var input scimPatchRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondSCIMError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	name := team.Name
+	members := make([]uuid.UUID, len(team.Members))
+	for i, member := range team.Members {
+		members[i] = member.ID
+	}
+	for _, op := range input.Operations {
+		var err error
+		if name, members, err = patchGroupState(name, members, op); err != nil {
+			respondSCIMError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	r.applyGroup(c, team, name, members)
+}
+
+func patchGroupState(name string, members []uuid.UUID, op scimPatchOperation) (string, []uuid.UUID, error) {
+	operation := strings.ToLower(op.Op)
+	if operation == "remove" {
+		if match := groupMemberFilter.FindStringSubmatch(op.Path); match != nil {
+			id, err := uuid.Parse(match[1])
+			if err != nil {
+				return "", nil, errors.New("invalid member " + match[1])
+			}
+			return name, withoutIDs(members, []uuid.UUID{id}), nil
+		}
+		if !strings.EqualFold(op.Path, "members") {
+			return "", nil, errors.New("unsupported path " + op.Path)
+		}
+		if len(op.Value) == 0 {
+			return name, nil, nil
+		}
+		removed, err := decodeSCIMMembers(op.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, withoutIDs(members, removed), nil
+	}
+	if operation != "add" && operation != "replace" {
+		return "", nil, errors.New("unsupported operation " + op.Op)
+	}
+
+	values := map[string]json.RawMessage{}
+	if op.Path == "" {
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return "", nil, errors.New("value must be an object when no path is given")
+		}
+	} else {
+		values[op.Path] = op.Value
+	}
+
+	for path, value := range values {
+		switch strings.ToLower(path) {
+		case "displayname":
+			if err := json.Unmarshal(value, &name); err != nil || name == "" {
+				return "", nil, errors.New("displayName must be a non-empty string")
+			}
+		case "members":
+			ids, err := decodeSCIMMembers(value)
+			if err != nil {
+				return "", nil, err
+			}
+			if operation == "replace" {
+				members = ids
+			} else {
+				members = append(withoutIDs(members, ids), ids...)
+			}
+		}
+	}
+	return name, members, nil
+}
+
+func decodeSCIMMembers(value json.RawMessage) ([]uuid.UUID, error) {
+	var values []scimValue
+	if err := json.Unmarshal(value, &values); err != nil {
+		return nil, errors.New("members must be a list of values")
+	}
+	return scimMemberIDs(values)
+}
+
+func withoutIDs(ids, removed []uuid.UUID) []uuid.UUID {
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		keep := true
+		for _, r := range removed {
+			if id == r {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (r *SCIMRoutes) applyGroup(c *gin.Context, team *models.Team, name string, members []uuid.UUID) {
+	orgID, _ := middleware.CurrentOrganization(c)
+	if name != team.Name {
+		if _, err := r.teamService.UpdateTeam(orgID, team.ID, name, team.Description); err != nil {
+			respondGroupNameError(c, err)
+			return
+		}
+	}
+
+	team, err := r.teamService.SetMembers(orgID, team.ID, members)
+	if err != nil {
+		respondTeamMembersError(c, err)
+		return
+	}
+	respondSCIM(c, http.StatusOK, toSCIMGroup(team))
+}
+
+func respondTeamMembersError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrUserNotFound) {
+		respondSCIMError(c, http.StatusBadRequest, "invalidValue", "Every member must be a user of the organization")
+		return
+	}
+	respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+}
+
+func (r *SCIMRoutes) deleteGroup(c *gin.Context) {
+	team, ok := r.findGroup(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if err := r.teamService.DeleteTeam(orgID, team.ID); err != nil {
+		respondSCIMError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
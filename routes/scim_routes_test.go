@@ -0,0 +1,211 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scimListBody struct {
+	TotalResults int               `json:"totalResults"`
+	StartIndex   int               `json:"startIndex"`
+	ItemsPerPage int               `json:"itemsPerPage"`
+	Resources    []json.RawMessage `json:"Resources"`
+}
+
+func TestSCIMRoutes_Users(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.CreateServiceAccount(testOrgID, "ci@example.com", models.RoleAgent)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/scim/v2/Users", token, map[string]interface{}{
+		"schemas":  []string{scimUserSchema},
+		"userName": "jane@example.com",
+		"roles":    []map[string]interface{}{{"value": "agent", "primary": true}},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, scimContentType, w.Header().Get("Content-Type"))
+	var jane scimUser
+	json.Unmarshal(w.Body.Bytes(), &jane)
+	assert.Equal(t, "jane@example.com", jane.UserName)
+	assert.True(t, *jane.Active)
+	assert.Equal(t, "agent", jane.Roles[0].Value)
+
+	w = postWithToken(r, "/scim/v2/Users", token, map[string]interface{}{"userName": "jane@example.com"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"scimType":"uniqueness"`)
+	w = postWithToken(r, "/scim/v2/Users", token, map[string]interface{}{"userName": "john@example.com", "roles": []map[string]string{{"value": "root"}}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Service accounts are not provisioned through SCIM
+	w = getWithToken(r, "/scim/v2/Users", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list scimListBody
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Equal(t, 2, list.TotalResults)
+
+	w = getWithToken(r, `/scim/v2/Users?filter=userName%20eq%20%22JANE@example.com%22`, token)
+	json.Unmarshal(w.Body.Bytes(), &list)
+	require.Equal(t, 1, list.TotalResults)
+	assert.Contains(t, string(list.Resources[0]), jane.ID)
+
+	w = getWithToken(r, "/scim/v2/Users?startIndex=2&count=1", token)
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Equal(t, 2, list.TotalResults)
+	assert.Equal(t, 2, list.StartIndex)
+	assert.Equal(t, 1, list.ItemsPerPage)
+
+	w = getWithToken(r, "/scim/v2/Users?filter=userName%20gt%20%22a%22", token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalidFilter")
+
+	// Providers deactivate users with PATCH, some send booleans as strings
+	w = patchWithToken(r, "/scim/v2/Users/"+jane.ID, token, map[string]interface{}{
+		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]interface{}{{"op": "Replace", "path": "active", "value": "False"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":false`)
+	stored, err := userService.GetUserByEmail("jane@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.UserStatusDeactivated, stored.Status)
+
+	w = patchWithToken(r, "/scim/v2/Users/"+jane.ID, token, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "replace", "value": map[string]interface{}{"active": true, "userName": "jane.doe@example.com", "name": map[string]string{"givenName": "Jane"}}}},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"userName":"jane.doe@example.com"`)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+
+	w = putWithToken(r, "/scim/v2/Users/"+jane.ID, token, map[string]interface{}{"userName": "jane.doe@example.com", "roles": []map[string]string{{"value": "viewer"}}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"value":"viewer"`)
+	w = putWithToken(r, "/scim/v2/Users/"+jane.ID, token, map[string]interface{}{"userName": "admin@example.com"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"scimType":"uniqueness"`)
+
+	w = deleteWithToken(r, "/scim/v2/Users/"+jane.ID, token)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	stored, err = userService.GetUserByEmail("jane.doe@example.com")
+	require.NoError(t, err, "users are deactivated, not deleted")
+	assert.Equal(t, models.UserStatusDeactivated, stored.Status)
+
+	w = getWithToken(r, "/scim/v2/Users/not-a-uuid", token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSCIMRoutes_DeactivationRevokesAPIKeys(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	jane, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	createKey := func() string {
+		w := postWithToken(r, "/api/v1/api-keys", loginAs(t, r, "jane@example.com", "secret123"), map[string]interface{}{"name": "script", "scopes": []string{"ticket:read"}})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created struct {
+			Key string `json:"key"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created.Key
+	}
+	reactivate := func() {
+		w := patchWithToken(r, "/scim/v2/Users/"+jane.ID.String(), token, map[string]interface{}{
+			"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": true}},
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	key := createKey()
+	w := patchWithToken(r, "/scim/v2/Users/"+jane.ID.String(), token, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": false}},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	reactivate()
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(r, "/api/v1/me", key).Code)
+
+	key = createKey()
+	assert.Equal(t, http.StatusNoContent, deleteWithToken(r, "/scim/v2/Users/"+jane.ID.String(), token).Code)
+	reactivate()
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(r, "/api/v1/me", key).Code)
+}
+
+func TestSCIMRoutes_Groups(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	jane, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	john, err := userService.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	outsider, err := userService.CreateUser(uuid.New(), "outsider@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/scim/v2/Groups", token, map[string]interface{}{
+		"displayName": "Network",
+		"members":     []map[string]string{{"value": jane.ID.String()}},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var group scimGroup
+	json.Unmarshal(w.Body.Bytes(), &group)
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, "jane@example.com", group.Members[0].Display)
+
+	w = postWithToken(r, "/scim/v2/Groups", token, map[string]interface{}{"displayName": "Network"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = postWithToken(r, "/scim/v2/Groups", token, map[string]interface{}{
+		"displayName": "Billing",
+		"members":     []map[string]string{{"value": outsider.ID.String()}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = getWithToken(r, "/scim/v2/Groups?filter=displayName%20eq%20%22Billing%22", token)
+	assert.Contains(t, w.Body.String(), `"totalResults":0`, "a rejected group is not left behind")
+
+	w = patchWithToken(r, "/scim/v2/Groups/"+group.ID, token, map[string]interface{}{
+		"Operations": []map[string]interface{}{
+			{"op": "add", "path": "members", "value": []map[string]string{{"value": john.ID.String()}}},
+			{"op": "remove", "path": `members[value eq "` + jane.ID.String() + `"]`},
+			{"op": "replace", "path": "displayName", "value": "Networking"},
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &group)
+	assert.Equal(t, "Networking", group.DisplayName)
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, john.ID.String(), group.Members[0].Value)
+
+	w = getWithToken(r, "/scim/v2/Groups?filter=members.value%20eq%20%22"+john.ID.String()+"%22", token)
+	assert.Contains(t, w.Body.String(), `"totalResults":1`)
+
+	w = putWithToken(r, "/scim/v2/Groups/"+group.ID, token, map[string]interface{}{"displayName": "Networking", "members": []map[string]string{}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"members":[]`)
+
+	w = deleteWithToken(r, "/scim/v2/Groups/"+group.ID, token)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = getWithToken(r, "/scim/v2/Groups/"+group.ID, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSCIMRoutes_RequireAdmin(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	token := loginAs(t, r, "agent@example.com", "secret123")
+
+	w := getWithToken(r, "/scim/v2/Users", token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
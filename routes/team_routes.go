@@ -0,0 +1,226 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TeamRoutes struct {
+	teamService   *service.TeamService
+	userService   *service.UserService
+	ticketService service.TicketServiceInterface
+	auth          *middleware.AuthMiddleware
+}
+
+func NewTeamRoutes(teamService *service.TeamService, userService *service.UserService, ticketService service.TicketServiceInterface, auth *middleware.AuthMiddleware) *TeamRoutes {
+	return &TeamRoutes{
+		teamService:   teamService,
+		userService:   userService,
+		ticketService: ticketService,
+		auth:          auth,
+	}
+}
+
+func (r *TeamRoutes) Register(router *gin.Engine) {
+	teams := router.Group("/api/v1/teams")
+	teams.Use(r.auth.RequireAuth())
+
+	teams.GET("", r.listTeams)
+	teams.GET("/:id", r.getTeam)
+	teams.GET("/:id/tickets", r.auth.RequirePermission(models.PermissionTicketRead), r.getTeamTickets)
+
+	admin := router.Group("/api/v1/admin/teams")
+	admin.Use(r.auth.RequireAuth(), r.auth.RequireAdmin())
+
+	admin.POST("", r.createTeam)
+	admin.PUT("/:id", r.updateTeam)
+	admin.DELETE("/:id", r.deleteTeam)
+	admin.POST("/:id/members", r.addMember)
+	admin.DELETE("/:id/members/:userId", r.removeMember)
+}
+
+type teamInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+func (r *TeamRoutes) listTeams(c *gin.Context) {
+	orgID, _ := middleware.CurrentOrganization(c)
+	teams, err := r.teamService.ListTeams(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+func (r *TeamRoutes) getTeam(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.GetTeam(orgID, id)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func (r *TeamRoutes) getTeamTickets(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if _, err := r.teamService.GetTeam(orgID, id); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	tickets, err := r.ticketService.GetTicketsForTeam(orgID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+func (r *TeamRoutes) createTeam(c *gin.Context) {
+	var input teamInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.CreateTeam(orgID, input.Name, input.Description)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, team)
+}
+
+func (r *TeamRoutes) updateTeam(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	var input teamInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.UpdateTeam(orgID, id, input.Name, input.Description)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func (r *TeamRoutes) deleteTeam(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if err := r.teamService.DeleteTeam(orgID, id); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+func (r *TeamRoutes) addMember(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID uuid.UUID `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if _, err := r.userService.GetUserInOrganization(orgID, input.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	team, err := r.teamService.AddMember(orgID, id, input.UserID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func (r *TeamRoutes) removeMember(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.teamService.RemoveMember(orgID, id, userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func parseTeamID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondTeamError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+	if errors.Is(err, service.ErrTeamNameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"fix-ticket-system/config"
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTeamRouter(t *testing.T) (*gin.Engine, *service.UserService, *service.TicketService) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.RolePermission{}, &models.LoginThrottle{}, &models.Team{}, &models.Ticket{}, &models.Workflow{})
+	assert.NoError(t, err)
+	config.DB = db
+
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	rbacService := service.NewRBACService(db)
+	assert.NoError(t, rbacService.SeedDefaults())
+	auth := middleware.NewAuthMiddleware(userService, sessionService, rbacService, service.NewAPIKeyService(db), service.NewOrganizationService(db), service.NewAuditService(db), middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+	ticketService := service.NewTicketService()
+
+	r := gin.New()
+	NewAuthRoutes(userService, service.NewLocalAuthenticator(userService), sessionService, service.NewLoginThrottleService(db, service.DefaultLoginThrottleConfig), auth).Register(r)
+	NewTeamRoutes(service.NewTeamService(db), userService, ticketService, auth).Register(r)
+	return r, userService, ticketService
+}
+
+func TestTeamRoutes_AdminCRUDAndQueue(t *testing.T) {
+	r, userService, ticketService := setupTeamRouter(t)
+	admin, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	agent, err := userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	agentToken := loginAs(t, r, "agent@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/admin/teams", agentToken, map[string]string{"name": "Network"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postWithToken(r, "/api/v1/admin/teams", adminToken, map[string]string{"name": "Network", "description": "Routers"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var team models.Team
+	json.Unmarshal(w.Body.Bytes(), &team)
+
+	w = postWithToken(r, "/api/v1/admin/teams/"+team.ID.String()+"/members", adminToken, map[string]string{"user_id": agent.ID.String()})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "agent@example.com")
+
+	ticket, err := ticketService.CreateTicket(testOrgID, "Router down", "Description", admin.ID)
+	require.NoError(t, err)
+	_, err = ticketService.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, nil, &team.ID)
+	require.NoError(t, err)
+
+	w = getWithToken(r, "/api/v1/teams/"+team.ID.String()+"/tickets", agentToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var queue []models.Ticket
+	json.Unmarshal(w.Body.Bytes(), &queue)
+	require.Len(t, queue, 1)
+	assert.Equal(t, ticket.ID, queue[0].ID)
+
+	w = postWithToken(r, "/api/v1/admin/teams", adminToken, map[string]string{"name": "Network"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = postWithToken(r, "/api/v1/admin/teams", adminToken, map[string]string{"name": "Billing"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = putWithToken(r, "/api/v1/admin/teams/"+team.ID.String(), adminToken, map[string]string{"name": "Billing"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = putWithToken(r, "/api/v1/admin/teams/"+team.ID.String(), adminToken, map[string]string{"name": "Networking"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = deleteWithToken(r, "/api/v1/admin/teams/"+team.ID.String(), adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = getWithToken(r, "/api/v1/teams/"+team.ID.String()+"/tickets", agentToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TwoFactorRoutes struct {
+	totpService     *service.TOTPService
+	sessionService  *service.SessionService
+	throttleService *service.LoginThrottleService
+	auth            *middleware.AuthMiddleware
+}
+
+func NewTwoFactorRoutes(totpService *service.TOTPService, sessionService *service.SessionService, throttleService *service.LoginThrottleService, auth *middleware.AuthMiddleware) *TwoFactorRoutes {
+	return &TwoFactorRoutes{
+		totpService:     totpService,
+		sessionService:  sessionService,
+		throttleService: throttleService,
+		auth:            auth,
+	}
+}
+
+func (r *TwoFactorRoutes) Register(router *gin.Engine) {
+	twoFactor := router.Group("/api/v1/auth/2fa")
+	twoFactor.Use(r.auth.RequireAuth(), r.auth.DenyImpersonation())
+
+	twoFactor.POST("/enroll", r.enroll)
+	twoFactor.POST("/confirm", r.confirm)
+	twoFactor.POST("/verify", r.verify)
+	twoFactor.POST("/disable", r.disable)
+}
+
+type totpCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (r *TwoFactorRoutes) enroll(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	enrollment, err := r.totpService.Enroll(user.ID)
+	if err != nil {
+		respondTOTPError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (r *TwoFactorRoutes) confirm(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	var input totpCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := r.totpService.Confirm(user.ID, input.Code)
+	if err != nil {
+		respondTOTPError(c, err)
+		return
+	}
+
+	// The code just proved possession of the authenticator, so the session
+	// that enrolled it does not need to verify again
+	if sessionID, ok := currentSessionID(c); ok {
+		if err := r.sessionService.MarkMFAVerified(sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (r *TwoFactorRoutes) verify(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	sessionID, ok := currentSessionID(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor verification requires a login session"})
+		return
+	}
+
+	var input totpCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !r.checkCode(c, user.ID, func() error { return r.totpService.Verify(user.ID, input.Code) }) {
+		return
+	}
+
+	if err := r.sessionService.MarkMFAVerified(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor verification succeeded"})
+}
+
+func (r *TwoFactorRoutes) disable(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	var input totpCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !r.checkCode(c, user.ID, func() error { return r.totpService.Disable(user.ID, input.Code) }) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// checkCode runs a check of the user's two-factor or recovery code. Wrong
+// codes are counted, so codes cannot be guessed faster than the throttle
+// allows.
+func (r *TwoFactorRoutes) checkCode(c *gin.Context, userID uuid.UUID, check func() error) bool {
+	if err := r.throttleService.CheckTwoFactor(userID); err != nil {
+		respondThrottleError(c, err)
+		return false
+	}
+
+	err := check()
+	if errors.Is(err, service.ErrInvalidTOTPCode) {
+		if err := r.throttleService.RecordTwoFactorFailure(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	if err != nil {
+		respondTOTPError(c, err)
+		return false
+	}
+
+	if err := r.throttleService.UnlockTwoFactor(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// currentSessionID returns the login session of the request; API keys have none
+func currentSessionID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("session_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := value.(uuid.UUID)
+	return id, ok
+}
+
+func respondTOTPError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTOTPCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTOTPNotEnrolled), errors.Is(err, service.ErrTOTPAlreadyActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorRoutes_AdminStepUp(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/auth/2fa/enroll", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment service.TOTPEnrollment
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	assert.NotEmpty(t, enrollment.Secret)
+
+	step := time.Now().Unix() / 30
+	code, err := service.GenerateTOTP(enrollment.Secret, step)
+	require.NoError(t, err)
+	w = postWithToken(r, "/api/v1/auth/2fa/confirm", token, map[string]string{"code": code})
+	require.Equal(t, http.StatusOK, w.Code)
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &confirmed)
+	assert.Len(t, confirmed.RecoveryCodes, 10)
+
+	// The enrolling session is already verified
+	w = getWithToken(r, "/api/v1/admin/users", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A new session must step up before using admin endpoints
+	token = loginAs(t, r, "admin@example.com", "secret123")
+	w = getWithToken(r, "/api/v1/admin/users", token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "mfa_required")
+
+	w = postWithToken(r, "/api/v1/auth/2fa/verify", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "a used code must not be replayed")
+
+	w = postWithToken(r, "/api/v1/auth/2fa/verify", token, map[string]string{"code": confirmed.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = getWithToken(r, "/api/v1/admin/users", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTwoFactorRoutes_NotRequiredUntilEnabled(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/auth/2fa/verify", token, map[string]string{"code": "123456"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = getWithToken(r, "/api/v1/admin/users", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTwoFactorRoutes_ThrottlesWrongCodes(t *testing.T) {
+	r, userService := setupAuthRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	token := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/auth/2fa/enroll", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment service.TOTPEnrollment
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	code, err := service.GenerateTOTP(enrollment.Secret, time.Now().Unix()/30)
+	require.NoError(t, err)
+	w = postWithToken(r, "/api/v1/auth/2fa/confirm", token, map[string]string{"code": code})
+	require.Equal(t, http.StatusOK, w.Code)
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &confirmed)
+
+	// Wrong codes count against the user whichever endpoint they are sent to
+	token = loginAs(t, r, "admin@example.com", "secret123")
+	for i := 0; i <= service.DefaultLoginThrottleConfig.TwoFactorFreeAttempts; i++ {
+		path := "/api/v1/auth/2fa/verify"
+		if i%2 == 1 {
+			path = "/api/v1/auth/2fa/disable"
+		}
+		w = postWithToken(r, path, token, map[string]string{"code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Once locked out, not even a valid recovery code is checked
+	w = postWithToken(r, "/api/v1/auth/2fa/verify", token, map[string]string{"code": confirmed.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
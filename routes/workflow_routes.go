@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WorkflowRoutes struct {
+	workflowService *service.WorkflowService
+	ticketService   service.TicketServiceInterface
+	auth            *middleware.AuthMiddleware
+}
+
+func NewWorkflowRoutes(workflowService *service.WorkflowService, ticketService service.TicketServiceInterface, auth *middleware.AuthMiddleware) *WorkflowRoutes {
+	return &WorkflowRoutes{
+		workflowService: workflowService,
+		ticketService:   ticketService,
+		auth:            auth,
+	}
+}
+
+func (r *WorkflowRoutes) Register(router *gin.Engine) {
+	workflows := router.Group("/api/v1/workflows")
+	workflows.Use(r.auth.RequireAuth())
+
+	workflows.GET("", r.listWorkflows)
+	workflows.GET("/:id", r.getWorkflow)
+	router.GET("/api/v1/teams/:id/workflow", r.auth.RequireAuth(), r.getTeamWorkflow)
+
+	admin := router.Group("/api/v1/admin")
+	admin.Use(r.auth.RequireAuth(), r.auth.RequireAdmin())
+
+	admin.POST("/workflows", r.createWorkflow)
+	admin.PUT("/workflows/:id", r.updateWorkflow)
+	admin.DELETE("/workflows/:id", r.deleteWorkflow)
+	admin.PUT("/default-workflow", r.setDefaultWorkflow)
+	admin.PUT("/teams/:id/workflow", r.setTeamWorkflow)
+}
+
+type workflowInput struct {
+	Name        string                    `json:"name" binding:"required"`
+	Description string                    `json:"description"`
+	Statuses    []models.WorkflowStatus   `json:"statuses" binding:"required"`
+	Transitions []models.TicketTransition `json:"transitions"`
+}
+
+// workflowChoice picks a workflow; a null ID goes back to the default
+type workflowChoice struct {
+	WorkflowID *uuid.UUID `json:"workflow_id"`
+}
+
+func (r *WorkflowRoutes) listWorkflows(c *gin.Context) {
+	orgID, _ := middleware.CurrentOrganization(c)
+	workflows, err := r.workflowService.ListWorkflows(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflows)
+}
+
+func (r *WorkflowRoutes) getWorkflow(c *gin.Context) {
+	id, ok := parseWorkflowID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	workflow, err := r.workflowService.GetWorkflow(orgID, id)
+	if err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// getTeamWorkflow returns the workflow the team's tickets follow, which may be
+// the organization's default
+func (r *WorkflowRoutes) getTeamWorkflow(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	workflow, err := r.ticketService.GetWorkflow(orgID, &id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+func (r *WorkflowRoutes) createWorkflow(c *gin.Context) {
+	var input workflowInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	workflow, err := r.workflowService.CreateWorkflow(orgID, input.Name, input.Description, input.Statuses, input.Transitions)
+	if err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, workflow)
+}
+
+func (r *WorkflowRoutes) updateWorkflow(c *gin.Context) {
+	id, ok := parseWorkflowID(c)
+	if !ok {
+		return
+	}
+
+	var input workflowInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	workflow, err := r.workflowService.UpdateWorkflow(orgID, id, input.Name, input.Description, input.Statuses, input.Transitions)
+	if err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+func (r *WorkflowRoutes) deleteWorkflow(c *gin.Context) {
+	id, ok := parseWorkflowID(c)
+	if !ok {
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if err := r.workflowService.DeleteWorkflow(orgID, id); err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workflow deleted successfully"})
+}
+
+func (r *WorkflowRoutes) setDefaultWorkflow(c *gin.Context) {
+	var input workflowChoice
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	if err := r.workflowService.SetDefaultWorkflow(orgID, input.WorkflowID); err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+	workflow, err := r.ticketService.GetWorkflow(orgID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+func (r *WorkflowRoutes) setTeamWorkflow(c *gin.Context) {
+	id, ok := parseTeamID(c)
+	if !ok {
+		return
+	}
+
+	var input workflowChoice
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID, _ := middleware.CurrentOrganization(c)
+	team, err := r.workflowService.SetTeamWorkflow(orgID, id, input.WorkflowID)
+	if err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func parseWorkflowID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondWorkflowError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workflow not found"})
+	case errors.Is(err, service.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+	case errors.Is(err, service.ErrInvalidWorkflow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWorkflowInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"fix-ticket-system/config"
+	"fix-ticket-system/middleware"
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupWorkflowRouter(t *testing.T) (*gin.Engine, *service.UserService, *service.TeamService) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.RolePermission{}, &models.LoginThrottle{}, &models.Team{}, &models.Ticket{}, &models.Workflow{})
+	assert.NoError(t, err)
+	config.DB = db
+
+	userService := service.NewUserService(db, service.DefaultPasswordManager)
+	sessionService := service.NewSessionService(db)
+	rbacService := service.NewRBACService(db)
+	assert.NoError(t, rbacService.SeedDefaults())
+	auth := middleware.NewAuthMiddleware(userService, sessionService, rbacService, service.NewAPIKeyService(db), service.NewOrganizationService(db), service.NewAuditService(db), middleware.NewKeyRing(middleware.NewHMACKey(middleware.DefaultKeyID, []byte("test-secret"))))
+	teamService := service.NewTeamService(db)
+
+	r := gin.New()
+	NewAuthRoutes(userService, service.NewLocalAuthenticator(userService), sessionService, service.NewLoginThrottleService(db, service.DefaultLoginThrottleConfig), auth).Register(r)
+	NewWorkflowRoutes(service.NewWorkflowService(db), service.NewTicketService(), auth).Register(r)
+	return r, userService, teamService
+}
+
+func TestWorkflowRoutes_AdminManagesWorkflows(t *testing.T) {
+	r, userService, teamService := setupWorkflowRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = userService.CreateUser(testOrgID, "agent@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	team, err := teamService.CreateTeam(testOrgID, "Support", "")
+	require.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+	agentToken := loginAs(t, r, "agent@example.com", "secret123")
+
+	definition := map[string]interface{}{
+		"name": "Support",
+		"statuses": []map[string]string{
+			{"key": "triage", "name": "Triage", "category": "todo"},
+			{"key": "waiting_on_customer", "name": "Waiting on customer", "category": "in_progress"},
+			{"key": "done", "name": "Done", "category": "done"},
+		},
+		"transitions": []map[string]interface{}{
+			{"from": "triage", "to": "waiting_on_customer"},
+			{"from": "waiting_on_customer", "to": "done", "requires_assignee": true},
+		},
+	}
+	w := postWithToken(r, "/api/v1/admin/workflows", agentToken, definition)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postWithToken(r, "/api/v1/admin/workflows", adminToken, definition)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var workflow models.Workflow
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &workflow))
+	assert.Len(t, workflow.Statuses, 3)
+	assert.True(t, workflow.Transitions[1].RequiresAssignee)
+
+	w = getWithToken(r, "/api/v1/workflows", agentToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "waiting_on_customer")
+
+	// Teams follow the organization's default until they pick a workflow
+	w = getWithToken(r, "/api/v1/teams/"+team.ID.String()+"/workflow", agentToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key":"in_progress"`)
+
+	w = putWithToken(r, "/api/v1/admin/teams/"+team.ID.String()+"/workflow", adminToken, map[string]interface{}{"workflow_id": workflow.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = getWithToken(r, "/api/v1/teams/"+team.ID.String()+"/workflow", agentToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), workflow.ID.String())
+
+	w = deleteWithToken(r, "/api/v1/admin/workflows/"+workflow.ID.String(), adminToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = putWithToken(r, "/api/v1/admin/teams/"+team.ID.String()+"/workflow", adminToken, map[string]interface{}{"workflow_id": nil})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = putWithToken(r, "/api/v1/admin/default-workflow", adminToken, map[string]interface{}{"workflow_id": workflow.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_default":true`)
+	w = putWithToken(r, "/api/v1/admin/default-workflow", adminToken, map[string]interface{}{"workflow_id": nil})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Default"`)
+
+	definition["name"] = "Support desk"
+	w = putWithToken(r, "/api/v1/admin/workflows/"+workflow.ID.String(), adminToken, definition)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Support desk")
+
+	w = deleteWithToken(r, "/api/v1/admin/workflows/"+workflow.ID.String(), adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = getWithToken(r, "/api/v1/workflows/"+workflow.ID.String(), agentToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWorkflowRoutes_InvalidWorkflow(t *testing.T) {
+	r, userService, _ := setupWorkflowRouter(t)
+	_, err := userService.CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	adminToken := loginAs(t, r, "admin@example.com", "secret123")
+
+	w := postWithToken(r, "/api/v1/admin/workflows", adminToken, map[string]interface{}{
+		"name":     "Broken",
+		"statuses": []map[string]string{{"key": "todo", "name": "To do", "category": "todo"}},
+		"transitions": []map[string]interface{}{
+			{"from": "todo", "to": "done"},
+		},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown status")
+
+	w = putWithToken(r, "/api/v1/admin/default-workflow", adminToken, map[string]interface{}{"workflow_id": "00000000-0000-0000-0000-000000000001"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAPIKeyService(t *testing.T) *APIKeyService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.APIKey{})
+	assert.NoError(t, err)
+	return NewAPIKeyService(db)
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	svc := setupAPIKeyService(t)
+	userID := uuid.New()
+
+	key, raw, err := svc.CreateKey(userID, "ci", []models.Permission{models.PermissionTicketRead}, nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(raw, key.Prefix))
+	assert.NotContains(t, key.KeyHash, raw)
+
+	found, err := svc.Authenticate(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, []models.Permission{models.PermissionTicketRead}, found.Scopes)
+
+	_, err = svc.Authenticate(APIKeyPrefix + "unknown")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, _, err = svc.CreateKey(userID, "empty", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestAPIKeyService_RevokeAndExpire(t *testing.T) {
+	svc := setupAPIKeyService(t)
+	userID := uuid.New()
+
+	key, raw, _ := svc.CreateKey(userID, "ci", []models.Permission{models.PermissionTicketRead}, nil)
+	assert.NoError(t, svc.RevokeKey(key.ID))
+	_, err := svc.Authenticate(raw)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	past := time.Now().Add(-time.Hour)
+	_, raw, _ = svc.CreateKey(userID, "old", []models.Permission{models.PermissionTicketRead}, &past)
+	_, err = svc.Authenticate(raw)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	keys, err := svc.ListKeys(userID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record stores the event, assigning its ID
+func (s *AuditService) Record(event *models.AuditEvent) error {
+	event.ID = uuid.New()
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// SetStatus stores the response status of a recorded request
+func (s *AuditService) SetStatus(id uuid.UUID, status int) error {
+	if err := s.db.Model(&models.AuditEvent{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+		return fmt.Errorf("failed to update audit event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns the events of the organization, newest first, optionally
+// only those of one admin or one user acted as
+func (s *AuditService) ListEvents(orgID uuid.UUID, actorID, userID *uuid.UUID) ([]models.AuditEvent, error) {
+	query := s.db.Where("organization_id = ?", orgID)
+	if actorID != nil {
+		query = query.Where("actor_id = ?", *actorID)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("created_at DESC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
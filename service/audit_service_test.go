@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuditService_RecordAndList(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditEvent{}))
+	svc := NewAuditService(db)
+
+	admin, jane, john := uuid.New(), uuid.New(), uuid.New()
+	for _, userID := range []uuid.UUID{jane, john} {
+		require.NoError(t, svc.Record(&models.AuditEvent{OrganizationID: testOrgID, ActorID: admin, UserID: userID, Action: models.AuditActionImpersonationStart}))
+	}
+	request := &models.AuditEvent{OrganizationID: testOrgID, ActorID: admin, UserID: jane, Action: models.AuditActionImpersonationRequest, Method: "GET", Path: "/api/v1/me"}
+	require.NoError(t, svc.Record(request))
+	require.NoError(t, svc.SetStatus(request.ID, http.StatusOK))
+	require.NoError(t, svc.Record(&models.AuditEvent{OrganizationID: uuid.New(), ActorID: admin, UserID: jane, Action: models.AuditActionImpersonationStart}))
+
+	events, err := svc.ListEvents(testOrgID, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	events, err = svc.ListEvents(testOrgID, &admin, &jane)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		if event.ID == request.ID {
+			assert.Equal(t, http.StatusOK, event.Status)
+		}
+	}
+}
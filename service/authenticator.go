@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"fix-ticket-system/models"
+)
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// Authenticator checks a user's login credentials. Implementations return
+// ErrInvalidCredentials when the credentials are wrong and another error when
+// they could not be checked.
+type Authenticator interface {
+	Authenticate(email, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks passwords stored in the database
+type LocalAuthenticator struct {
+	userService *UserService
+}
+
+func NewLocalAuthenticator(userService *UserService) *LocalAuthenticator {
+	return &LocalAuthenticator{userService: userService}
+}
+
+func (a *LocalAuthenticator) Authenticate(email, password string) (*models.User, error) {
+	user, err := a.userService.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if user.ServiceAccount || !a.userService.CheckPassword(user, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ChainAuthenticator tries each authenticator in turn and returns the first
+// user authenticated. An authenticator that fails does not stop the chain, so
+// local accounts keep working while a directory is unreachable.
+type ChainAuthenticator struct {
+	authenticators []Authenticator
+}
+
+func NewChainAuthenticator(authenticators ...Authenticator) *ChainAuthenticator {
+	return &ChainAuthenticator{authenticators: authenticators}
+}
+
+func (a *ChainAuthenticator) Authenticate(email, password string) (*models.User, error) {
+	var failure error
+	for _, authenticator := range a.authenticators {
+		user, err := authenticator.Authenticate(email, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Warning: authentication of %s failed: %v", email, err)
+			if failure == nil {
+				failure = err
+			}
+		}
+	}
+
+	if failure != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", failure)
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+const defaultLDAPTimeout = 10 * time.Second
+
+// LDAPConfig describes the LDAP or Active Directory server users sign in with
+type LDAPConfig struct {
+	// URL of the server, ldap:// or ldaps://
+	URL string
+	// StartTLS upgrades ldap:// connections before any credentials are sent
+	StartTLS bool
+	// TLSConfig is used for ldaps:// and StartTLS; nil verifies the server
+	// against the system roots
+	TLSConfig *tls.Config
+	// BindDN and BindPassword are used to search the directory; leave both
+	// empty to search anonymously
+	BindDN       string
+	BindPassword string
+	// UserBaseDN is the subtree searched for users
+	UserBaseDN string
+	// UserFilter finds the entry of the user signing in. {email} is replaced
+	// by the email they signed in with and {username} by its part before the
+	// @, e.g. "(mail={email})" or "(sAMAccountName={username})".
+	UserFilter string
+	// EmailAttribute holds the user's email. Users whose entry lacks it keep
+	// the email they signed in with.
+	EmailAttribute string
+	// IDAttribute holds a stable ID of the user, e.g. objectGUID on Active
+	// Directory or entryUUID on OpenLDAP. Users are matched by their DN when
+	// it is empty.
+	IDAttribute string
+	// GroupBaseDN, when set, is searched with GroupFilter for the user's
+	// groups, where {dn} is replaced by the user's DN. Otherwise the groups
+	// are read from the user's GroupAttribute, e.g. memberOf.
+	GroupBaseDN    string
+	GroupFilter    string
+	GroupAttribute string
+	// RoleMapping maps groups, by common name or full DN, to roles. Groups
+	// are compared case-insensitively; when several match, the role listed
+	// first in models.AllRoles wins.
+	RoleMapping map[string]models.Role
+	// DefaultRole is given to new users none of whose groups are mapped
+	DefaultRole models.Role
+	// Timeout bounds connecting to and every request sent to the server
+	Timeout time.Duration
+}
+
+// LDAPAuthenticator checks passwords by binding as the user. Users are created
+// in the organization on their first login and their role follows their
+// groups. Logins only ever reach users created from the same directory entry;
+// a directory email that belongs to another user fails the login.
+type LDAPAuthenticator struct {
+	config         LDAPConfig
+	userService    *UserService
+	organizationID uuid.UUID
+	roleMapping    map[string]models.Role
+}
+
+func NewLDAPAuthenticator(config LDAPConfig, userService *UserService, organizationID uuid.UUID) *LDAPAuthenticator {
+	if config.UserFilter == "" {
+		config.UserFilter = "(mail={email})"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = "(member={dn})"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = models.RoleUser
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultLDAPTimeout
+	}
+
+	roleMapping := make(map[string]models.Role, len(config.RoleMapping))
+	for group, role := range config.RoleMapping {
+		roleMapping[strings.ToLower(group)] = role
+	}
+
+	return &LDAPAuthenticator{
+		config:         config,
+		userService:    userService,
+		organizationID: organizationID,
+		roleMapping:    roleMapping,
+	}
+}
+
+func (a *LDAPAuthenticator) Authenticate(email, password string) (*models.User, error) {
+	// Most servers accept a bind without password as anonymous
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindSearcher(conn); err != nil {
+		return nil, err
+	}
+	entry, err := a.findUser(conn, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as user: %w", err)
+	}
+
+	// Search groups with the same rights as the user search
+	if err := a.bindSearcher(conn); err != nil {
+		return nil, err
+	}
+	groups, err := a.findGroups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+	role, mapped := mapGroupsToRole(a.roleMapping, a.config.DefaultRole, groups)
+
+	if directoryEmail := entry.GetAttributeValue(a.config.EmailAttribute); directoryEmail != "" {
+		email = directoryEmail
+	}
+	subject, err := a.subject(entry)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.userService.ProvisionExternalUser(a.organizationID, ExternalLogin{
+		Issuer:     a.config.URL,
+		Subject:    subject,
+		Email:      email,
+		Role:       role,
+		UpdateRole: mapped,
+	})
+	if errors.Is(err, ErrExternalIdentityConflict) {
+		log.Printf("Warning: LDAP user %s cannot sign in: %v", entry.DN, err)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.ServiceAccount {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// subject returns the stable ID users are matched by: the hex encoded
+// IDAttribute, or the DN
+func (a *LDAPAuthenticator) subject(entry *ldap.Entry) (string, error) {
+	if a.config.IDAttribute == "" {
+		return strings.ToLower(entry.DN), nil
+	}
+	id := entry.GetRawAttributeValue(a.config.IDAttribute)
+	if len(id) == 0 {
+		return "", fmt.Errorf("LDAP entry %s has no %s", entry.DN, a.config.IDAttribute)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	tlsConfig := a.config.TLSConfig
+	if tlsConfig == nil {
+		parsed, err := url.Parse(a.config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+		}
+		tlsConfig = &tls.Config{ServerName: parsed.Hostname()}
+	}
+
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.config.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(a.config.Timeout)
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) bindSearcher(conn *ldap.Conn) error {
+	var err error
+	if a.config.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(a.config.BindDN, a.config.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind to LDAP server: %w", err)
+	}
+	return nil
+}
+
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, email string) (*ldap.Entry, error) {
+	username, _, _ := strings.Cut(email, "@")
+	filter := strings.NewReplacer(
+		"{email}", ldap.EscapeFilter(email),
+		"{username}", ldap.EscapeFilter(username),
+	).Replace(a.config.UserFilter)
+
+	attributes := []string{a.config.EmailAttribute, a.config.GroupAttribute}
+	if a.config.IDAttribute != "" {
+		attributes = append(attributes, a.config.IDAttribute)
+	}
+	entries, err := a.search(conn, a.config.UserBaseDN, filter, attributes, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search LDAP users: %w", err)
+	}
+	// An ambiguous filter must not let one user sign in as another
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return entries[0], nil
+}
+
+// findGroups returns the common name and DN of every group of the user, in
+// lower case
+func (a *LDAPAuthenticator) findGroups(conn *ldap.Conn, user *ldap.Entry) ([]string, error) {
+	groupDNs := user.GetAttributeValues(a.config.GroupAttribute)
+	if a.config.GroupBaseDN != "" {
+		filter := strings.ReplaceAll(a.config.GroupFilter, "{dn}", ldap.EscapeFilter(user.DN))
+		entries, err := a.search(conn, a.config.GroupBaseDN, filter, []string{"dn"}, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search LDAP groups: %w", err)
+		}
+		groupDNs = nil
+		for _, entry := range entries {
+			groupDNs = append(groupDNs, entry.DN)
+		}
+	}
+
+	var groups []string
+	for _, dn := range groupDNs {
+		groups = append(groups, strings.ToLower(dn))
+		if parsed, err := ldap.ParseDN(dn); err == nil && len(parsed.RDNs) > 0 && len(parsed.RDNs[0].Attributes) > 0 {
+			groups = append(groups, strings.ToLower(parsed.RDNs[0].Attributes[0].Value))
+		}
+	}
+	return groups, nil
+}
+
+func (a *LDAPAuthenticator) search(conn *ldap.Conn, baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		sizeLimit, int(a.config.Timeout.Seconds()), false,
+		filter, attributes, nil,
+	))
+	if err != nil {
+		// Some servers report an empty result as a missing base
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && result != nil {
+			return result.Entries, nil
+		}
+		return nil, err
+	}
+	return result.Entries, nil
+}
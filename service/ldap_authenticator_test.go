@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/jimlambrt/gldap/testdirectory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLDAPBindDN = "cn=ticket-system,ou=people,dc=example,dc=org"
+
+// startTestDirectory runs an in-process LDAP server with a service account,
+// jane in the "support" group and bob in no group
+func startTestDirectory(t *testing.T) *testdirectory.Directory {
+	users := []*gldap.Entry{
+		gldap.NewEntry(testLDAPBindDN, map[string][]string{"password": {"service-secret"}}),
+	}
+	users = append(users, testdirectory.NewUsers(t, []string{"jane"},
+		testdirectory.WithMembersOf(t, testdirectory.NewMemberOf(t, []string{"support"})...))...)
+	users = append(users, testdirectory.NewUsers(t, []string{"bob"})...)
+
+	return testdirectory.Start(t,
+		testdirectory.WithNoTLS(t),
+		testdirectory.WithDefaults(t, &testdirectory.Defaults{
+			Users:  users,
+			Groups: []*gldap.Entry{testdirectory.NewGroup(t, "support", []string{"jane"})},
+		}),
+	)
+}
+
+func newTestLDAPAuthenticator(d *testdirectory.Directory, userService *UserService, groupBaseDN string) *LDAPAuthenticator {
+	return NewLDAPAuthenticator(LDAPConfig{
+		URL:            fmt.Sprintf("ldap://%s:%d", d.Host(), d.Port()),
+		BindDN:         testLDAPBindDN,
+		BindPassword:   "service-secret",
+		UserBaseDN:     testdirectory.DefaultUserDN,
+		UserFilter:     "(cn={username})",
+		EmailAttribute: "email",
+		GroupBaseDN:    groupBaseDN,
+		RoleMapping:    map[string]models.Role{"Support": models.RoleAgent},
+		DefaultRole:    models.RoleRequester,
+	}, userService, testOrgID)
+}
+
+func TestLDAPAuthenticator_Authenticate(t *testing.T) {
+	d := startTestDirectory(t)
+
+	for name, groupBaseDN := range map[string]string{"memberOf": "", "group search": testdirectory.DefaultGroupDN} {
+		t.Run(name, func(t *testing.T) {
+			users := setupUserService(t)
+			authenticator := newTestLDAPAuthenticator(d, users, groupBaseDN)
+
+			user, err := authenticator.Authenticate("jane@example.com", "password")
+			require.NoError(t, err)
+			assert.Equal(t, "jane@example.com", user.Email)
+			assert.Equal(t, testOrgID, user.OrganizationID)
+			assert.Equal(t, models.RoleAgent, user.Role)
+
+			// The same user signs in again
+			again, err := authenticator.Authenticate("jane@example.com", "password")
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, again.ID)
+
+			bob, err := authenticator.Authenticate("bob@example.com", "password")
+			require.NoError(t, err)
+			assert.Equal(t, models.RoleRequester, bob.Role)
+		})
+	}
+}
+
+func TestLDAPAuthenticator_RejectsInvalidCredentials(t *testing.T) {
+	d := startTestDirectory(t)
+	users := setupUserService(t)
+	authenticator := newTestLDAPAuthenticator(d, users, "")
+
+	_, err := authenticator.Authenticate("jane@example.com", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authenticator.Authenticate("jane@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authenticator.Authenticate("nobody@example.com", "password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = users.GetUserByEmail("jane@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound, "users are only created once they signed in")
+
+	// Service accounts never sign in, not even through the directory
+	_, err = users.CreateServiceAccount(testOrgID, "jane@example.com", models.RoleAgent)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate("jane@example.com", "password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestLDAPAuthenticator_OnlyReachesDirectoryUsers(t *testing.T) {
+	d := startTestDirectory(t)
+	users := setupUserService(t)
+	authenticator := newTestLDAPAuthenticator(d, users, "")
+	authenticator.config.IDAttribute = "name"
+
+	jane, err := authenticator.Authenticate("jane@example.com", "password")
+	require.NoError(t, err)
+	require.NotNil(t, jane.ExternalSubject)
+	assert.Equal(t, hex.EncodeToString([]byte("jane")), *jane.ExternalSubject)
+
+	// Accounts sharing a directory email are left alone, whether local or
+	// provisioned from elsewhere
+	local, err := users.CreateUser(testOrgID, "bob@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate("bob@example.com", "password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	unchanged, err := users.GetUserByID(local.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, unchanged.Role)
+	assert.Nil(t, unchanged.ExternalSubject)
+
+	require.NoError(t, users.db.Delete(local).Error)
+	_, err = users.CreateExternalUser(testOrgID, "bob@example.com", models.RoleAdmin)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate("bob@example.com", "password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChainAuthenticator_FallsBackToLocalAccounts(t *testing.T) {
+	d := startTestDirectory(t)
+	users := setupUserService(t)
+	_, err := users.CreateUser(testOrgID, "root@example.com", "break-glass", models.RoleAdmin)
+	require.NoError(t, err)
+
+	unreachable := NewLDAPAuthenticator(LDAPConfig{URL: "ldap://127.0.0.1:1", UserBaseDN: testdirectory.DefaultUserDN}, users, testOrgID)
+	chain := NewChainAuthenticator(NewLocalAuthenticator(users), unreachable)
+
+	user, err := chain.Authenticate("root@example.com", "break-glass")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+
+	// A directory that cannot be reached is an error, not a wrong password
+	_, err = chain.Authenticate("jane@example.com", "password")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+
+	chain = NewChainAuthenticator(NewLocalAuthenticator(users), newTestLDAPAuthenticator(d, users, ""))
+	_, err = chain.Authenticate("jane@example.com", "password")
+	assert.NoError(t, err)
+	_, err = chain.Authenticate("root@example.com", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
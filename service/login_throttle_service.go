@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fix-ticket-system/metrics"
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginThrottleConfig controls when failed logins start to be delayed
+type LoginThrottleConfig struct {
+	// AccountFreeAttempts and IPFreeAttempts are the failures allowed before backoff starts
+	AccountFreeAttempts int
+	IPFreeAttempts      int
+	// TwoFactorFreeAttempts are the wrong two-factor or recovery codes a user
+	// may enter before backoff starts
+	TwoFactorFreeAttempts int
+	// ResetEmailFreeRequests and ResetIPFreeRequests are the password reset
+	// requests allowed before backoff starts
+	ResetEmailFreeRequests int
+	ResetIPFreeRequests    int
+	// BaseDelay is the lockout after the first failure past the free attempts;
+	// it doubles with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter forgets failures once no new failure happened for this long
+	ResetAfter time.Duration
+}
+
+// DefaultLoginThrottleConfig allows a few typos per account and more per IP,
+// since many users may share an address
+var DefaultLoginThrottleConfig = LoginThrottleConfig{
+	AccountFreeAttempts:    5,
+	IPFreeAttempts:         20,
+	TwoFactorFreeAttempts:  5,
+	ResetEmailFreeRequests: 3,
+	ResetIPFreeRequests:    20,
+	BaseDelay:              time.Second,
+	MaxDelay:               15 * time.Minute,
+	ResetAfter:             time.Hour,
+}
+
+// LoginThrottledError is returned while an account or IP is locked out
+type LoginThrottledError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	switch e.Scope {
+	case twoFactorScope:
+		return fmt.Sprintf("too many invalid two-factor codes, retry in %s", e.RetryAfter.Round(time.Second))
+	case resetEmailScope, resetIPScope:
+		return fmt.Sprintf("too many password reset requests, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts for this %s, retry in %s", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+type LoginThrottleService struct {
+	db     *gorm.DB
+	config LoginThrottleConfig
+	now    func() time.Time
+}
+
+func NewLoginThrottleService(db *gorm.DB, config LoginThrottleConfig) *LoginThrottleService {
+	return &LoginThrottleService{db: db, config: config, now: time.Now}
+}
+
+const (
+	// twoFactorScope throttles the two-factor codes of one user
+	twoFactorScope = "two_factor"
+	// resetEmailScope and resetIPScope throttle password reset requests for an
+	// email and from an IP
+	resetEmailScope = "reset_email"
+	resetIPScope    = "reset_ip"
+)
+
+// Check returns a *LoginThrottledError when the account or IP is locked out
+func (s *LoginThrottleService) Check(email, ip string) error {
+	if err := s.check("account", accountKey(email)); err != nil {
+		return err
+	}
+	return s.check("ip", ipKey(ip))
+}
+
+// CheckTwoFactor returns a *LoginThrottledError while the user may not enter
+// two-factor or recovery codes
+func (s *LoginThrottleService) CheckTwoFactor(userID uuid.UUID) error {
+	return s.check(twoFactorScope, twoFactorKey(userID))
+}
+
+func (s *LoginThrottleService) check(scope, key string) error {
+	now := s.now()
+	throttle, err := s.get(key)
+	if err != nil {
+		return err
+	}
+	if throttle != nil && throttle.IsLocked(now) {
+		metrics.LoginLockedTotal.WithLabelValues(scope).Inc()
+		return &LoginThrottledError{Scope: scope, RetryAfter: throttle.LockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// CheckPasswordReset returns a *LoginThrottledError while no further password
+// reset may be requested for the email or from the IP
+func (s *LoginThrottleService) CheckPasswordReset(email, ip string) error {
+	if err := s.check(resetEmailScope, resetEmailKey(email)); err != nil {
+		return err
+	}
+	return s.check(resetIPScope, resetIPKey(ip))
+}
+
+// RecordPasswordReset counts a password reset request for the email and from
+// the IP, whether or not the email has an account
+func (s *LoginThrottleService) RecordPasswordReset(email, ip string) error {
+	if err := s.recordFailure(resetEmailKey(email), s.config.ResetEmailFreeRequests); err != nil {
+		return err
+	}
+	return s.recordFailure(resetIPKey(ip), s.config.ResetIPFreeRequests)
+}
+
+// RecordFailure counts a failed login and locks the account or IP once it has
+// used up its free attempts
+func (s *LoginThrottleService) RecordFailure(email, ip string) error {
+	metrics.LoginFailuresTotal.WithLabelValues("invalid_credentials").Inc()
+	if err := s.recordFailure(accountKey(email), s.config.AccountFreeAttempts); err != nil {
+		return err
+	}
+	return s.recordFailure(ipKey(ip), s.config.IPFreeAttempts)
+}
+
+// RecordTwoFactorFailure counts a wrong two-factor or recovery code and locks
+// the user's codes once the free attempts are used up
+func (s *LoginThrottleService) RecordTwoFactorFailure(userID uuid.UUID) error {
+	metrics.LoginFailuresTotal.WithLabelValues("invalid_two_factor_code").Inc()
+	return s.recordFailure(twoFactorKey(userID), s.config.TwoFactorFreeAttempts)
+}
+
+// UnlockTwoFactor clears the two-factor failures and lockout of the user
+func (s *LoginThrottleService) UnlockTwoFactor(userID uuid.UUID) error {
+	if err := s.db.Delete(&models.LoginThrottle{}, "throttle_key = ?", twoFactorKey(userID)).Error; err != nil {
+		return fmt.Errorf("failed to unlock two-factor codes: %w", err)
+	}
+	return nil
+}
+
+// RecordSuccess clears the failures of the account. IP failures are kept so a
+// successful login to one account does not reset an attack on others.
+func (s *LoginThrottleService) RecordSuccess(email string) error {
+	return s.Unlock(email)
+}
+
+// Unlock clears the failures and lockout of the account
+func (s *LoginThrottleService) Unlock(email string) error {
+	if err := s.db.Delete(&models.LoginThrottle{}, "throttle_key = ?", accountKey(email)).Error; err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	return nil
+}
+
+// recordFailure counts the failure in a single upsert so concurrent failures
+// neither lose counts nor race to create the row, then locks the key based on
+// the count it returned
+func (s *LoginThrottleService) recordFailure(key string, freeAttempts int) error {
+	now := s.now()
+	resetBefore := now.Add(-s.config.ResetAfter)
+
+	var throttle models.LoginThrottle
+	err := s.db.Raw(`INSERT INTO login_throttles (throttle_key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			locked_until = CASE WHEN login_throttles.last_failure_at < ? THEN NULL ELSE login_throttles.locked_until END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING throttle_key, failures, last_failure_at, locked_until`,
+		key, now, resetBefore, resetBefore).Scan(&throttle).Error
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+	if throttle.Failures <= freeAttempts {
+		return nil
+	}
+
+	// A concurrent failure that counted higher sets its own, longer lockout
+	lockedUntil := now.Add(s.backoff(throttle.Failures - freeAttempts))
+	err = s.db.Model(&models.LoginThrottle{}).
+		Where("throttle_key = ? AND failures = ?", key, throttle.Failures).
+		Update("locked_until", lockedUntil).Error
+	if err != nil {
+		return fmt.Errorf("failed to lock login throttle: %w", err)
+	}
+	return nil
+}
+
+// backoff returns BaseDelay doubled for every failure past the first, capped at MaxDelay
+func (s *LoginThrottleService) backoff(excess int) time.Duration {
+	delay := s.config.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if delay >= s.config.MaxDelay {
+			return s.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (s *LoginThrottleService) get(key string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	if err := s.db.First(&throttle, "throttle_key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	return &throttle, nil
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func twoFactorKey(userID uuid.UUID) string {
+	return "2fa:" + userID.String()
+}
+
+func resetEmailKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func resetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
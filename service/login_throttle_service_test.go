@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fix-ticket-system/models"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupLoginThrottleService(t *testing.T) (*LoginThrottleService, *time.Time) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.LoginThrottle{})
+	assert.NoError(t, err)
+
+	svc := NewLoginThrottleService(db, LoginThrottleConfig{
+		AccountFreeAttempts:   2,
+		IPFreeAttempts:        4,
+		TwoFactorFreeAttempts: 1,
+		BaseDelay:             time.Second,
+		MaxDelay:              4 * time.Second,
+		ResetAfter:            time.Hour,
+	})
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+	return svc, &now
+}
+
+// openFileDB returns a migrated database in a file rather than in memory, so
+// concurrent requests run on separate connections
+func openFileDB(t *testing.T, models ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	return db
+}
+
+func retryAfter(t *testing.T, err error) time.Duration {
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("expected LoginThrottledError, got %v", err)
+	}
+	return throttled.RetryAfter
+}
+
+func TestLoginThrottleService_AccountBackoff(t *testing.T) {
+	svc, now := setupLoginThrottleService(t)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, svc.RecordFailure("user@example.com", "10.0.0.1"))
+	}
+	assert.NoError(t, svc.Check("user@example.com", "10.0.0.1"))
+
+	// Past the free attempts the delay doubles up to the maximum
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for _, want := range expected {
+		assert.NoError(t, svc.RecordFailure("User@Example.com", "10.0.0.1"))
+		assert.Equal(t, want, retryAfter(t, svc.Check("user@example.com", "10.0.0.2")))
+	}
+
+	*now = now.Add(5 * time.Second)
+	assert.NoError(t, svc.Check("user@example.com", "10.0.0.2"))
+
+	assert.NoError(t, svc.RecordFailure("user@example.com", "10.0.0.1"))
+	assert.Error(t, svc.Check("user@example.com", "10.0.0.2"))
+	assert.NoError(t, svc.Unlock("user@example.com"))
+	assert.NoError(t, svc.Check("user@example.com", "10.0.0.2"))
+}
+
+func TestLoginThrottleService_IPLockout(t *testing.T) {
+	svc, _ := setupLoginThrottleService(t)
+
+	// Spraying many accounts from one address locks the address
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		assert.NoError(t, svc.RecordFailure(email, "10.0.0.1"))
+	}
+
+	var throttled *LoginThrottledError
+	assert.True(t, errors.As(svc.Check("new@example.com", "10.0.0.1"), &throttled))
+	assert.Equal(t, "ip", throttled.Scope)
+	assert.NoError(t, svc.Check("new@example.com", "10.0.0.2"))
+
+	// Logging in successfully elsewhere does not clear the address
+	assert.NoError(t, svc.RecordSuccess("new@example.com"))
+	assert.Error(t, svc.Check("new@example.com", "10.0.0.1"))
+}
+
+func TestLoginThrottleService_ResetAfterQuietPeriod(t *testing.T) {
+	svc, now := setupLoginThrottleService(t)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, svc.RecordFailure("user@example.com", "10.0.0.1"))
+	}
+	assert.Error(t, svc.Check("user@example.com", "10.0.0.1"))
+
+	*now = now.Add(2 * time.Hour)
+	assert.NoError(t, svc.RecordFailure("user@example.com", "10.0.0.1"))
+	assert.NoError(t, svc.Check("user@example.com", "10.0.0.1"))
+}
+
+func TestLoginThrottleService_ConcurrentFailures(t *testing.T) {
+	db := openFileDB(t, &models.LoginThrottle{})
+	svc := NewLoginThrottleService(db, DefaultLoginThrottleConfig)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, svc.RecordFailure("user@example.com", "10.0.0.1"))
+		}()
+	}
+	wg.Wait()
+
+	// Every failure counts, including the ones that raced to create the row
+	var account, ip models.LoginThrottle
+	assert.NoError(t, db.First(&account, "throttle_key = ?", accountKey("user@example.com")).Error)
+	assert.Equal(t, 10, account.Failures)
+	assert.True(t, account.IsLocked(time.Now()))
+	assert.NoError(t, db.First(&ip, "throttle_key = ?", ipKey("10.0.0.1")).Error)
+	assert.Equal(t, 10, ip.Failures)
+}
+
+func TestLoginThrottleService_TwoFactor(t *testing.T) {
+	svc, now := setupLoginThrottleService(t)
+	userID := uuid.New()
+
+	assert.NoError(t, svc.RecordTwoFactorFailure(userID))
+	assert.NoError(t, svc.CheckTwoFactor(userID))
+	assert.NoError(t, svc.RecordTwoFactorFailure(userID))
+	assert.Equal(t, time.Second, retryAfter(t, svc.CheckTwoFactor(userID)))
+
+	// Two-factor failures do not lock the user's password logins, or others' codes
+	assert.NoError(t, svc.Check("jane@example.com", "10.0.0.1"))
+	assert.NoError(t, svc.CheckTwoFactor(uuid.New()))
+
+	*now = now.Add(time.Second)
+	assert.NoError(t, svc.CheckTwoFactor(userID))
+	assert.NoError(t, svc.RecordTwoFactorFailure(userID))
+	assert.Equal(t, 2*time.Second, retryAfter(t, svc.CheckTwoFactor(userID)))
+
+	assert.NoError(t, svc.UnlockTwoFactor(userID))
+	assert.NoError(t, svc.CheckTwoFactor(userID))
+}
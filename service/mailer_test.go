@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sinkMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPSink runs a minimal SMTP server on localhost that records every
+// message it receives
+func startSMTPSink(t *testing.T) (string, <-chan sinkMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan sinkMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- sinkMessage) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP sink")
+
+	var msg sinkMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = sinkMessage{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.data = strings.Join(lines, "\n")
+			messages <- msg
+			tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	addr, messages := startSMTPSink(t)
+	mailer := NewSMTPMailer(addr, "no-reply@example.com", "", "")
+
+	err := mailer.Send("jane@example.com", "Hello", "line one\nline two")
+	require.NoError(t, err)
+
+	msg := <-messages
+	assert.Equal(t, "no-reply@example.com", msg.from)
+	assert.Equal(t, []string{"jane@example.com"}, msg.to)
+	assert.Contains(t, msg.data, "Subject: Hello\n")
+	assert.Contains(t, msg.data, "To: jane@example.com\n")
+	assert.Contains(t, msg.data, "line one\nline two")
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer("127.0.0.1:1", "no-reply@example.com", "", "")
+	err := mailer.Send("jane@example.com\r\nBcc: attacker@example.com", "Hello", "body")
+	assert.Error(t, err)
+}
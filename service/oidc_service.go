@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCLoginTTL bounds how long a user may take to complete the provider login
+const OIDCLoginTTL = 10 * time.Minute
+
+var ErrInvalidOIDCState = errors.New("invalid or expired OIDC state")
+
+// OIDCConfig describes the OpenID Connect provider used for single sign-on
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// GroupsClaim names the ID token claim listing the user's groups
+	GroupsClaim string
+	// RoleMapping maps provider groups to roles. When several groups match,
+	// the role listed first in models.AllRoles wins.
+	RoleMapping map[string]models.Role
+	// DefaultRole is given to new users none of whose groups are mapped
+	DefaultRole models.Role
+	// StateSecret signs the pending login kept by the browser. Instances
+	// behind the same callback URL must share it.
+	StateSecret []byte
+}
+
+// ParseRoleMapping parses "group=role,group=role" into a role mapping
+func ParseRoleMapping(value string) (map[string]models.Role, error) {
+	mapping := make(map[string]models.Role)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || !models.Role(role).IsValid() {
+			return nil, fmt.Errorf("invalid role mapping %q", pair)
+		}
+		mapping[group] = models.Role(role)
+	}
+	return mapping, nil
+}
+
+// OIDCIdentity is the verified identity returned by the provider
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Groups  []string
+	Role    models.Role
+	// RoleMapped is false when Role is only the configured default
+	RoleMapped bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcPendingLogin is what the callback needs to complete a login. It is kept
+// by the browser that started the login, signed, so no instance has to
+// remember it and only that browser can complete it.
+type oidcPendingLogin struct {
+	state    string
+	nonce    string
+	verifier string
+}
+
+type OIDCService struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewOIDCService(config OIDCConfig, httpClient *http.Client) *OIDCService {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = models.RoleUser
+	}
+	return &OIDCService{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+// SecureCookies reports whether the login cookie should only be sent over
+// HTTPS, which is the case when the callback is served over HTTPS
+func (s *OIDCService) SecureCookies() bool {
+	return strings.HasPrefix(s.config.RedirectURL, "https://")
+}
+
+// AuthCodeURL starts a login and returns the provider URL to redirect the user
+// to, along with the signed login the browser must present to Exchange. It
+// expires after OIDCLoginTTL.
+func (s *OIDCService) AuthCodeURL(ctx context.Context) (authURL, login string, err error) {
+	discovery, err := s.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	if len(s.config.StateSecret) == 0 {
+		return "", "", errors.New("OIDC state secret is not configured")
+	}
+
+	login, err = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(OIDCLoginTTL).Unix(),
+	}).SignedString(s.config.StateSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign OIDC login: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.config.ClientID},
+		"redirect_uri":          {s.config.RedirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), login, nil
+}
+
+// Exchange redeems the authorization code and returns the verified identity.
+// login is the value returned by AuthCodeURL to the browser completing the
+// login; its state must match the one the provider sent back.
+func (s *OIDCService) Exchange(ctx context.Context, code, state, login string) (*OIDCIdentity, error) {
+	pending, err := s.parseLogin(login)
+	if err != nil || subtle.ConstantTimeCompare([]byte(pending.state), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	discovery, err := s.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"client_id":     {s.config.ClientID},
+		"client_secret": {s.config.ClientSecret},
+		"code_verifier": {pending.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to exchange code: provider returned %s", resp.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return s.verifyIDToken(ctx, tokens.IDToken, pending.nonce)
+}
+
+func (s *OIDCService) parseLogin(login string) (*oidcPendingLogin, error) {
+	token, err := jwt.Parse(login, func(*jwt.Token) (interface{}, error) {
+		return s.config.StateSecret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid OIDC login claims")
+	}
+	pending := &oidcPendingLogin{}
+	pending.state, _ = claims["state"].(string)
+	pending.nonce, _ = claims["nonce"].(string)
+	pending.verifier, _ = claims["verifier"].(string)
+	if pending.state == "" || pending.nonce == "" || pending.verifier == "" {
+		return nil, errors.New("incomplete OIDC login")
+	}
+	return pending, nil
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.getKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(s.config.Issuer),
+		jwt.WithAudience(s.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid ID token claims")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{Issuer: s.config.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, errors.New("ID token has no sub claim")
+	}
+	identity.Email, _ = claims["email"].(string)
+	if identity.Email == "" {
+		return nil, errors.New("ID token has no email claim")
+	}
+	// Providers that do not vouch for the email could hand out anyone's
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, errors.New("email address is not verified by the provider")
+	}
+
+	if groups, ok := claims[s.config.GroupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if name, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	}
+	identity.Role, identity.RoleMapped = s.mapRole(identity.Groups)
+
+	return identity, nil
+}
+
+// mapRole picks the most privileged role mapped from the user's groups
+func (s *OIDCService) mapRole(groups []string) (models.Role, bool) {
+	return mapGroupsToRole(s.config.RoleMapping, s.config.DefaultRole, groups)
+}
+
+// mapGroupsToRole picks the most privileged role mapped from the groups,
+// reporting false when none is mapped and the default role is returned
+func mapGroupsToRole(mapping map[string]models.Role, defaultRole models.Role, groups []string) (models.Role, bool) {
+	granted := make(map[models.Role]bool)
+	for _, g := range groups {
+		if role, ok := mapping[g]; ok {
+			granted[role] = true
+		}
+	}
+	for _, role := range models.AllRoles {
+		if granted[role] {
+			return role, true
+		}
+	}
+	return defaultRole, false
+}
+
+func (s *OIDCService) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	cached := s.discovery
+	s.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := s.getJSON(ctx, strings.TrimSuffix(s.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	if discovery.Issuer != s.config.Issuer {
+		return nil, fmt.Errorf("OIDC issuer mismatch: got %q", discovery.Issuer)
+	}
+
+	s.mu.Lock()
+	s.discovery = &discovery
+	s.mu.Unlock()
+	return &discovery, nil
+}
+
+// getKey returns the provider key with the given ID, refetching the JWKS once
+// when the ID is unknown so provider key rotation is picked up
+func (s *OIDCService) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	discovery, err := s.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := s.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
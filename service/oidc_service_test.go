@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockIdP is a minimal OpenID provider that issues ID tokens for a fixed user
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            "ticket-system",
+			"sub":            "user-123",
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"nonce":          idp.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	return idp
+}
+
+func (idp *mockIdP) newService() *OIDCService {
+	return NewOIDCService(OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    "ticket-system",
+		RedirectURL: "http://localhost/callback",
+		RoleMapping: map[string]models.Role{"support": models.RoleAgent, "it-admins": models.RoleAdmin},
+		StateSecret: []byte("state-secret"),
+	}, idp.server.Client())
+}
+
+// authorize follows the redirect URL the way a browser would and returns the state
+func (idp *mockIdP) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+	return q.Get("state")
+}
+
+func TestOIDCService_Exchange(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.claims = jwt.MapClaims{"groups": []string{"support", "it-admins"}}
+	svc := idp.newService()
+
+	authURL, login, err := svc.AuthCodeURL(context.Background())
+	require.NoError(t, err)
+	state := idp.authorize(t, authURL)
+
+	identity, err := svc.Exchange(context.Background(), "valid-code", state, login)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", identity.Email)
+	assert.Equal(t, idp.server.URL, identity.Issuer)
+	assert.Equal(t, "user-123", identity.Subject)
+	assert.Equal(t, models.RoleAdmin, identity.Role)
+	assert.True(t, identity.RoleMapped)
+
+}
+
+func TestOIDCService_LoginBoundToBrowser(t *testing.T) {
+	idp := newMockIdP(t)
+	svc := idp.newService()
+
+	authURL, login, err := svc.AuthCodeURL(context.Background())
+	require.NoError(t, err)
+	state := idp.authorize(t, authURL)
+	_, otherLogin, err := svc.AuthCodeURL(context.Background())
+	require.NoError(t, err)
+
+	// The state must come with the login of the browser that started it
+	_, err = svc.Exchange(context.Background(), "valid-code", state, "")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	_, err = svc.Exchange(context.Background(), "valid-code", state, otherLogin)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	_, err = svc.Exchange(context.Background(), "valid-code", state, login+"x")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+
+	// Logins signed by another instance's secret or expired are refused
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state": state, "nonce": idp.nonce, "verifier": "guessed", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("another-secret"))
+	require.NoError(t, err)
+	_, err = svc.Exchange(context.Background(), "valid-code", state, forged)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state": state, "nonce": idp.nonce, "verifier": "guessed", "exp": time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte("state-secret"))
+	require.NoError(t, err)
+	_, err = svc.Exchange(context.Background(), "valid-code", state, expired)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+
+	// Any instance sharing the secret completes the login
+	identity, err := idp.newService().Exchange(context.Background(), "valid-code", state, login)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", identity.Email)
+}
+
+func TestOIDCService_DefaultRole(t *testing.T) {
+	idp := newMockIdP(t)
+	svc := idp.newService()
+
+	authURL, login, err := svc.AuthCodeURL(context.Background())
+	require.NoError(t, err)
+	identity, err := svc.Exchange(context.Background(), "valid-code", idp.authorize(t, authURL), login)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, identity.Role)
+	assert.False(t, identity.RoleMapped)
+}
+
+func TestOIDCService_RejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{name: "Wrong audience", claims: jwt.MapClaims{"aud": "another-client"}},
+		{name: "Wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{name: "Expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "Wrong nonce", claims: jwt.MapClaims{"nonce": "replayed"}},
+		{name: "Unverified email", claims: jwt.MapClaims{"email_verified": false}},
+		{name: "Email verification missing", claims: jwt.MapClaims{"email_verified": nil}},
+		{name: "No subject", claims: jwt.MapClaims{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = tt.claims
+			svc := idp.newService()
+
+			authURL, login, err := svc.AuthCodeURL(context.Background())
+			require.NoError(t, err)
+			_, err = svc.Exchange(context.Background(), "valid-code", idp.authorize(t, authURL), login)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseRoleMapping(t *testing.T) {
+	mapping, err := ParseRoleMapping("support=agent, it-admins=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.Role{"support": models.RoleAgent, "it-admins": models.RoleAdmin}, mapping)
+
+	_, err = ParseRoleMapping("support=superuser")
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationNotEmpty = errors.New("organization still has users or tickets")
+)
+
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+func NewOrganizationService(db *gorm.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+func (s *OrganizationService) CreateOrganization(name string) (*models.Organization, error) {
+	org := &models.Organization{
+		ID:   uuid.New(),
+		Name: name,
+	}
+
+	if err := s.db.Create(org).Error; err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return org, nil
+}
+
+// EnsureOrganization returns the organization with the name, creating it if needed
+func (s *OrganizationService) EnsureOrganization(name string) (*models.Organization, error) {
+	var org models.Organization
+	err := s.db.First(&org, "name = ?", name).Error
+	if err == nil {
+		return &org, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return s.CreateOrganization(name)
+}
+
+func (s *OrganizationService) GetOrganization(id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	if err := s.db.First(&org, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &org, nil
+}
+
+func (s *OrganizationService) ListOrganizations() ([]models.Organization, error) {
+	var orgs []models.Organization
+	if err := s.db.Order("name").Find(&orgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+func (s *OrganizationService) RenameOrganization(id uuid.UUID, name string) (*models.Organization, error) {
+	org, err := s.GetOrganization(id)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Name = name
+	if err := s.db.Save(org).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	return org, nil
+}
+
+// DeleteOrganization removes an organization without users or tickets, along
+// with its teams
+func (s *OrganizationService) DeleteOrganization(id uuid.UUID) error {
+	org, err := s.GetOrganization(id)
+	if err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{&models.User{}, &models.Ticket{}} {
+		var count int64
+		if err := s.db.Model(model).Where("organization_id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count organization data: %w", err)
+		}
+		if count > 0 {
+			return ErrOrganizationNotEmpty
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Delete(&models.Team{}).Error; err != nil {
+			return fmt.Errorf("failed to delete teams: %w", err)
+		}
+		if err := tx.Delete(org).Error; err != nil {
+			return fmt.Errorf("failed to delete organization: %w", err)
+		}
+		return nil
+	})
+}
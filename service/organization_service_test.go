@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupOrganizationService(t *testing.T) (*OrganizationService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	err = db.AutoMigrate(&models.Organization{}, &models.User{}, &models.Ticket{}, &models.Team{})
+	require.NoError(t, err)
+	return NewOrganizationService(db), db
+}
+
+func TestOrganizationService_CRUD(t *testing.T) {
+	svc, _ := setupOrganizationService(t)
+
+	acme, err := svc.CreateOrganization("Acme")
+	require.NoError(t, err)
+	_, err = svc.CreateOrganization("Acme")
+	assert.Error(t, err)
+
+	ensured, err := svc.EnsureOrganization("Acme")
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, ensured.ID)
+	globex, err := svc.EnsureOrganization("Globex")
+	require.NoError(t, err)
+
+	renamed, err := svc.RenameOrganization(acme.ID, "Acme Corp")
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Corp", renamed.Name)
+
+	orgs, err := svc.ListOrganizations()
+	require.NoError(t, err)
+	require.Len(t, orgs, 2)
+	assert.Equal(t, "Acme Corp", orgs[0].Name)
+
+	require.NoError(t, svc.DeleteOrganization(globex.ID))
+	_, err = svc.GetOrganization(globex.ID)
+	assert.ErrorIs(t, err, ErrOrganizationNotFound)
+	assert.ErrorIs(t, svc.DeleteOrganization(globex.ID), ErrOrganizationNotFound)
+}
+
+func TestOrganizationService_DeleteRefusesNonEmpty(t *testing.T) {
+	svc, db := setupOrganizationService(t)
+	org, err := svc.CreateOrganization("Acme")
+	require.NoError(t, err)
+	_, err = NewUserService(db, DefaultPasswordManager).CreateUser(org.ID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.DeleteOrganization(org.ID), ErrOrganizationNotEmpty)
+	_, err = svc.GetOrganization(org.ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into self-describing PHC strings, e.g.
+// "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>"
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Identifies reports whether the hash was produced by this algorithm
+	Identifies(encoded string) bool
+	Verify(password, encoded string) bool
+	// NeedsRehash reports whether the hash was produced with other parameters
+	// than the hasher is configured with
+	NeedsRehash(encoded string) bool
+	// MaxPasswordBytes is the longest password the algorithm can hash, 0 for
+	// no limit
+	MaxPasswordBytes() int
+}
+
+// Argon2idParams are the cost parameters of Argon2id hashes
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation for Argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, candidate) == 1
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err != nil || params != h.params
+}
+
+func (h *Argon2idHasher) MaxPasswordBytes() int {
+	return 0
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>"
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher reads and writes the "$2a$<cost>$..." hashes stored before
+// Argon2id became the default
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// MaxPasswordBytes is 72, as bcrypt refuses longer passwords
+func (h *BcryptHasher) MaxPasswordBytes() int {
+	return 72
+}
+
+// PasswordManager checks new passwords against the policy, hashes them with the
+// preferred hasher and verifies hashes of every configured hasher
+type PasswordManager struct {
+	policy  *PasswordPolicy
+	hashers []PasswordHasher
+}
+
+func NewPasswordManager(policy *PasswordPolicy, preferred PasswordHasher, others ...PasswordHasher) *PasswordManager {
+	return &PasswordManager{policy: policy, hashers: append([]PasswordHasher{preferred}, others...)}
+}
+
+// DefaultPasswordManager hashes with Argon2id and still accepts bcrypt hashes
+var DefaultPasswordManager = NewPasswordManager(&DefaultPasswordPolicy, NewArgon2idHasher(DefaultArgon2idParams), NewBcryptHasher(bcrypt.DefaultCost))
+
+// Validate returns an error wrapping ErrWeakPassword when the password violates
+// the policy or is too long for the preferred hasher
+func (m *PasswordManager) Validate(password string) error {
+	if err := m.policy.Validate(password); err != nil {
+		return err
+	}
+	if limit := m.hashers[0].MaxPasswordBytes(); limit > 0 && len(password) > limit {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, limit)
+	}
+	return nil
+}
+
+func (m *PasswordManager) Hash(password string) (string, error) {
+	return m.hashers[0].Hash(password)
+}
+
+// Verify checks the password against the hash. rehash is set when the password
+// matched but the hash should be replaced, because it was produced by another
+// algorithm or with outdated parameters.
+func (m *PasswordManager) Verify(password, encoded string) (ok, rehash bool) {
+	for i, hasher := range m.hashers {
+		if !hasher.Identifies(encoded) {
+			continue
+		}
+		if !hasher.Verify(password, encoded) {
+			return false, false
+		}
+		return true, i > 0 || hasher.NeedsRehash(encoded)
+	}
+	return false, false
+}
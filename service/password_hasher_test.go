@@ -0,0 +1,76 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := NewArgon2idHasher(DefaultArgon2idParams)
+
+	hash, err := hasher.Hash("secret123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.True(t, hasher.Identifies(hash))
+	assert.True(t, hasher.Verify("secret123", hash))
+	assert.False(t, hasher.Verify("wrong", hash))
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	again, err := hasher.Hash("secret123")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again, "every hash has its own salt")
+
+	stronger := DefaultArgon2idParams
+	stronger.Iterations = 3
+	assert.True(t, NewArgon2idHasher(stronger).NeedsRehash(hash))
+	assert.True(t, NewArgon2idHasher(stronger).Verify("secret123", hash), "hashes are verified with their own parameters")
+
+	assert.False(t, hasher.Verify("secret123", "$argon2id$v=19$m=19456,t=2,p=1$not-base64!$"))
+}
+
+func TestPasswordManager_Verify(t *testing.T) {
+	argon2id := NewArgon2idHasher(DefaultArgon2idParams)
+	legacy := NewBcryptHasher(bcrypt.MinCost)
+	manager := NewPasswordManager(&DefaultPasswordPolicy, argon2id, legacy)
+
+	current, err := manager.Hash("secret123")
+	require.NoError(t, err)
+	ok, rehash := manager.Verify("secret123", current)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// Hashes of another algorithm are accepted but should be upgraded
+	old, err := legacy.Hash("secret123")
+	require.NoError(t, err)
+	ok, rehash = manager.Verify("secret123", old)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, rehash = manager.Verify("wrong", old)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	ok, _ = manager.Verify("secret123", "plain-text")
+	assert.False(t, ok)
+}
+
+func TestPasswordManager_HasherLength(t *testing.T) {
+	argon2id := NewArgon2idHasher(DefaultArgon2idParams)
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost)
+	long := strings.Repeat("a", 100)
+
+	// The policy allows 128 characters, bcrypt only hashes 72 bytes
+	assert.NoError(t, NewPasswordManager(&DefaultPasswordPolicy, argon2id, bcryptHasher).Validate(long))
+	manager := NewPasswordManager(&DefaultPasswordPolicy, bcryptHasher, argon2id)
+	assert.ErrorIs(t, manager.Validate(long), ErrWeakPassword)
+	assert.ErrorIs(t, manager.Validate(strings.Repeat("ü", 37)), ErrWeakPassword)
+
+	password := strings.Repeat("a", 72)
+	require.NoError(t, manager.Validate(password))
+	_, err := manager.Hash(password)
+	assert.NoError(t, err)
+}
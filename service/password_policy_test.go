@@ -0,0 +1,36 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy_Length(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 12}
+
+	assert.ErrorIs(t, policy.Validate("short"), ErrWeakPassword)
+	assert.ErrorIs(t, policy.Validate("much-too-long-password"), ErrWeakPassword)
+	assert.NoError(t, policy.Validate("secret123"))
+	// Length counts characters, not bytes
+	assert.NoError(t, policy.Validate("пароль12"))
+}
+
+func TestPasswordPolicy_BreachList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// "password1" as plain text, "letmein123" as a Have I Been Pwned SHA-1 line
+	list := "password1\r\n\n" + sha1Hex("letmein123") + ":1024\n"
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+
+	policy := DefaultPasswordPolicy
+	require.NoError(t, policy.LoadBreachList(path))
+
+	assert.EqualError(t, policy.Validate("password1"), "password does not meet the password policy: appears in a list of breached passwords")
+	assert.ErrorIs(t, policy.Validate("letmein123"), ErrWeakPassword)
+	assert.NoError(t, policy.Validate("secret123"))
+
+	assert.Error(t, policy.LoadBreachList(filepath.Join(t.TempDir(), "missing.txt")))
+}
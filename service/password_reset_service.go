@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordResetTTL is how long a mailed reset link stays valid
+const PasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+type PasswordResetService struct {
+	db        *gorm.DB
+	mailer    Mailer
+	passwords *PasswordManager
+	resetURL  string
+	now       func() time.Time
+}
+
+// NewPasswordResetService mails links to resetURL with the token appended as
+// the "token" query parameter
+func NewPasswordResetService(db *gorm.DB, mailer Mailer, passwords *PasswordManager, resetURL string) *PasswordResetService {
+	return &PasswordResetService{db: db, mailer: mailer, passwords: passwords, resetURL: resetURL, now: time.Now}
+}
+
+// RequestReset mails a reset link to the user with the email. Unknown emails,
+// service accounts and inactive users are silently ignored so the caller
+// cannot tell which addresses have an account.
+func (s *PasswordResetService) RequestReset(email string) error {
+	var user models.User
+	if err := s.db.First(&user, "email = ?", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	// Users without a local password sign in through their identity provider,
+	// which manages their credentials
+	if user.ServiceAccount || !user.IsActive() || !user.HasLocalPassword() {
+		return nil
+	}
+
+	token, err := randomString(32)
+	if err != nil {
+		return err
+	}
+
+	reset := &models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: s.now().Add(PasswordResetTTL),
+	}
+	if err := s.db.Create(reset).Error; err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your account.\n\n"+
+		"Open the link below within %s to choose a new password:\n\n%s\n\n"+
+		"If you did not request this, you can ignore this email.\n",
+		PasswordResetTTL, s.link(token))
+	return s.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword sets a new password with a mailed token and returns the user
+// whose password changed. The token and any other outstanding tokens of the
+// user are used up. A password violating the policy leaves the token usable.
+func (s *PasswordResetService) ResetPassword(token, newPassword string) (uuid.UUID, error) {
+	if err := s.passwords.Validate(newPassword); err != nil {
+		return uuid.Nil, err
+	}
+	hash, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var userID uuid.UUID
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.First(&reset, "token_hash = ?", hashToken(token)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("failed to get password reset token: %w", err)
+		}
+		now := s.now()
+		if !reset.IsUsable(now) {
+			return ErrInvalidResetToken
+		}
+
+		// Guard against the same token being redeemed concurrently
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return fmt.Errorf("failed to use password reset token: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		// The user may have been handed to an identity provider since the token
+		// was mailed
+		result = tx.Model(&models.User{}).Where("id = ? AND password <> ''", reset.UserID).Update("password", hash)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update password: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		userID = reset.UserID
+		return nil
+	})
+	return userID, err
+}
+
+func (s *PasswordResetService) link(token string) string {
+	u, err := url.Parse(s.resetURL)
+	if err != nil {
+		return s.resetURL + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
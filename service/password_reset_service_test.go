@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var resetTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func setupPasswordResetService(t *testing.T) (*PasswordResetService, *UserService, <-chan sinkMessage) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.PasswordResetToken{})
+	assert.NoError(t, err)
+
+	addr, messages := startSMTPSink(t)
+	svc := NewPasswordResetService(db, NewSMTPMailer(addr, "no-reply@example.com", "", ""), DefaultPasswordManager, "https://tickets.example.com/reset?lang=en")
+	return svc, NewUserService(db, DefaultPasswordManager), messages
+}
+
+func mailedResetToken(t *testing.T, messages <-chan sinkMessage) string {
+	select {
+	case msg := <-messages:
+		assert.Contains(t, msg.data, "https://tickets.example.com/reset?lang=en&token=")
+		match := resetTokenPattern.FindStringSubmatch(msg.data)
+		require.Len(t, match, 2)
+		return match[1]
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset mail was sent")
+		return ""
+	}
+}
+
+func TestPasswordResetService_ResetIsSingleUse(t *testing.T) {
+	svc, userService, messages := setupPasswordResetService(t)
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RequestReset("jane@example.com"))
+	token := mailedResetToken(t, messages)
+
+	// A password rejected by the policy does not use up the token
+	_, err = svc.ResetPassword(token, "short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	userID, err := svc.ResetPassword(token, "newsecret")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	updated, err := userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.True(t, userService.CheckPassword(updated, "newsecret"))
+
+	_, err = svc.ResetPassword(token, "another-secret")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordResetService_TokenExpires(t *testing.T) {
+	svc, userService, messages := setupPasswordResetService(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RequestReset("jane@example.com"))
+	token := mailedResetToken(t, messages)
+
+	svc.now = func() time.Time { return time.Now().Add(PasswordResetTTL + time.Minute) }
+	_, err = svc.ResetPassword(token, "newsecret")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordResetService_ResetUsesUpOlderTokens(t *testing.T) {
+	svc, userService, messages := setupPasswordResetService(t)
+	_, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RequestReset("jane@example.com"))
+	first := mailedResetToken(t, messages)
+	require.NoError(t, svc.RequestReset("jane@example.com"))
+	second := mailedResetToken(t, messages)
+
+	_, err = svc.ResetPassword(second, "newsecret")
+	require.NoError(t, err)
+	_, err = svc.ResetPassword(first, "another-secret")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordResetService_UnknownEmailSendsNothing(t *testing.T) {
+	svc, userService, messages := setupPasswordResetService(t)
+	_, err := userService.CreateServiceAccount(testOrgID, "bot@example.com", models.RoleAgent)
+	require.NoError(t, err)
+
+	assert.NoError(t, svc.RequestReset("nobody@example.com"))
+	assert.NoError(t, svc.RequestReset("bot@example.com"))
+	assert.Empty(t, messages)
+
+	_, err = svc.ResetPassword("not-a-token", "newsecret")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordResetService_SkipsExternalUsers(t *testing.T) {
+	svc, userService, messages := setupPasswordResetService(t)
+	_, err := userService.CreateExternalUser(testOrgID, "sso@example.com", models.RoleUser)
+	require.NoError(t, err)
+	assert.NoError(t, svc.RequestReset("sso@example.com"))
+	assert.Empty(t, messages)
+
+	// A token mailed before the user was handed to an identity provider no
+	// longer sets a password
+	user, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	require.NoError(t, err)
+	require.NoError(t, svc.RequestReset("jane@example.com"))
+	token := mailedResetToken(t, messages)
+	require.NoError(t, svc.db.Model(user).Update("password", "").Error)
+
+	_, err = svc.ResetPassword(token, "newsecret")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+	found, err := userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.False(t, found.HasLocalPassword())
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+
+	"fix-ticket-system/models"
+
+	"gorm.io/gorm"
+)
+
+type RBACService struct {
+	db *gorm.DB
+}
+
+func NewRBACService(db *gorm.DB) *RBACService {
+	return &RBACService{db: db}
+}
+
+// SeedDefaults stores models.DefaultRolePermissions when no mapping exists yet
+func (s *RBACService) SeedDefaults() error {
+	var count int64
+	if err := s.db.Model(&models.RolePermission{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count role permissions: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for role, permissions := range models.DefaultRolePermissions {
+		if _, err := s.SetRolePermissions(role, permissions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PermissionsForRole returns the permissions granted to the role
+func (s *RBACService) PermissionsForRole(role models.Role) ([]models.Permission, error) {
+	var mappings []models.RolePermission
+	if err := s.db.Where("role = ?", role).Order("permission").Find(&mappings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	permissions := make([]models.Permission, 0, len(mappings))
+	for _, m := range mappings {
+		permissions = append(permissions, m.Permission)
+	}
+	return permissions, nil
+}
+
+// ListRolePermissions returns the permissions of every known role
+func (s *RBACService) ListRolePermissions() (map[models.Role][]models.Permission, error) {
+	result := make(map[models.Role][]models.Permission, len(models.AllRoles))
+	for _, role := range models.AllRoles {
+		permissions, err := s.PermissionsForRole(role)
+		if err != nil {
+			return nil, err
+		}
+		result[role] = permissions
+	}
+	return result, nil
+}
+
+// SetRolePermissions replaces the permissions granted to the role
+func (s *RBACService) SetRolePermissions(role models.Role, permissions []models.Permission) ([]models.Permission, error) {
+	if !role.IsValid() {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	for _, p := range permissions {
+		if !p.IsValid() {
+			return nil, fmt.Errorf("unknown permission %q", p)
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		seen := make(map[models.Permission]bool, len(permissions))
+		for _, p := range permissions {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			if err := tx.Create(&models.RolePermission{Role: role, Permission: p}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set role permissions: %w", err)
+	}
+
+	return s.PermissionsForRole(role)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRBACService(t *testing.T) *RBACService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.RolePermission{})
+	assert.NoError(t, err)
+	return NewRBACService(db)
+}
+
+func TestRBACService_SeedDefaults(t *testing.T) {
+	svc := setupRBACService(t)
+	assert.NoError(t, svc.SeedDefaults())
+
+	permissions, err := svc.PermissionsForRole(models.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Contains(t, permissions, models.PermissionUserManage)
+
+	permissions, err = svc.PermissionsForRole(models.RoleViewer)
+	assert.NoError(t, err)
+	assert.NotContains(t, permissions, models.PermissionTicketCreate)
+
+	// Seeding again must not overwrite customised mappings
+	_, err = svc.SetRolePermissions(models.RoleViewer, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, svc.SeedDefaults())
+	permissions, err = svc.PermissionsForRole(models.RoleViewer)
+	assert.NoError(t, err)
+	assert.Empty(t, permissions)
+}
+
+func TestRBACService_SetRolePermissions(t *testing.T) {
+	svc := setupRBACService(t)
+
+	permissions, err := svc.SetRolePermissions(models.RoleAgent, []models.Permission{
+		models.PermissionTicketRead, models.PermissionTicketDelete, models.PermissionTicketRead,
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []models.Permission{models.PermissionTicketRead, models.PermissionTicketDelete}, permissions)
+
+	_, err = svc.SetRolePermissions(models.RoleAgent, []models.Permission{"ticket:explode"})
+	assert.Error(t, err)
+
+	_, err = svc.SetRolePermissions("superuser", nil)
+	assert.Error(t, err)
+}
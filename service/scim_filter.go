@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidSCIMFilter = errors.New("invalid SCIM filter")
+
+// SCIMFilter is a parsed SCIM filter (RFC 7644 section 3.4.2.2). Only
+// comparisons joined by "and" are supported, e.g.
+// `userName eq "jane@example.com" and active eq true`.
+type SCIMFilter []scimComparison
+
+type scimComparison struct {
+	attribute string // lower case attribute path, e.g. "username" or "members.value"
+	operator  string
+	value     string
+}
+
+var scimOperators = map[string]bool{"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "pr": true}
+
+type scimToken struct {
+	text   string
+	quoted bool
+}
+
+// ParseSCIMFilter parses a filter; the empty filter matches everything
+func ParseSCIMFilter(filter string) (SCIMFilter, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed SCIMFilter
+	for i := 0; i < len(tokens); {
+		if len(parsed) > 0 {
+			if tokens[i].quoted || !strings.EqualFold(tokens[i].text, "and") {
+				return nil, fmt.Errorf("%w: expected \"and\" before %q", ErrInvalidSCIMFilter, tokens[i].text)
+			}
+			i++
+		}
+		if i+1 >= len(tokens) {
+			return nil, fmt.Errorf("%w: incomplete comparison", ErrInvalidSCIMFilter)
+		}
+
+		attribute := tokens[i].text
+		if tokens[i].quoted || strings.ContainsAny(attribute, "()[]") {
+			return nil, fmt.Errorf("%w: unsupported attribute %q", ErrInvalidSCIMFilter, attribute)
+		}
+		operator := strings.ToLower(tokens[i+1].text)
+		if !scimOperators[operator] {
+			return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidSCIMFilter, tokens[i+1].text)
+		}
+
+		comparison := scimComparison{attribute: strings.ToLower(attribute), operator: operator}
+		i += 2
+		if operator != "pr" {
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("%w: missing value for %q", ErrInvalidSCIMFilter, attribute)
+			}
+			comparison.value = tokens[i].text
+			if !tokens[i].quoted {
+				// true, false, null and numbers
+				comparison.value = strings.ToLower(comparison.value)
+			}
+			i++
+		}
+		parsed = append(parsed, comparison)
+	}
+
+	return parsed, nil
+}
+
+func tokenizeSCIMFilter(filter string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(filter); {
+		switch filter[i] {
+		case ' ', '\t':
+			i++
+		case '"':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(filter) && filter[j] != '"'; j++ {
+				if filter[j] == '\\' && j+1 < len(filter) {
+					j++
+				}
+				value.WriteByte(filter[j])
+			}
+			if j >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidSCIMFilter)
+			}
+			tokens = append(tokens, scimToken{text: value.String(), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(filter) && filter[j] != ' ' && filter[j] != '\t' {
+				j++
+			}
+			tokens = append(tokens, scimToken{text: filter[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// Matches reports whether a resource satisfies every comparison. attributes
+// maps lower case attribute paths to their values; a multi-valued attribute
+// matches if any of its values does. Strings compare case-insensitively.
+func (f SCIMFilter) Matches(attributes map[string][]string) bool {
+	for _, comparison := range f {
+		if !comparison.matches(attributes[comparison.attribute]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c scimComparison) matches(values []string) bool {
+	if c.operator == "pr" {
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	want := strings.ToLower(c.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+		var ok bool
+		switch c.operator {
+		case "eq":
+			ok = v == want
+		case "ne":
+			ok = v != want
+		case "co":
+			ok = strings.Contains(v, want)
+		case "sw":
+			ok = strings.HasPrefix(v, want)
+		case "ew":
+			ok = strings.HasSuffix(v, want)
+		}
+		if ok {
+			return true
+		}
+	}
+	// An absent attribute is "not equal" to any value
+	return c.operator == "ne" && len(values) == 0
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	jane := map[string][]string{
+		"username": {"Jane@Example.com"},
+		"active":   {"true"},
+		"members":  {"a", "b"},
+	}
+
+	cases := []struct {
+		filter string
+		match  bool
+	}{
+		{``, true},
+		{`userName eq "jane@example.com"`, true},
+		{`USERNAME EQ "jane@example.com"`, true},
+		{`userName eq "john@example.com"`, false},
+		{`userName ne "john@example.com"`, true},
+		{`userName sw "jane" and active eq true`, true},
+		{`userName co "example" and active eq false`, false},
+		{`userName ew ".com"`, true},
+		{`members eq "b"`, true},
+		{`displayName pr`, false},
+		{`displayName ne "x"`, true},
+		{`userName eq "quote\"d"`, false},
+	}
+	for _, tc := range cases {
+		filter, err := ParseSCIMFilter(tc.filter)
+		require.NoError(t, err, tc.filter)
+		assert.Equal(t, tc.match, filter.Matches(jane), tc.filter)
+	}
+
+	for _, invalid := range []string{
+		`userName`,
+		`userName eq`,
+		`userName gt "a"`,
+		`userName eq "a" or active eq true`,
+		`emails[type eq "work"]`,
+		`userName eq "unterminated`,
+	} {
+		_, err := ParseSCIMFilter(invalid)
+		assert.ErrorIs(t, err, ErrInvalidSCIMFilter, invalid)
+	}
+}
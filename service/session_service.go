@@ -0,0 +1,207 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenTTL is how long a refresh token stays valid after it is issued or rotated
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+type SessionService struct {
+	db *gorm.DB
+}
+
+func NewSessionService(db *gorm.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// CreateSession starts a new session for the user and returns it with its raw refresh token
+func (s *SessionService) CreateSession(userID uuid.UUID) (*models.Session, string, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	session := &models.Session{
+		ID:               uuid.New(),
+		UserID:           userID,
+		RefreshTokenHash: hash,
+		ExpiresAt:        time.Now().Add(RefreshTokenTTL),
+	}
+
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, token, nil
+}
+
+// Refresh rotates the refresh token of an active session, invalidating the old
+// one. Any token rotated out of the session that is presented again has
+// leaked, so the session it belonged to is revoked.
+func (s *SessionService) Refresh(refreshToken string) (*models.Session, string, error) {
+	hash := hashToken(refreshToken)
+	session, err := s.getByRefreshToken(refreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		if err := s.revokeReused(hash); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	expiresAt := time.Now().Add(RefreshTokenTTL)
+	rotated := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Only the request that still holds the current token may rotate it
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, hash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash": newHash,
+				"expires_at":         expiresAt,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to refresh session: %w", result.Error)
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		rotated = true
+		if err := tx.Create(&models.SupersededRefreshToken{TokenHash: hash, SessionID: session.ID}).Error; err != nil {
+			return fmt.Errorf("failed to record superseded refresh token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if !rotated {
+		// Another request rotated the same token first, so it was replayed
+		if err := s.RevokeSession(session.ID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = expiresAt
+	return session, token, nil
+}
+
+// revokeReused revokes the session that a refresh token with the hash was
+// rotated out of
+func (s *SessionService) revokeReused(hash string) error {
+	superseded := s.db.Model(&models.SupersededRefreshToken{}).Select("session_id").Where("token_hash = ?", hash)
+	if err := s.db.Model(&models.Session{}).
+		Where("id IN (?) AND revoked_at IS NULL", superseded).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeByRefreshToken revokes the session that owns the given refresh token
+func (s *SessionService) RevokeByRefreshToken(refreshToken string) error {
+	session, err := s.getByRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.RevokeSession(session.ID)
+}
+
+func (s *SessionService) RevokeSession(id uuid.UUID) error {
+	if err := s.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every session belonging to the user
+func (s *SessionService) RevokeUserSessions(userID uuid.UUID) error {
+	if err := s.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except the given one
+func (s *SessionService) RevokeOtherSessions(userID, keepID uuid.UUID) error {
+	if err := s.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// MarkMFAVerified records that a second factor was presented in the session
+func (s *SessionService) MarkMFAVerified(id uuid.UUID) error {
+	if err := s.db.Model(&models.Session{}).Where("id = ?", id).Update("mfa_verified_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionService) GetSession(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.First(&session, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *SessionService) getByRefreshToken(refreshToken string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.First(&session, "refresh_token_hash = ?", hashToken(refreshToken)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !session.IsActive() {
+		return nil, ErrInvalidRefreshToken
+	}
+	return &session, nil
+}
+
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex SHA-256 of an opaque token so only digests are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
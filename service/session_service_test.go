@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSessionService(t *testing.T) *SessionService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.Session{}, &models.SupersededRefreshToken{})
+	assert.NoError(t, err)
+	return NewSessionService(db)
+}
+
+func TestSessionService_CreateAndRefresh(t *testing.T) {
+	svc := setupSessionService(t)
+	userID := uuid.New()
+
+	session, token, err := svc.CreateSession(userID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, session.RefreshTokenHash)
+	assert.True(t, session.IsActive())
+
+	refreshed, newToken, err := svc.Refresh(token)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, refreshed.ID)
+	assert.NotEqual(t, token, newToken)
+
+	_, _, err = svc.Refresh(token)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestSessionService_RefreshTokenReuse(t *testing.T) {
+	svc := setupSessionService(t)
+
+	session, token, err := svc.CreateSession(uuid.New())
+	assert.NoError(t, err)
+	_, newToken, err := svc.Refresh(token)
+	assert.NoError(t, err)
+
+	// Replaying the rotated-out token revokes the session for both holders
+	_, _, err = svc.Refresh(token)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	found, err := svc.GetSession(session.ID)
+	assert.NoError(t, err)
+	assert.False(t, found.IsActive())
+	_, _, err = svc.Refresh(newToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Unknown tokens revoke nothing
+	other, _, err := svc.CreateSession(uuid.New())
+	assert.NoError(t, err)
+	_, _, err = svc.Refresh("unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	found, err = svc.GetSession(other.ID)
+	assert.NoError(t, err)
+	assert.True(t, found.IsActive())
+}
+
+func TestSessionService_OlderRefreshTokenReuse(t *testing.T) {
+	svc := setupSessionService(t)
+
+	session, first, err := svc.CreateSession(uuid.New())
+	assert.NoError(t, err)
+	_, second, err := svc.Refresh(first)
+	assert.NoError(t, err)
+	_, third, err := svc.Refresh(second)
+	assert.NoError(t, err)
+
+	// Not only the last rotated-out token reveals a leak
+	_, _, err = svc.Refresh(first)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	found, err := svc.GetSession(session.ID)
+	assert.NoError(t, err)
+	assert.False(t, found.IsActive())
+	_, _, err = svc.Refresh(third)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestSessionService_ConcurrentRefresh(t *testing.T) {
+	svc := NewSessionService(openFileDB(t, &models.Session{}, &models.SupersededRefreshToken{}))
+	_, token, err := svc.CreateSession(uuid.New())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rotated := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := svc.Refresh(token)
+			if err == nil {
+				mu.Lock()
+				rotated++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+		}()
+	}
+	wg.Wait()
+
+	// The token rotates at most once; a replay racing it revokes the session
+	assert.LessOrEqual(t, rotated, 1)
+}
+
+func TestSessionService_Revoke(t *testing.T) {
+	svc := setupSessionService(t)
+	userID := uuid.New()
+
+	s1, token1, _ := svc.CreateSession(userID)
+	s2, _, _ := svc.CreateSession(userID)
+
+	err := svc.RevokeByRefreshToken(token1)
+	assert.NoError(t, err)
+	found, err := svc.GetSession(s1.ID)
+	assert.NoError(t, err)
+	assert.False(t, found.IsActive())
+
+	err = svc.RevokeUserSessions(userID)
+	assert.NoError(t, err)
+	found, err = svc.GetSession(s2.ID)
+	assert.NoError(t, err)
+	assert.False(t, found.IsActive())
+}
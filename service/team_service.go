@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeamNotFound  = errors.New("team not found")
+	ErrTeamNameTaken = errors.New("team name is already taken")
+)
+
+// TeamService manages teams. Every method is scoped to one organization;
+// teams of other organizations are reported as not found.
+type TeamService struct {
+	db *gorm.DB
+}
+
+func NewTeamService(db *gorm.DB) *TeamService {
+	return &TeamService{db: db}
+}
+
+// CreateTeam adds a team to the organization. A name of another team of the
+// organization returns ErrTeamNameTaken.
+func (s *TeamService) CreateTeam(orgID uuid.UUID, name, description string) (*models.Team, error) {
+	if err := s.checkNameAvailable(orgID, name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	team := &models.Team{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Name:           name,
+		Description:    description,
+	}
+
+	if err := s.db.Create(team).Error; err != nil {
+		return nil, fmt.Errorf("failed to create team: %w", err)
+	}
+
+	return team, nil
+}
+
+// GetTeam returns the team with its members
+func (s *TeamService) GetTeam(orgID, id uuid.UUID) (*models.Team, error) {
+	var team models.Team
+	if err := s.db.Preload("Members").First(&team, "id = ? AND organization_id = ?", id, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	return &team, nil
+}
+
+func (s *TeamService) ListTeams(orgID uuid.UUID) ([]models.Team, error) {
+	var teams []models.Team
+	if err := s.db.Where("organization_id = ?", orgID).Order("name").Find(&teams).Error; err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	return teams, nil
+}
+
+// ListTeamsWithMembers is ListTeams with the members of every team loaded
+func (s *TeamService) ListTeamsWithMembers(orgID uuid.UUID) ([]models.Team, error) {
+	var teams []models.Team
+	if err := s.db.Preload("Members").Where("organization_id = ?", orgID).Order("name").Find(&teams).Error; err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	return teams, nil
+}
+
+// UpdateTeam renames the team and sets its description. A name of another team
+// of the organization returns ErrTeamNameTaken.
+func (s *TeamService) UpdateTeam(orgID, id uuid.UUID, name, description string) (*models.Team, error) {
+	team, err := s.GetTeam(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if name != team.Name {
+		if err := s.checkNameAvailable(orgID, name, id); err != nil {
+			return nil, err
+		}
+	}
+
+	team.Name = name
+	team.Description = description
+
+	if err := s.db.Omit("Members").Save(team).Error; err != nil {
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+
+	return team, nil
+}
+
+// checkNameAvailable returns ErrTeamNameTaken when a team of the organization
+// other than except already has the name
+func (s *TeamService) checkNameAvailable(orgID uuid.UUID, name string, except uuid.UUID) error {
+	var taken int64
+	if err := s.db.Model(&models.Team{}).Where("organization_id = ? AND name = ? AND id <> ?", orgID, name, except).Count(&taken).Error; err != nil {
+		return fmt.Errorf("failed to check team name: %w", err)
+	}
+	if taken > 0 {
+		return ErrTeamNameTaken
+	}
+	return nil
+}
+
+// DeleteTeam removes the team and takes its tickets out of the team queue
+func (s *TeamService) DeleteTeam(orgID, id uuid.UUID) error {
+	team, err := s.GetTeam(orgID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Ticket{}).Where("team_id = ?", id).Update("team_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to unassign team tickets: %w", err)
+		}
+		if err := tx.Model(team).Association("Members").Clear(); err != nil {
+			return fmt.Errorf("failed to remove team members: %w", err)
+		}
+		if err := tx.Delete(team).Error; err != nil {
+			return fmt.Errorf("failed to delete team: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddMember adds a user of the same organization to the team
+func (s *TeamService) AddMember(orgID, teamID, userID uuid.UUID) (*models.Team, error) {
+	team, err := s.GetTeam(orgID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id = ? AND organization_id = ?", userID, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := s.db.Model(team).Association("Members").Append(&user); err != nil {
+		return nil, fmt.Errorf("failed to add team member: %w", err)
+	}
+
+	return s.GetTeam(orgID, teamID)
+}
+
+func (s *TeamService) RemoveMember(orgID, teamID, userID uuid.UUID) (*models.Team, error) {
+	team, err := s.GetTeam(orgID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(team).Association("Members").Delete(&models.User{ID: userID}); err != nil {
+		return nil, fmt.Errorf("failed to remove team member: %w", err)
+	}
+
+	return s.GetTeam(orgID, teamID)
+}
+
+// SetMembers replaces the members of the team. Every user must belong to the
+// organization.
+func (s *TeamService) SetMembers(orgID, teamID uuid.UUID, userIDs []uuid.UUID) (*models.Team, error) {
+	team, err := s.GetTeam(orgID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, len(userIDs))
+	if len(userIDs) > 0 {
+		if err := s.db.Where("id IN ? AND organization_id = ?", userIDs, orgID).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to get users: %w", err)
+		}
+	}
+	if len(users) != len(uniqueIDs(userIDs)) {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.db.Model(team).Association("Members").Replace(users); err != nil {
+		return nil, fmt.Errorf("failed to replace team members: %w", err)
+	}
+
+	return s.GetTeam(orgID, teamID)
+}
+
+func uniqueIDs(ids []uuid.UUID) map[uuid.UUID]struct{} {
+	unique := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return unique
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTeamService(t *testing.T) (*TeamService, *UserService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Team{}, &models.Ticket{})
+	assert.NoError(t, err)
+	return NewTeamService(db), NewUserService(db, DefaultPasswordManager), db
+}
+
+func TestTeamService_Members(t *testing.T) {
+	svc, userService, _ := setupTeamService(t)
+	team, err := svc.CreateTeam(testOrgID, "Network", "Routers and switches")
+	require.NoError(t, err)
+	jane, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	john, err := userService.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+
+	_, err = svc.AddMember(testOrgID, team.ID, jane.ID)
+	require.NoError(t, err)
+	team, err = svc.AddMember(testOrgID, team.ID, john.ID)
+	require.NoError(t, err)
+	assert.Len(t, team.Members, 2)
+
+	team, err = svc.RemoveMember(testOrgID, team.ID, jane.ID)
+	require.NoError(t, err)
+	require.Len(t, team.Members, 1)
+	assert.Equal(t, john.ID, team.Members[0].ID)
+
+	_, err = svc.AddMember(testOrgID, team.ID, uuid.New())
+	assert.Error(t, err)
+	_, err = svc.AddMember(testOrgID, uuid.New(), jane.ID)
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+}
+
+func TestTeamService_UpdateAndList(t *testing.T) {
+	svc, _, _ := setupTeamService(t)
+	_, err := svc.CreateTeam(testOrgID, "Network", "")
+	require.NoError(t, err)
+	billing, err := svc.CreateTeam(testOrgID, "Billing", "")
+	require.NoError(t, err)
+
+	updated, err := svc.UpdateTeam(testOrgID, billing.ID, "Accounts", "Invoices and refunds")
+	require.NoError(t, err)
+	assert.Equal(t, "Accounts", updated.Name)
+
+	teams, err := svc.ListTeams(testOrgID)
+	require.NoError(t, err)
+	require.Len(t, teams, 2)
+	assert.Equal(t, "Accounts", teams[0].Name)
+
+	_, err = svc.CreateTeam(testOrgID, "Network", "")
+	assert.ErrorIs(t, err, ErrTeamNameTaken)
+	_, err = svc.UpdateTeam(testOrgID, billing.ID, "Network", "")
+	assert.ErrorIs(t, err, ErrTeamNameTaken)
+	_, err = svc.CreateTeam(uuid.New(), "Network", "")
+	assert.NoError(t, err, "names only need to be unique within an organization")
+}
+
+func TestTeamService_DeleteUnassignsTickets(t *testing.T) {
+	svc, userService, db := setupTeamService(t)
+	team, err := svc.CreateTeam(testOrgID, "Network", "")
+	require.NoError(t, err)
+	jane, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	_, err = svc.AddMember(testOrgID, team.ID, jane.ID)
+	require.NoError(t, err)
+
+	ticket := models.NewTicket(testOrgID, "Router down", "Description", jane.ID)
+	ticket.TeamID = &team.ID
+	require.NoError(t, db.Create(ticket).Error)
+
+	require.NoError(t, svc.DeleteTeam(testOrgID, team.ID))
+	_, err = svc.GetTeam(testOrgID, team.ID)
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+
+	var found models.Ticket
+	require.NoError(t, db.First(&found, "id = ?", ticket.ID).Error)
+	assert.Nil(t, found.TeamID)
+}
+
+func TestTeamService_TenantIsolation(t *testing.T) {
+	svc, userService, _ := setupTeamService(t)
+	otherOrgID := uuid.New()
+	team, err := svc.CreateTeam(testOrgID, "Network", "")
+	require.NoError(t, err)
+	// Team names only need to be unique within an organization
+	_, err = svc.CreateTeam(otherOrgID, "Network", "")
+	require.NoError(t, err)
+	outsider, err := userService.CreateUser(otherOrgID, "outsider@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+
+	_, err = svc.GetTeam(otherOrgID, team.ID)
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+	assert.ErrorIs(t, svc.DeleteTeam(otherOrgID, team.ID), ErrTeamNotFound)
+
+	_, err = svc.AddMember(testOrgID, team.ID, outsider.ID)
+	assert.EqualError(t, err, "user not found")
+
+	teams, err := svc.ListTeams(testOrgID)
+	require.NoError(t, err)
+	assert.Len(t, teams, 1)
+}
+
+func TestTeamService_SetMembers(t *testing.T) {
+	svc, userService, _ := setupTeamService(t)
+	team, err := svc.CreateTeam(testOrgID, "Network", "")
+	require.NoError(t, err)
+	jane, err := userService.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	john, err := userService.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+	outsider, err := userService.CreateUser(uuid.New(), "outsider@example.com", "secret123", models.RoleAgent)
+	require.NoError(t, err)
+
+	team, err = svc.SetMembers(testOrgID, team.ID, []uuid.UUID{jane.ID, john.ID, jane.ID})
+	require.NoError(t, err)
+	assert.Len(t, team.Members, 2)
+
+	_, err = svc.SetMembers(testOrgID, team.ID, []uuid.UUID{jane.ID, outsider.ID})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	team, err = svc.SetMembers(testOrgID, team.ID, nil)
+	require.NoError(t, err)
+	assert.Empty(t, team.Members)
+}
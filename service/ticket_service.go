@@ -1,14 +1,28 @@
 package service
 
 import (
+	"errors"
 	"fix-ticket-system/metrics"
 	"fix-ticket-system/models"
 	"fix-ticket-system/repository"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidAssignee    = errors.New("assignee must be an active user")
+	ErrInvalidTicketPatch = errors.New("invalid ticket change")
+	// ErrTransitionNotAllowed is a status change the workflow does not allow
+	// from the ticket's current status
+	ErrTransitionNotAllowed = errors.New("status change not allowed")
+	// ErrTransitionRejected is an allowed status change whose requirements the
+	// ticket or request do not meet
+	ErrTransitionRejected = errors.New("status change requirements not met")
+)
+
 type TicketService struct {
 	repo *repository.TicketRepository
 }
@@ -20,28 +34,47 @@ func NewTicketService() *TicketService {
 }
 
 type TicketServiceInterface interface {
-	CreateTicket(title, description, createdBy string) (*models.Ticket, error)
-	GetTicket(id uuid.UUID) (*models.Ticket, error)
-	GetAllTickets() ([]models.Ticket, error)
-	UpdateTicket(id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo string) (*models.Ticket, error)
-	DeleteTicket(id uuid.UUID) error
+	CreateTicket(orgID uuid.UUID, title, description string, createdBy uuid.UUID) (*models.Ticket, error)
+	GetTicket(orgID, id uuid.UUID) (*models.Ticket, error)
+	ListTickets(orgID uuid.UUID, query repository.TicketQuery) (*repository.TicketPage, error)
+	SearchTickets(orgID uuid.UUID, query string, limit int) ([]repository.TicketSearchResult, error)
+	GetTicketsForUser(orgID, userID uuid.UUID) ([]models.Ticket, error)
+	GetTicketsForTeam(orgID, teamID uuid.UUID) ([]models.Ticket, error)
+	UpdateTicket(orgID, id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo, teamID *uuid.UUID) (*models.Ticket, error)
+	PatchTicket(orgID, id uuid.UUID, patch TicketPatch) (*models.Ticket, error)
+	TransitionTicket(orgID, id uuid.UUID, to models.Status, reason string) (*models.Ticket, error)
+	GetWorkflow(orgID uuid.UUID, teamID *uuid.UUID) (*models.Workflow, error)
+	DeleteTicket(orgID, id uuid.UUID) error
 }
 
 var _ TicketServiceInterface = (*TicketService)(nil)
 
-func (s *TicketService) CreateTicket(title, description, createdBy string) (*models.Ticket, error) {
-	ticket := models.NewTicket(title, description, createdBy)
+// CreateTicket opens a ticket in the organization, in the initial status of
+// its default workflow
+func (s *TicketService) CreateTicket(orgID uuid.UUID, title, description string, createdBy uuid.UUID) (*models.Ticket, error) {
+	workflow, err := s.repo.Workflow(orgID, nil)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("create_ticket").Inc()
+		return nil, err
+	}
+	ticket := models.NewTicket(orgID, title, description, createdBy)
+	ticket.Status = workflow.InitialStatus()
 	if err := s.repo.Create(ticket); err != nil {
 		metrics.ErrorTotal.WithLabelValues("create_ticket").Inc()
 		return nil, err
 	}
+	ticket, err = s.repo.GetByID(orgID, ticket.ID)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("create_ticket").Inc()
+		return nil, err
+	}
 	metrics.TicketOperationsTotal.WithLabelValues("create", "success").Inc()
 	metrics.TicketStatusGauge.WithLabelValues(string(ticket.Status)).Inc()
 	return ticket, nil
 }
 
-func (s *TicketService) GetTicket(id uuid.UUID) (*models.Ticket, error) {
-	ticket, err := s.repo.GetByID(id)
+func (s *TicketService) GetTicket(orgID, id uuid.UUID) (*models.Ticket, error) {
+	ticket, err := s.repo.GetByID(orgID, id)
 	if err != nil {
 		metrics.ErrorTotal.WithLabelValues("get_ticket").Inc()
 		return nil, err
@@ -50,52 +83,283 @@ func (s *TicketService) GetTicket(id uuid.UUID) (*models.Ticket, error) {
 	return ticket, nil
 }
 
-func (s *TicketService) GetAllTickets() ([]models.Ticket, error) {
-	tickets, err := s.repo.GetAll()
+// ListTickets returns one page of the organization's tickets matching the query
+func (s *TicketService) ListTickets(orgID uuid.UUID, query repository.TicketQuery) (*repository.TicketPage, error) {
+	page, err := s.repo.List(orgID, query)
 	if err != nil {
 		metrics.ErrorTotal.WithLabelValues("get_all_tickets").Inc()
 		return nil, err
 	}
 	metrics.TicketOperationsTotal.WithLabelValues("get_all", "success").Inc()
+	return page, nil
+}
+
+// SearchTickets returns the organization's tickets whose title and description
+// contain every word of the query, best match first
+func (s *TicketService) SearchTickets(orgID uuid.UUID, query string, limit int) ([]repository.TicketSearchResult, error) {
+	results, err := s.repo.Search(orgID, query, limit)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("search_tickets").Inc()
+		return nil, err
+	}
+	metrics.TicketOperationsTotal.WithLabelValues("search", "success").Inc()
+	return results, nil
+}
+
+// GetTicketsForUser returns the tickets the user created or is assigned to
+func (s *TicketService) GetTicketsForUser(orgID, userID uuid.UUID) ([]models.Ticket, error) {
+	tickets, err := s.repo.GetByParticipant(orgID, userID)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("get_tickets_for_user").Inc()
+		return nil, err
+	}
+	metrics.TicketOperationsTotal.WithLabelValues("get_for_user", "success").Inc()
 	return tickets, nil
 }
 
-func (s *TicketService) UpdateTicket(id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo string) (*models.Ticket, error) {
-	ticket, err := s.repo.GetByID(id)
+// GetTicketsForTeam returns the queue of the team
+func (s *TicketService) GetTicketsForTeam(orgID, teamID uuid.UUID) ([]models.Ticket, error) {
+	tickets, err := s.repo.GetByTeam(orgID, teamID)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("get_tickets_for_team").Inc()
+		return nil, err
+	}
+	metrics.TicketOperationsTotal.WithLabelValues("get_for_team", "success").Inc()
+	return tickets, nil
+}
+
+// UpdateTicket replaces the ticket's fields. A ticket may be assigned to an
+// active user, a team, or both of the ticket's organization; nil leaves it
+// unassigned.
+func (s *TicketService) UpdateTicket(orgID, id uuid.UUID, title, description string, status models.Status, priority models.Priority, assignedTo, teamID *uuid.UUID) (*models.Ticket, error) {
+	return s.PatchTicket(orgID, id, TicketPatch{
+		Fields:      models.EditableTicketFields,
+		Title:       title,
+		Description: description,
+		Status:      status,
+		Priority:    priority,
+		AssignedTo:  assignedTo,
+		TeamID:      teamID,
+	})
+}
+
+// TicketPatch changes the ticket fields listed in Fields to the values given
+// here; values of other fields are ignored
+type TicketPatch struct {
+	Fields      []models.TicketField
+	Title       string
+	Description string
+	Status      models.Status
+	Priority    models.Priority
+	AssignedTo  *uuid.UUID
+	TeamID      *uuid.UUID
+	// Reason explains a status change; some transitions require one
+	Reason string
+}
+
+// Has reports whether the patch changes the field
+func (p TicketPatch) Has(field models.TicketField) bool {
+	for _, f := range p.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchTicket changes only the fields in the patch's mask and stores only
+// those, leaving concurrent changes to other fields intact. The same rules as
+// for UpdateTicket apply to the changed fields, and status changes must follow
+// the workflow of the ticket's team as changed by the patch.
+func (s *TicketService) PatchTicket(orgID, id uuid.UUID, patch TicketPatch) (*models.Ticket, error) {
+	if err := patch.validate(); err != nil {
+		return nil, err
+	}
+
+	ticket, err := s.repo.GetByID(orgID, id)
 	if err != nil {
 		metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
 		return nil, err
 	}
 
-	// Decrement old status count
-	metrics.TicketStatusGauge.WithLabelValues(string(ticket.Status)).Dec()
+	// Keeping a deactivated assignee is allowed, so the ticket can still be
+	// edited until it is reassigned
+	assigneeChanged := patch.Has(models.TicketFieldAssignedTo) && ticket.AssigneeChanged(patch.AssignedTo)
+	if assigneeChanged && patch.AssignedTo != nil {
+		exists, err := s.repo.ActiveUserExists(orgID, *patch.AssignedTo)
+		if err != nil {
+			metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrInvalidAssignee
+		}
+	}
 
-	ticket.Title = title
-	ticket.Description = description
-	ticket.Status = status
-	ticket.Priority = priority
-	ticket.AssignedTo = assignedTo
+	if patch.Has(models.TicketFieldTeam) && patch.TeamID != nil {
+		exists, err := s.repo.TeamExists(orgID, *patch.TeamID)
+		if err != nil {
+			metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrTeamNotFound
+		}
+	}
+
+	oldStatus := ticket.Status
+	teamChanged := patch.Has(models.TicketFieldTeam) && ticket.TeamChanged(patch.TeamID)
+	columns := []string{"updated_at"}
+	for _, field := range patch.Fields {
+		switch field {
+		case models.TicketFieldTitle:
+			ticket.Title = patch.Title
+		case models.TicketFieldDescription:
+			ticket.Description = patch.Description
+		case models.TicketFieldStatus:
+			ticket.Status = patch.Status
+		case models.TicketFieldPriority:
+			ticket.Priority = patch.Priority
+		case models.TicketFieldAssignedTo:
+			ticket.AssignedToID = patch.AssignedTo
+		case models.TicketFieldTeam:
+			ticket.TeamID = patch.TeamID
+		}
+		columns = append(columns, string(field))
+	}
+	if assigneeChanged {
+		ticket.NeedsReassignment = false
+		columns = append(columns, "needs_reassignment")
+	}
 	ticket.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(ticket); err != nil {
+	// Guards see the ticket as changed by the patch, so a ticket can be
+	// assigned and resolved at once. Moving to another team checks the status
+	// against the workflow of the new team even if the status stays.
+	statusChanged := ticket.Status != oldStatus
+	if statusChanged || teamChanged {
+		workflow, err := s.repo.Workflow(orgID, ticket.TeamID)
+		if err != nil {
+			metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
+			return nil, err
+		}
+		if err := checkTransition(workflow, ticket, oldStatus, patch.Reason); err != nil {
+			return nil, err
+		}
+		if statusChanged {
+			ticket.StatusReason = strings.TrimSpace(patch.Reason)
+			columns = append(columns, "status_reason")
+		}
+		err = s.repo.UpdateFieldsInStatus(ticket, columns, oldStatus)
+	} else {
+		err = s.repo.UpdateFields(ticket, columns)
+	}
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
+		if errors.Is(err, repository.ErrStatusChanged) {
+			return nil, fmt.Errorf("%w: the ticket's status was changed meanwhile", ErrTransitionNotAllowed)
+		}
+		return nil, err
+	}
+	ticket, err = s.repo.GetByID(orgID, id)
+	if err != nil {
 		metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
 		return nil, err
 	}
 
-	// Increment new status count
+	// Move the ticket between status counts
+	metrics.TicketStatusGauge.WithLabelValues(string(oldStatus)).Dec()
 	metrics.TicketStatusGauge.WithLabelValues(string(ticket.Status)).Inc()
 	metrics.TicketOperationsTotal.WithLabelValues("update", "success").Inc()
 	return ticket, nil
 }
 
-func (s *TicketService) DeleteTicket(id uuid.UUID) error {
-	ticket, err := s.repo.GetByID(id)
+// TransitionTicket moves the ticket to the status, which must be allowed from
+// its current status by the ticket's workflow. The reason is kept on the
+// ticket.
+func (s *TicketService) TransitionTicket(orgID, id uuid.UUID, to models.Status, reason string) (*models.Ticket, error) {
+	if !to.IsValid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrTransitionRejected, to)
+	}
+	ticket, err := s.repo.GetByID(orgID, id)
+	if err != nil {
+		metrics.ErrorTotal.WithLabelValues("update_ticket").Inc()
+		return nil, err
+	}
+	if ticket.Status == to {
+		return nil, fmt.Errorf("%w: the ticket is already %s", ErrTransitionNotAllowed, to)
+	}
+	return s.PatchTicket(orgID, id, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldStatus},
+		Status: to,
+		Reason: reason,
+	})
+}
+
+// GetWorkflow returns the workflow followed by the tickets of the team, or by
+// tickets without team if teamID is nil
+func (s *TicketService) GetWorkflow(orgID uuid.UUID, teamID *uuid.UUID) (*models.Workflow, error) {
+	return s.repo.Workflow(orgID, teamID)
+}
+
+// checkTransition reports whether the changed ticket may leave the status
+// under the workflow. Tickets in a status the workflow does not have may only
+// enter it at its initial status.
+func checkTransition(workflow *models.Workflow, ticket *models.Ticket, from models.Status, reason string) error {
+	if !workflow.HasStatus(ticket.Status) {
+		return fmt.Errorf("%w: %s is not a status of the %s workflow", ErrTransitionRejected, ticket.Status, workflow.Name)
+	}
+	if ticket.Status == from {
+		return nil
+	}
+	if !workflow.HasStatus(from) {
+		if ticket.Status != workflow.InitialStatus() {
+			return fmt.Errorf("%w: tickets enter the %s workflow as %s", ErrTransitionNotAllowed, workflow.Name, workflow.InitialStatus())
+		}
+		return nil
+	}
+	transition, ok := workflow.FindTransition(from, ticket.Status)
+	if !ok {
+		return fmt.Errorf("%w: a ticket cannot go from %s to %s", ErrTransitionNotAllowed, from, ticket.Status)
+	}
+	if transition.RequiresAssignee && ticket.AssignedToID == nil {
+		return fmt.Errorf("%w: the ticket needs an assignee to become %s", ErrTransitionRejected, ticket.Status)
+	}
+	if transition.RequiresReason && strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("%w: a reason is required to go from %s to %s", ErrTransitionRejected, from, ticket.Status)
+	}
+	return nil
+}
+
+func (p TicketPatch) validate() error {
+	for _, field := range p.Fields {
+		if !field.IsEditable() {
+			return fmt.Errorf("%w: %s cannot be changed", ErrInvalidTicketPatch, field)
+		}
+	}
+	if p.Has(models.TicketFieldTitle) && strings.TrimSpace(p.Title) == "" {
+		return fmt.Errorf("%w: title must not be empty", ErrInvalidTicketPatch)
+	}
+	if p.Has(models.TicketFieldDescription) && strings.TrimSpace(p.Description) == "" {
+		return fmt.Errorf("%w: description must not be empty", ErrInvalidTicketPatch)
+	}
+	if p.Has(models.TicketFieldStatus) && !p.Status.IsValid() {
+		return fmt.Errorf("%w: invalid status %q", ErrInvalidTicketPatch, p.Status)
+	}
+	if p.Has(models.TicketFieldPriority) && !p.Priority.IsValid() {
+		return fmt.Errorf("%w: invalid priority %q", ErrInvalidTicketPatch, p.Priority)
+	}
+	return nil
+}
+
+func (s *TicketService) DeleteTicket(orgID, id uuid.UUID) error {
+	ticket, err := s.repo.GetByID(orgID, id)
 	if err != nil {
 		metrics.ErrorTotal.WithLabelValues("delete_ticket").Inc()
 		return err
 	}
 
-	if err := s.repo.Delete(id); err != nil {
+	if err := s.repo.Delete(orgID, id); err != nil {
 		metrics.ErrorTotal.WithLabelValues("delete_ticket").Inc()
 		return err
 	}
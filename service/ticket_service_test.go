@@ -12,11 +12,13 @@ import (
 	"gorm.io/gorm"
 )
 
+var testOrgID = uuid.New()
+
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 	// Migrate the schema
-	err = db.AutoMigrate(&models.Ticket{})
+	err = db.AutoMigrate(&models.User{}, &models.Ticket{}, &models.Team{}, &models.Workflow{})
 	assert.NoError(t, err)
 	return db
 }
@@ -28,59 +30,272 @@ func setupService(t *testing.T) *TicketService {
 	return &TicketService{repo: repo}
 }
 
+func createTicketUser(t *testing.T, email string) *models.User {
+	user, err := NewUserService(config.DB, DefaultPasswordManager).CreateUser(testOrgID, email, "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+	return user
+}
+
 func TestTicketService_CreateTicket(t *testing.T) {
 	svc := setupService(t)
-	ticket, err := svc.CreateTicket("Title", "Description", "creator@example.com")
+	creator := createTicketUser(t, "creator@example.com")
+	ticket, err := svc.CreateTicket(testOrgID, "Title", "Description", creator.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, ticket)
 	assert.Equal(t, "Title", ticket.Title)
 	assert.Equal(t, "Description", ticket.Description)
-	assert.Equal(t, "creator@example.com", ticket.CreatedBy)
+	assert.Equal(t, creator.ID, *ticket.CreatedByID)
+	if assert.NotNil(t, ticket.CreatedBy) {
+		assert.Equal(t, "creator@example.com", ticket.CreatedBy.Email)
+	}
 }
 
 func TestTicketService_GetTicket(t *testing.T) {
 	svc := setupService(t)
-	ticket, _ := svc.CreateTicket("Title", "Description", "creator@example.com")
-	found, err := svc.GetTicket(ticket.ID)
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+	found, err := svc.GetTicket(testOrgID, ticket.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, ticket.ID, found.ID)
 	// Not found
 	nonExistentID := uuid.New()
-	_, err = svc.GetTicket(nonExistentID)
+	_, err = svc.GetTicket(testOrgID, nonExistentID)
 	assert.Error(t, err)
 }
 
-func TestTicketService_GetAllTickets(t *testing.T) {
+func TestTicketService_ListTickets(t *testing.T) {
+	svc := setupService(t)
+	_, _ = svc.CreateTicket(testOrgID, "Title1", "Desc1", uuid.New())
+	_, _ = svc.CreateTicket(testOrgID, "Title2", "Desc2", uuid.New())
+	page, err := svc.ListTickets(testOrgID, repository.TicketQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Tickets, 2)
+	assert.Equal(t, int64(2), page.Total)
+}
+
+func TestTicketService_GetTicketsForUser(t *testing.T) {
 	svc := setupService(t)
-	_, _ = svc.CreateTicket("Title1", "Desc1", "a@example.com")
-	_, _ = svc.CreateTicket("Title2", "Desc2", "b@example.com")
-	tickets, err := svc.GetAllTickets()
+	me := createTicketUser(t, "me@example.com")
+	other := createTicketUser(t, "other@example.com")
+	_, _ = svc.CreateTicket(testOrgID, "Mine", "Desc", me.ID)
+	assigned, _ := svc.CreateTicket(testOrgID, "Assigned", "Desc", other.ID)
+	_, _ = svc.UpdateTicket(testOrgID, assigned.ID, assigned.Title, assigned.Description, assigned.Status, assigned.Priority, &me.ID, nil)
+	_, _ = svc.CreateTicket(testOrgID, "Unrelated", "Desc", other.ID)
+
+	tickets, err := svc.GetTicketsForUser(testOrgID, me.ID)
 	assert.NoError(t, err)
 	assert.Len(t, tickets, 2)
 }
 
 func TestTicketService_UpdateTicket(t *testing.T) {
 	svc := setupService(t)
-	ticket, _ := svc.CreateTicket("Title", "Description", "creator@example.com")
-	updated, err := svc.UpdateTicket(ticket.ID, "NewTitle", "NewDesc", models.StatusInProgress, models.PriorityHigh, "assignee@example.com")
+	assignee := createTicketUser(t, "assignee@example.com")
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+	updated, err := svc.UpdateTicket(testOrgID, ticket.ID, "NewTitle", "NewDesc", models.StatusInProgress, models.PriorityHigh, &assignee.ID, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "NewTitle", updated.Title)
 	assert.Equal(t, "NewDesc", updated.Description)
 	assert.Equal(t, models.StatusInProgress, updated.Status)
 	assert.Equal(t, models.PriorityHigh, updated.Priority)
-	assert.Equal(t, "assignee@example.com", updated.AssignedTo)
+	if assert.NotNil(t, updated.AssignedTo) {
+		assert.Equal(t, "assignee@example.com", updated.AssignedTo.Email)
+	}
 	// Not found
 	nonExistentID := uuid.New()
-	_, err = svc.UpdateTicket(nonExistentID, "T", "D", models.StatusOpen, models.PriorityLow, "")
+	_, err = svc.UpdateTicket(testOrgID, nonExistentID, "T", "D", models.StatusOpen, models.PriorityLow, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestTicketService_UpdateTicket_InvalidAssignee(t *testing.T) {
+	svc := setupService(t)
+	users := NewUserService(config.DB, DefaultPasswordManager)
+	assignee := createTicketUser(t, "assignee@example.com")
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+
+	unknown := uuid.New()
+	_, err := svc.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, &unknown, nil)
+	assert.ErrorIs(t, err, ErrInvalidAssignee)
+
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, &assignee.ID, nil)
+	assert.NoError(t, err)
+
+	// A ticket already assigned to a suspended user can still be edited, but
+	// not handed to them again once unassigned
+	_, err = users.SuspendUser(assignee.ID)
+	assert.NoError(t, err)
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, "Renamed", ticket.Description, ticket.Status, ticket.Priority, &assignee.ID, nil)
+	assert.NoError(t, err)
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, "Renamed", ticket.Description, ticket.Status, ticket.Priority, nil, nil)
+	assert.NoError(t, err)
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, "Renamed", ticket.Description, ticket.Status, ticket.Priority, &assignee.ID, nil)
+	assert.ErrorIs(t, err, ErrInvalidAssignee)
+}
+
+func TestTicketService_PatchTicket(t *testing.T) {
+	svc := setupService(t)
+	assignee := createTicketUser(t, "assignee@example.com")
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+
+	patched, err := svc.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields:     []models.TicketField{models.TicketFieldStatus, models.TicketFieldAssignedTo},
+		Title:      "Ignored",
+		Status:     models.StatusInProgress,
+		AssignedTo: &assignee.ID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", patched.Title)
+	assert.Equal(t, models.StatusInProgress, patched.Status)
+	assert.Equal(t, &assignee.ID, patched.AssignedToID)
+
+	// A concurrent change to a field outside the mask is kept
+	assert.NoError(t, config.DB.Model(&models.Ticket{}).Where("id = ?", ticket.ID).Update("description", "Edited elsewhere").Error)
+	patched, err = svc.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields:   []models.TicketField{models.TicketFieldPriority},
+		Priority: models.PriorityHigh,
+	})
+	assert.NoError(t, err)
+	stored, _ := svc.GetTicket(testOrgID, ticket.ID)
+	assert.Equal(t, "Edited elsewhere", stored.Description)
+	assert.Equal(t, models.PriorityHigh, stored.Priority)
+	assert.Equal(t, models.StatusInProgress, stored.Status)
+	assert.Equal(t, &assignee.ID, stored.AssignedToID)
+
+	// Unassigning
+	patched, err = svc.PatchTicket(testOrgID, ticket.ID, TicketPatch{Fields: []models.TicketField{models.TicketFieldAssignedTo}})
+	assert.NoError(t, err)
+	assert.Nil(t, patched.AssignedToID)
+}
+
+func TestTicketService_PatchTicket_Invalid(t *testing.T) {
+	svc := setupService(t)
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+
+	for _, patch := range []TicketPatch{
+		{Fields: []models.TicketField{"created_by_id"}},
+		{Fields: []models.TicketField{models.TicketFieldTitle}, Title: "  "},
+		{Fields: []models.TicketField{models.TicketFieldStatus}, Status: "Archived!"},
+		{Fields: []models.TicketField{models.TicketFieldPriority}, Priority: "urgent"},
+	} {
+		_, err := svc.PatchTicket(testOrgID, ticket.ID, patch)
+		assert.ErrorIs(t, err, ErrInvalidTicketPatch)
+	}
+
+	// Well-formed statuses must belong to the ticket's workflow
+	_, err := svc.PatchTicket(testOrgID, ticket.ID, TicketPatch{Fields: []models.TicketField{models.TicketFieldStatus}, Status: "archived"})
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+
+	_, err = svc.PatchTicket(testOrgID, uuid.New(), TicketPatch{Fields: []models.TicketField{models.TicketFieldTitle}, Title: "T"})
+	assert.Error(t, err)
+}
+
+func TestTicketService_TransitionTicket(t *testing.T) {
+	svc := setupService(t)
+	assignee := createTicketUser(t, "assignee@example.com")
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+
+	// Resolving needs an assignee
+	_, err := svc.TransitionTicket(testOrgID, ticket.ID, models.StatusResolved, "")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+
+	moved, err := svc.TransitionTicket(testOrgID, ticket.ID, models.StatusInProgress, "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusInProgress, moved.Status)
+
+	_, err = svc.TransitionTicket(testOrgID, ticket.ID, models.StatusInProgress, "")
+	assert.ErrorIs(t, err, ErrTransitionNotAllowed)
+	_, err = svc.TransitionTicket(testOrgID, ticket.ID, "archived", "")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+
+	// The guard sees the assignee set by the same patch
+	moved, err = svc.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields:     []models.TicketField{models.TicketFieldStatus, models.TicketFieldAssignedTo},
+		Status:     models.StatusResolved,
+		AssignedTo: &assignee.ID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusResolved, moved.Status)
+
+	moved, err = svc.TransitionTicket(testOrgID, ticket.ID, models.StatusClosed, "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusClosed, moved.Status)
+
+	// Closed tickets only reopen, with a reason
+	_, err = svc.TransitionTicket(testOrgID, ticket.ID, models.StatusInProgress, "Still broken")
+	assert.ErrorIs(t, err, ErrTransitionNotAllowed)
+	_, err = svc.TransitionTicket(testOrgID, ticket.ID, models.StatusOpen, " ")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	moved, err = svc.TransitionTicket(testOrgID, ticket.ID, models.StatusOpen, "Still broken")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusOpen, moved.Status)
+	assert.Equal(t, "Still broken", moved.StatusReason)
+
+	// UpdateTicket follows the same workflow
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, moved.Title, moved.Description, models.StatusClosed, moved.Priority, moved.AssignedToID, nil)
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+
+	_, err = svc.TransitionTicket(testOrgID, uuid.New(), models.StatusInProgress, "")
 	assert.Error(t, err)
 }
 
+func TestTicketService_TransitionTicket_ConcurrentChange(t *testing.T) {
+	svc := setupService(t)
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+
+	// Another request closes the ticket after it was read as open
+	assert.NoError(t, svc.repo.UpdateFields(&models.Ticket{ID: ticket.ID, OrganizationID: testOrgID, Status: models.StatusClosed}, []string{"status"}))
+	ticket.Status = models.StatusInProgress
+	err := svc.repo.UpdateFieldsInStatus(ticket, []string{"status"}, models.StatusOpen)
+	assert.ErrorIs(t, err, repository.ErrStatusChanged)
+
+	stored, _ := svc.GetTicket(testOrgID, ticket.ID)
+	assert.Equal(t, models.StatusClosed, stored.Status)
+}
+
 func TestTicketService_DeleteTicket(t *testing.T) {
 	svc := setupService(t)
-	ticket, _ := svc.CreateTicket("Title", "Description", "creator@example.com")
-	err := svc.DeleteTicket(ticket.ID)
+	ticket, _ := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+	err := svc.DeleteTicket(testOrgID, ticket.ID)
 	assert.NoError(t, err)
 	// Not found
-	err = svc.DeleteTicket(ticket.ID)
+	err = svc.DeleteTicket(testOrgID, ticket.ID)
 	assert.Error(t, err)
 }
+
+func TestTicketService_TeamAssignment(t *testing.T) {
+	svc := setupService(t)
+	team := &models.Team{ID: uuid.New(), OrganizationID: testOrgID, Name: "Network"}
+	assert.NoError(t, config.DB.Create(team).Error)
+
+	ticket, _ := svc.CreateTicket(testOrgID, "Router down", "Desc", uuid.New())
+	_, _ = svc.CreateTicket(testOrgID, "Unrelated", "Desc", uuid.New())
+
+	updated, err := svc.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, nil, &team.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, team.ID, *updated.TeamID)
+
+	queue, err := svc.GetTicketsForTeam(testOrgID, team.ID)
+	assert.NoError(t, err)
+	assert.Len(t, queue, 1)
+
+	unknown := uuid.New()
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, nil, &unknown)
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+}
+
+func TestTicketService_TenantIsolation(t *testing.T) {
+	svc := setupService(t)
+	otherOrgID := uuid.New()
+	outsider, err := NewUserService(config.DB, DefaultPasswordManager).CreateUser(otherOrgID, "outsider@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+
+	ticket, err := svc.CreateTicket(testOrgID, "Title", "Description", uuid.New())
+	assert.NoError(t, err)
+	assert.Equal(t, testOrgID, ticket.OrganizationID)
+
+	_, err = svc.GetTicket(otherOrgID, ticket.ID)
+	assert.Error(t, err)
+	assert.Error(t, svc.DeleteTicket(otherOrgID, ticket.ID))
+
+	// Users of another organization cannot be assigned
+	_, err = svc.UpdateTicket(testOrgID, ticket.ID, ticket.Title, ticket.Description, ticket.Status, ticket.Priority, &outsider.ID, nil)
+	assert.ErrorIs(t, err, ErrInvalidAssignee)
+}
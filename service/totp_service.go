@@ -0,0 +1,259 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod            = 30 * time.Second
+	totpDigits            = 6
+	totpSkew              = 1 // accepted time steps before and after the current one
+	recoveryCodeCount     = 10
+	recoveryCodeByteCount = 5
+)
+
+var (
+	ErrInvalidTOTPCode   = errors.New("invalid two-factor code")
+	ErrTOTPNotEnrolled   = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPAlreadyActive = errors.New("two-factor authentication is already enabled")
+)
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator app
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPService struct {
+	db     *gorm.DB
+	issuer string
+	now    func() time.Time
+}
+
+func NewTOTPService(db *gorm.DB, issuer string) *TOTPService {
+	return &TOTPService{db: db, issuer: issuer, now: time.Now}
+}
+
+// Enroll generates a new secret for the user. It only takes effect once
+// confirmed with a valid code.
+func (s *TOTPService) Enroll(userID uuid.UUID) (*TOTPEnrollment, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyActive
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+
+	if err := s.db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+
+	return &TOTPEnrollment{Secret: secret, ProvisioningURI: s.provisioningURI(user.Email, secret)}, nil
+}
+
+// Confirm enables two-factor authentication and returns single-use recovery codes
+func (s *TOTPService) Confirm(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyActive
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := s.validateCode(user.TOTPSecret, code, user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, recoveryCodeByteCount)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		hashes[i] = hashToken(codes[i])
+	}
+
+	// Of concurrent confirmations only one enables two-factor authentication
+	result := s.db.Model(&models.User{ID: user.ID}).
+		Where("totp_enabled = ? AND totp_secret = ?", false, user.TOTPSecret).
+		Select("totp_enabled", "totp_last_step", "totp_recovery_codes").
+		Updates(&models.User{TOTPEnabled: true, TOTPLastStep: step, TOTPRecoveryCodes: hashes})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to enable TOTP: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrTOTPAlreadyActive
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code
+func (s *TOTPService) Verify(userID uuid.UUID, code string) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+
+	if step, ok := s.validateCode(user.TOTPSecret, code, user.TOTPLastStep); ok {
+		return s.useStep(user.ID, step)
+	}
+
+	hash := hashToken(strings.ToLower(strings.TrimSpace(code)))
+	for i, h := range user.TOTPRecoveryCodes {
+		if hmac.Equal([]byte(h), []byte(hash)) {
+			remaining := append(user.TOTPRecoveryCodes[:i:i], user.TOTPRecoveryCodes[i+1:]...)
+			return s.consumeRecoveryCode(user, remaining)
+		}
+	}
+
+	return ErrInvalidTOTPCode
+}
+
+// useStep records the time step of an accepted code unless a code of the same
+// or a later step was accepted since the user was read, so of concurrent
+// requests with the same code only one succeeds
+func (s *TOTPService) useStep(userID uuid.UUID, step int64) error {
+	result := s.db.Model(&models.User{}).
+		Where("id = ? AND totp_enabled = ? AND totp_last_step < ?", userID, true, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save TOTP step: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// consumeRecoveryCode stores the remaining recovery codes unless they changed
+// since the user was read, so a code cannot be spent twice concurrently
+func (s *TOTPService) consumeRecoveryCode(user *models.User, remaining []string) error {
+	stored, err := json.Marshal(user.TOTPRecoveryCodes)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	result := s.db.Model(&models.User{ID: user.ID}).
+		Where("totp_enabled = ? AND totp_recovery_codes = ?", true, string(stored)).
+		Select("totp_recovery_codes").
+		Updates(&models.User{TOTPRecoveryCodes: remaining})
+	if result.Error != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// Disable turns two-factor authentication off after checking a current code
+func (s *TOTPService) Disable(userID uuid.UUID, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+
+	// Only the two-factor columns are written, leaving concurrent changes to
+	// the rest of the user intact
+	err := s.db.Model(&models.User{ID: userID}).Select("totp_enabled", "totp_secret", "totp_last_step", "totp_recovery_codes").
+		Updates(&models.User{TOTPEnabled: false, TOTPSecret: "", TOTPLastStep: 0, TOTPRecoveryCodes: nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	return nil
+}
+
+// validateCode accepts a code within the allowed clock skew whose time step is
+// newer than lastStep, so a code cannot be replayed
+func (s *TOTPService) validateCode(secret, code string, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := s.now().Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := GenerateTOTP(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func (s *TOTPService) provisioningURI(email, secret string) string {
+	label := url.PathEscape(s.issuer + ":" + email)
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {s.issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func (s *TOTPService) getUser(id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GenerateTOTP returns the RFC 6238 code of the base32 secret for a time step
+func GenerateTOTP(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTOTPService(t *testing.T) (*TOTPService, *models.User, *time.Time) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{})
+	assert.NoError(t, err)
+
+	user, err := NewUserService(db, DefaultPasswordManager).CreateUser(testOrgID, "admin@example.com", "secret123", models.RoleAdmin)
+	require.NoError(t, err)
+
+	svc := NewTOTPService(db, "Fix Ticket System")
+	now := time.Unix(1700000000, 0)
+	svc.now = func() time.Time { return now }
+	return svc, user, &now
+}
+
+func codeAt(t *testing.T, secret string, now time.Time) string {
+	code, err := GenerateTOTP(secret, now.Unix()/30)
+	require.NoError(t, err)
+	return code
+}
+
+func TestGenerateTOTP_RFC6238Vectors(t *testing.T) {
+	// The SHA1 secret of RFC 6238 appendix B, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for step, want := range map[int64]string{
+		59 / 30:         "287082",
+		1111111109 / 30: "081804",
+		1234567890 / 30: "005924",
+	} {
+		code, err := GenerateTOTP(secret, step)
+		assert.NoError(t, err)
+		assert.Equal(t, want, code)
+	}
+}
+
+func TestTOTPService_EnrollAndConfirm(t *testing.T) {
+	svc, user, now := setupTOTPService(t)
+
+	enrollment, err := svc.Enroll(user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/Fix%20Ticket%20System:admin@example.com?")
+	assert.Contains(t, enrollment.ProvisioningURI, "secret="+enrollment.Secret)
+
+	_, err = svc.Confirm(user.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+	codes, err := svc.Confirm(user.ID, codeAt(t, enrollment.Secret, *now))
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	_, err = svc.Enroll(user.ID)
+	assert.ErrorIs(t, err, ErrTOTPAlreadyActive)
+}
+
+func TestTOTPService_VerifyRejectsReplay(t *testing.T) {
+	svc, user, now := setupTOTPService(t)
+	enrollment, err := svc.Enroll(user.ID)
+	require.NoError(t, err)
+	_, err = svc.Confirm(user.ID, codeAt(t, enrollment.Secret, *now))
+	require.NoError(t, err)
+
+	// The code used to confirm cannot be used again
+	assert.ErrorIs(t, svc.Verify(user.ID, codeAt(t, enrollment.Secret, *now)), ErrInvalidTOTPCode)
+
+	*now = now.Add(30 * time.Second)
+	code := codeAt(t, enrollment.Secret, *now)
+	assert.NoError(t, svc.Verify(user.ID, code))
+	assert.ErrorIs(t, svc.Verify(user.ID, code), ErrInvalidTOTPCode)
+
+	// One step of clock skew is tolerated, more is not
+	assert.NoError(t, svc.Verify(user.ID, codeAt(t, enrollment.Secret, now.Add(30*time.Second))))
+	assert.ErrorIs(t, svc.Verify(user.ID, codeAt(t, enrollment.Secret, now.Add(5*time.Minute))), ErrInvalidTOTPCode)
+}
+
+func TestTOTPService_RecoveryCodesAreSingleUse(t *testing.T) {
+	svc, user, now := setupTOTPService(t)
+	enrollment, err := svc.Enroll(user.ID)
+	require.NoError(t, err)
+	codes, err := svc.Confirm(user.ID, codeAt(t, enrollment.Secret, *now))
+	require.NoError(t, err)
+
+	assert.NoError(t, svc.Verify(user.ID, codes[3]))
+	assert.ErrorIs(t, svc.Verify(user.ID, codes[3]), ErrInvalidTOTPCode)
+	assert.NoError(t, svc.Verify(user.ID, codes[4]))
+}
+
+func TestTOTPService_Disable(t *testing.T) {
+	svc, user, now := setupTOTPService(t)
+	assert.ErrorIs(t, svc.Verify(user.ID, "123456"), ErrTOTPNotEnrolled)
+
+	enrollment, err := svc.Enroll(user.ID)
+	require.NoError(t, err)
+	_, err = svc.Confirm(user.ID, codeAt(t, enrollment.Secret, *now))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.Disable(user.ID, "000000"), ErrInvalidTOTPCode)
+
+	*now = now.Add(30 * time.Second)
+	assert.NoError(t, svc.Disable(user.ID, codeAt(t, enrollment.Secret, *now)))
+	assert.ErrorIs(t, svc.Verify(user.ID, codeAt(t, enrollment.Secret, *now)), ErrTOTPNotEnrolled)
+}
+
+func TestTOTPService_StaleReadsDoNotReuseCodes(t *testing.T) {
+	svc, user, now := setupTOTPService(t)
+	enrollment, err := svc.Enroll(user.ID)
+	require.NoError(t, err)
+	codes, err := svc.Confirm(user.ID, codeAt(t, enrollment.Secret, *now))
+	require.NoError(t, err)
+
+	// A request that read the user before another one used the same code
+	// cannot use it again
+	stale, err := svc.getUser(user.ID)
+	require.NoError(t, err)
+	*now = now.Add(30 * time.Second)
+	step := now.Unix() / 30
+	require.NoError(t, svc.Verify(user.ID, codeAt(t, enrollment.Secret, *now)))
+	assert.ErrorIs(t, svc.useStep(user.ID, step), ErrInvalidTOTPCode)
+
+	require.NoError(t, svc.Verify(user.ID, codes[0]))
+	assert.ErrorIs(t, svc.consumeRecoveryCode(stale, stale.TOTPRecoveryCodes[1:]), ErrInvalidTOTPCode)
+
+	// The remaining recovery codes are kept
+	assert.NoError(t, svc.Verify(user.ID, codes[1]))
+}
@@ -1,8 +1,12 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"fix-ticket-system/models"
 
@@ -10,26 +14,150 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidPassword          = errors.New("current password is incorrect")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrExternalIdentityConflict = errors.New("email belongs to an account not linked to this identity")
+	ErrEmailTaken               = errors.New("email is already taken")
+)
+
 type UserService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	passwords *PasswordManager
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, passwords *PasswordManager) *UserService {
+	return &UserService{db: db, passwords: passwords}
 }
 
-func (s *UserService) CreateUser(email, password string, role models.Role) (*models.User, error) {
+// CreateUser creates a user in the organization. The password must satisfy the
+// password policy.
+func (s *UserService) CreateUser(orgID uuid.UUID, email, password string, role models.Role) (*models.User, error) {
+	if err := s.passwords.Validate(password); err != nil {
+		return nil, err
+	}
+
 	user := &models.User{
-		ID:       uuid.New(),
-		Email:    email,
-		Password: password,
-		Role:     role,
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		Status:         models.UserStatusActive,
+	}
+
+	return user, s.insertUser(user, password)
+}
+
+// CreateServiceAccount creates a non-human user that can only authenticate with API keys
+func (s *UserService) CreateServiceAccount(orgID uuid.UUID, email string, role models.Role) (*models.User, error) {
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := user.HashPassword(); err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+	user := &models.User{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		ServiceAccount: true,
+		Status:         models.UserStatusActive,
+	}
+
+	if err := s.insertUser(user, password); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserService) insertUser(user *models.User, password string) error {
+	hash, err := s.passwords.Hash(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
+	user.Password = hash
 
+	if err := s.db.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// ExternalLogin is a user signed in through an identity provider or directory
+type ExternalLogin struct {
+	Issuer  string // OIDC issuer or LDAP server
+	Subject string // the user's stable ID at Issuer
+	Email   string
+	Role    models.Role
+	// UpdateRole changes the role of existing users to Role
+	UpdateRole bool
+	// LinkByEmail lets a first login claim a user of the organization with
+	// the same email that has neither a local password nor another identity,
+	// e.g. one provisioned through SCIM. Only set it for verified emails.
+	LinkByEmail bool
+}
+
+// ProvisionExternalUser returns the user linked to the login's identity,
+// creating it in the organization on first login. Users with a local
+// password, another identity or in another organization are never linked;
+// their email makes the login fail with ErrExternalIdentityConflict.
+func (s *UserService) ProvisionExternalUser(orgID uuid.UUID, login ExternalLogin) (*models.User, error) {
+	if login.Issuer == "" || login.Subject == "" {
+		return nil, errors.New("external login has no issuer or subject")
+	}
+
+	var user models.User
+	changed := false
+	result := s.db.Where("external_issuer = ? AND external_subject = ?", login.Issuer, login.Subject).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		result = s.db.Where("email = ?", login.Email).Limit(1).Find(&user)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to get user: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return s.createExternalUser(orgID, login.Email, login.Role, &login.Issuer, &login.Subject)
+		}
+		if !login.LinkByEmail || user.OrganizationID != orgID || user.HasLocalPassword() || user.ExternalIssuer != nil {
+			return nil, fmt.Errorf("%w: %s", ErrExternalIdentityConflict, login.Email)
+		}
+		user.ExternalIssuer = &login.Issuer
+		user.ExternalSubject = &login.Subject
+		changed = true
+	}
+
+	if login.UpdateRole && user.Role != login.Role {
+		user.Role = login.Role
+		changed = true
+	}
+	if !changed {
+		return &user, nil
+	}
+	if err := s.db.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return &user, nil
+}
+
+// CreateExternalUser creates a user managed by an external identity provider or
+// directory. External users have no local password.
+func (s *UserService) CreateExternalUser(orgID uuid.UUID, email string, role models.Role) (*models.User, error) {
+	return s.createExternalUser(orgID, email, role, nil, nil)
+}
+
+func (s *UserService) createExternalUser(orgID uuid.UUID, email string, role models.Role, issuer, subject *string) (*models.User, error) {
+	user := &models.User{
+		ID:              uuid.New(),
+		OrganizationID:  orgID,
+		Email:           email,
+		Role:            role,
+		Status:          models.UserStatusActive,
+		ExternalIssuer:  issuer,
+		ExternalSubject: subject,
+	}
 	if err := s.db.Create(user).Error; err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -41,7 +169,19 @@ func (s *UserService) GetUserByID(id uuid.UUID) (*models.User, error) {
 	var user models.User
 	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserInOrganization returns the user only if it belongs to the organization
+func (s *UserService) GetUserInOrganization(orgID, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ? AND organization_id = ?", id, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -52,18 +192,49 @@ func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
 	if err := s.db.First(&user, "email = ?", email).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return &user, nil
 }
 
+// CheckPassword verifies the user's password. A hash produced by an older
+// algorithm or with outdated parameters is replaced once the password matched;
+// failing to do so does not fail the check.
+func (s *UserService) CheckPassword(user *models.User, password string) bool {
+	if !user.HasLocalPassword() {
+		return false
+	}
+	ok, rehash := s.passwords.Verify(password, user.Password)
+	if !ok || !rehash {
+		return ok
+	}
+
+	hash, err := s.passwords.Hash(password)
+	if err == nil {
+		err = s.db.Model(&models.User{}).Where("id = ? AND password = ?", user.ID, user.Password).Update("password", hash).Error
+	}
+	if err != nil {
+		log.Printf("Warning: failed to upgrade password hash of user %s: %v", user.ID, err)
+		return true
+	}
+	user.Password = hash
+	return true
+}
+
+// UpdateUser sets the user's email and role. An email of another user returns
+// ErrEmailTaken.
 func (s *UserService) UpdateUser(id uuid.UUID, email string, role models.Role) (*models.User, error) {
 	user, err := s.GetUserByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if email != user.Email {
+		if err := s.checkEmailAvailable(email); err != nil {
+			return nil, err
+		}
+	}
 
 	user.Email = email
 	user.Role = role
@@ -75,17 +246,213 @@ func (s *UserService) UpdateUser(id uuid.UUID, email string, role models.Role) (
 	return user, nil
 }
 
-func (s *UserService) DeleteUser(id uuid.UUID) error {
-	if err := s.db.Delete(&models.User{}, "id = ?", id).Error; err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+// UpdateProfile lets a user change their own email and password. Either change
+// requires the current password; empty values are left unchanged. An email of
+// another user returns ErrEmailTaken.
+func (s *UserService) UpdateProfile(id uuid.UUID, currentPassword, email, newPassword string) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := s.passwords.Verify(currentPassword, user.Password); !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	if email != "" && email != user.Email {
+		if err := s.checkEmailAvailable(email); err != nil {
+			return nil, err
+		}
+		user.Email = email
+	}
+	if newPassword != "" {
+		if err := s.passwords.Validate(newPassword); err != nil {
+			return nil, err
+		}
+		hash, err := s.passwords.Hash(newPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		user.Password = hash
+	}
+
+	if err := s.db.Save(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return user, nil
+}
+
+// checkEmailAvailable returns ErrEmailTaken when a user already has the email
+func (s *UserService) checkEmailAvailable(email string) error {
+	var taken int64
+	if err := s.db.Model(&models.User{}).Where("email = ?", email).Count(&taken).Error; err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+	if taken > 0 {
+		return ErrEmailTaken
 	}
 	return nil
 }
 
-func (s *UserService) ListUsers() ([]models.User, error) {
+// SuspendUser blocks the user from signing in until reactivated
+func (s *UserService) SuspendUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = models.UserStatusSuspended
+	if err := s.db.Save(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to suspend user: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeactivateUser blocks the user and flags the tickets assigned to them for
+// reassignment. The user is kept until purged, so tickets keep a valid reference.
+func (s *UserService) DeactivateUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.Status = models.UserStatusDeactivated
+	user.DeactivatedAt = &now
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return fmt.Errorf("failed to deactivate user: %w", err)
+		}
+		if err := tx.Model(&models.Ticket{}).Where("assigned_to_id = ?", user.ID).Update("needs_reassignment", true).Error; err != nil {
+			return fmt.Errorf("failed to flag tickets for reassignment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ReactivateUser lets a suspended or deactivated user sign in again. Tickets
+// still assigned to them no longer need reassignment.
+func (s *UserService) ReactivateUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = models.UserStatusActive
+	user.DeactivatedAt = nil
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return fmt.Errorf("failed to reactivate user: %w", err)
+		}
+		if err := tx.Model(&models.Ticket{}).Where("assigned_to_id = ?", user.ID).Update("needs_reassignment", false).Error; err != nil {
+			return fmt.Errorf("failed to update tickets: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// PurgeDeactivatedUsers permanently deletes users deactivated for longer than
+// gracePeriod, together with their credentials and team memberships, and
+// returns how many were deleted. Their tickets are kept without a reporter or
+// assignee.
+func (s *UserService) PurgeDeactivatedUsers(gracePeriod time.Duration) (int, error) {
+	var users []models.User
+	if err := s.db.Where("status = ? AND deactivated_at < ?", models.UserStatusDeactivated, time.Now().Add(-gracePeriod)).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to list deactivated users: %w", err)
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uuid.UUID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		sessions := tx.Model(&models.Session{}).Select("id").Where("user_id IN ?", ids)
+		if err := tx.Where("session_id IN (?)", sessions).Delete(&models.SupersededRefreshToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete credentials: %w", err)
+		}
+		for _, model := range []interface{}{&models.Session{}, &models.APIKey{}, &models.PasswordResetToken{}} {
+			if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to delete credentials: %w", err)
+			}
+		}
+		// Tickets outlive their reporter and assignee
+		if err := tx.Model(&models.Ticket{}).Where("created_by_id IN ?", ids).Update("created_by_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to detach reported tickets: %w", err)
+		}
+		if err := tx.Model(&models.Ticket{}).Where("assigned_to_id IN ?", ids).Update("assigned_to_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to detach assigned tickets: %w", err)
+		}
+		if err := tx.Exec("DELETE FROM team_members WHERE user_id IN ?", ids).Error; err != nil {
+			return fmt.Errorf("failed to delete team memberships: %w", err)
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.User{}).Error; err != nil {
+			return fmt.Errorf("failed to delete users: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(users), nil
+}
+
+// HasAdmin reports whether at least one active admin or super admin exists
+func (s *UserService) HasAdmin() (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.User{}).
+		Where("(role = ? OR super_admin = ?) AND status = ?", models.RoleAdmin, true, models.UserStatusActive).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count > 0, nil
+}
+
+// SetSuperAdmin grants or revokes the right to manage every organization
+func (s *UserService) SetSuperAdmin(id uuid.UUID, superAdmin bool) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.SuperAdmin = superAdmin
+	if err := s.db.Save(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns the users of the organization
+func (s *UserService) ListUsers(orgID uuid.UUID) ([]models.User, error) {
 	var users []models.User
-	if err := s.db.Find(&users).Error; err != nil {
+	if err := s.db.Where("organization_id = ?", orgID).Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
 	return users, nil
 }
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"fix-ticket-system/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUserService(t *testing.T) *UserService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{})
+	assert.NoError(t, err)
+	return NewUserService(db, DefaultPasswordManager)
+}
+
+func TestUserService_ProvisionExternalUser(t *testing.T) {
+	svc := setupUserService(t)
+	login := ExternalLogin{Issuer: "https://idp.example.com", Subject: "jane", Email: "jane@example.com", Role: models.RoleAgent, UpdateRole: true}
+
+	user, err := svc.ProvisionExternalUser(testOrgID, login)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAgent, user.Role)
+	assert.False(t, user.HasLocalPassword())
+	assert.False(t, svc.CheckPassword(user, ""))
+
+	// Existing users keep their role unless the provider mapped one
+	login.Role, login.UpdateRole = models.RoleUser, false
+	same, err := svc.ProvisionExternalUser(testOrgID, login)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, same.ID)
+	assert.Equal(t, models.RoleAgent, same.Role)
+
+	login.Role, login.UpdateRole = models.RoleAdmin, true
+	promoted, err := svc.ProvisionExternalUser(testOrgID, login)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, promoted.Role)
+
+	// Users are found by identity, not by email
+	login.Email = "jane.doe@example.com"
+	same, err = svc.ProvisionExternalUser(testOrgID, login)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, same.ID)
+}
+
+func TestUserService_ProvisionExternalUser_Linking(t *testing.T) {
+	svc := setupUserService(t)
+	local, err := svc.CreateUser(testOrgID, "local@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+	_, err = svc.SetSuperAdmin(local.ID, true)
+	assert.NoError(t, err)
+	scim, err := svc.CreateExternalUser(testOrgID, "scim@example.com", models.RoleAgent)
+	assert.NoError(t, err)
+	other, err := svc.CreateExternalUser(uuid.New(), "other@example.com", models.RoleAgent)
+	assert.NoError(t, err)
+
+	// Local accounts and users of other organizations are never taken over
+	for _, email := range []string{local.Email, other.Email} {
+		_, err = svc.ProvisionExternalUser(testOrgID, ExternalLogin{Issuer: "idp", Subject: email, Email: email, Role: models.RoleAdmin, UpdateRole: true, LinkByEmail: true})
+		assert.ErrorIs(t, err, ErrExternalIdentityConflict)
+	}
+	unchanged, err := svc.GetUserByID(local.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAgent, unchanged.Role)
+
+	// Without LinkByEmail even provisioned users are left alone
+	_, err = svc.ProvisionExternalUser(testOrgID, ExternalLogin{Issuer: "idp", Subject: "scim", Email: scim.Email, Role: models.RoleAgent})
+	assert.ErrorIs(t, err, ErrExternalIdentityConflict)
+
+	// Users without password or identity are claimed once
+	linked, err := svc.ProvisionExternalUser(testOrgID, ExternalLogin{Issuer: "idp", Subject: "scim", Email: scim.Email, Role: models.RoleAgent, LinkByEmail: true})
+	assert.NoError(t, err)
+	assert.Equal(t, scim.ID, linked.ID)
+	_, err = svc.ProvisionExternalUser(testOrgID, ExternalLogin{Issuer: "idp", Subject: "impostor", Email: scim.Email, Role: models.RoleAgent, LinkByEmail: true})
+	assert.ErrorIs(t, err, ErrExternalIdentityConflict)
+}
+
+func TestUserService_UpdateProfile(t *testing.T) {
+	svc := setupUserService(t)
+	user, err := svc.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+
+	_, err = svc.UpdateProfile(user.ID, "wrong", "", "newsecret")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	updated, err := svc.UpdateProfile(user.ID, "secret123", "jane.doe@example.com", "newsecret")
+	assert.NoError(t, err)
+	assert.Equal(t, "jane.doe@example.com", updated.Email)
+	assert.True(t, svc.CheckPassword(updated, "newsecret"))
+	assert.False(t, svc.CheckPassword(updated, "secret123"))
+
+	_, err = svc.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	_, err = svc.UpdateProfile(user.ID, "newsecret", "john@example.com", "")
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	updated, err = svc.UpdateProfile(user.ID, "newsecret", "jane.doe@example.com", "")
+	assert.NoError(t, err, "keeping the own email is not a conflict")
+	assert.Equal(t, "jane.doe@example.com", updated.Email)
+}
+
+func setupUserLifecycle(t *testing.T) (*UserService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	err = db.AutoMigrate(&models.User{}, &models.Ticket{}, &models.Session{}, &models.SupersededRefreshToken{}, &models.APIKey{}, &models.PasswordResetToken{}, &models.Team{})
+	assert.NoError(t, err)
+	return NewUserService(db, DefaultPasswordManager), db
+}
+
+func TestUserService_UpdateUser(t *testing.T) {
+	svc := setupUserService(t)
+	user, err := svc.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	_, err = svc.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+
+	_, err = svc.UpdateUser(user.ID, "john@example.com", models.RoleAgent)
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	updated, err := svc.UpdateUser(user.ID, "jane@example.com", models.RoleAgent)
+	assert.NoError(t, err, "keeping the own email is not a conflict")
+	assert.Equal(t, models.RoleAgent, updated.Role)
+}
+
+func TestUserService_DeactivateFlagsAssignedTickets(t *testing.T) {
+	svc, db := setupUserLifecycle(t)
+	user, err := svc.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+	assert.True(t, user.IsActive())
+
+	assigned := models.NewTicket(testOrgID, "Assigned", "Description", uuid.New())
+	assigned.AssignedToID = &user.ID
+	reported := models.NewTicket(testOrgID, "Reported", "Description", user.ID)
+	assert.NoError(t, db.Create(assigned).Error)
+	assert.NoError(t, db.Create(reported).Error)
+
+	deactivated, err := svc.DeactivateUser(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.UserStatusDeactivated, deactivated.Status)
+	assert.NotNil(t, deactivated.DeactivatedAt)
+
+	var flagged, unflagged models.Ticket
+	assert.NoError(t, db.First(&flagged, "id = ?", assigned.ID).Error)
+	assert.True(t, flagged.NeedsReassignment)
+	assert.NoError(t, db.First(&unflagged, "id = ?", reported.ID).Error)
+	assert.False(t, unflagged.NeedsReassignment)
+
+	reactivated, err := svc.ReactivateUser(user.ID)
+	assert.NoError(t, err)
+	assert.True(t, reactivated.IsActive())
+	assert.Nil(t, reactivated.DeactivatedAt)
+	var reassigned models.Ticket
+	assert.NoError(t, db.First(&reassigned, "id = ?", assigned.ID).Error)
+	assert.False(t, reassigned.NeedsReassignment)
+}
+
+func TestUserService_PurgeDeactivatedUsers(t *testing.T) {
+	svc, db := setupUserLifecycle(t)
+	leaver, err := svc.CreateUser(testOrgID, "leaver@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	recent, err := svc.CreateUser(testOrgID, "recent@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	suspended, err := svc.CreateUser(testOrgID, "suspended@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+
+	_, err = svc.DeactivateUser(leaver.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&models.User{}).Where("id = ?", leaver.ID).Update("deactivated_at", time.Now().Add(-48*time.Hour)).Error)
+	_, refreshToken, err := NewSessionService(db).CreateSession(leaver.ID)
+	assert.NoError(t, err)
+	_, _, err = NewSessionService(db).Refresh(refreshToken)
+	assert.NoError(t, err)
+	ticket := models.NewTicket(testOrgID, "Reported", "Description", leaver.ID)
+	ticket.AssignedToID = &leaver.ID
+	assert.NoError(t, db.Create(ticket).Error)
+	team, err := NewTeamService(db).CreateTeam(testOrgID, "Network", "")
+	assert.NoError(t, err)
+	_, err = NewTeamService(db).AddMember(testOrgID, team.ID, leaver.ID)
+	assert.NoError(t, err)
+	_, err = svc.DeactivateUser(recent.ID)
+	assert.NoError(t, err)
+	_, err = svc.SuspendUser(suspended.ID)
+	assert.NoError(t, err)
+
+	purged, err := svc.PurgeDeactivatedUsers(24 * time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = svc.GetUserByID(leaver.ID)
+	assert.Error(t, err)
+	var sessions int64
+	db.Model(&models.Session{}).Where("user_id = ?", leaver.ID).Count(&sessions)
+	assert.Zero(t, sessions)
+	var superseded int64
+	db.Model(&models.SupersededRefreshToken{}).Count(&superseded)
+	assert.Zero(t, superseded)
+	var kept models.Ticket
+	assert.NoError(t, db.First(&kept, "id = ?", ticket.ID).Error)
+	assert.Nil(t, kept.CreatedByID)
+	assert.Nil(t, kept.AssignedToID)
+	remaining, err := NewTeamService(db).GetTeam(testOrgID, team.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, remaining.Members)
+
+	_, err = svc.GetUserByID(recent.ID)
+	assert.NoError(t, err)
+	_, err = svc.GetUserByID(suspended.ID)
+	assert.NoError(t, err)
+}
+
+func TestUserService_OrganizationScope(t *testing.T) {
+	svc := setupUserService(t)
+	otherOrgID := uuid.New()
+	jane, err := svc.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	_, err = svc.CreateUser(otherOrgID, "john@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	users, err := svc.ListUsers(testOrgID)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	found, err := svc.GetUserInOrganization(testOrgID, jane.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, jane.ID, found.ID)
+	_, err = svc.GetUserInOrganization(otherOrgID, jane.ID)
+	assert.EqualError(t, err, "user not found")
+}
+
+func TestUserService_HasAdmin(t *testing.T) {
+	svc := setupUserService(t)
+	jane, err := svc.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleAgent)
+	assert.NoError(t, err)
+
+	hasAdmin, err := svc.HasAdmin()
+	assert.NoError(t, err)
+	assert.False(t, hasAdmin)
+
+	_, err = svc.SetSuperAdmin(jane.ID, true)
+	assert.NoError(t, err)
+	hasAdmin, err = svc.HasAdmin()
+	assert.NoError(t, err)
+	assert.True(t, hasAdmin, "super admins count whatever their role")
+
+	_, err = svc.SetSuperAdmin(jane.ID, false)
+	assert.NoError(t, err)
+	john, err := svc.CreateUser(testOrgID, "john@example.com", "secret123", models.RoleAdmin)
+	assert.NoError(t, err)
+	hasAdmin, err = svc.HasAdmin()
+	assert.NoError(t, err)
+	assert.True(t, hasAdmin)
+
+	_, err = svc.SuspendUser(john.ID)
+	assert.NoError(t, err)
+	hasAdmin, err = svc.HasAdmin()
+	assert.NoError(t, err)
+	assert.False(t, hasAdmin, "suspended admins do not count")
+}
+
+func TestUserService_CheckPasswordUpgradesHash(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}))
+
+	// Users created while bcrypt was the preferred hasher
+	legacy := NewUserService(db, NewPasswordManager(&DefaultPasswordPolicy, NewBcryptHasher(bcrypt.MinCost)))
+	user, err := legacy.CreateUser(testOrgID, "jane@example.com", "secret123", models.RoleUser)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"))
+
+	svc := NewUserService(db, DefaultPasswordManager)
+	assert.False(t, svc.CheckPassword(user, "wrong"))
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"))
+
+	assert.True(t, svc.CheckPassword(user, "secret123"))
+	stored, err := svc.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"))
+	assert.True(t, svc.CheckPassword(stored, "secret123"))
+}
+
+func TestUserService_CreateUserEnforcesPolicy(t *testing.T) {
+	svc := setupUserService(t)
+
+	_, err := svc.CreateUser(testOrgID, "jane@example.com", "short", models.RoleUser)
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	// Service accounts get a random password that never needs checking
+	_, err = svc.CreateServiceAccount(testOrgID, "ci@example.com", models.RoleAgent)
+	assert.NoError(t, err)
+}
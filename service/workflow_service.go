@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	ErrInvalidWorkflow  = errors.New("invalid workflow")
+	ErrWorkflowInUse    = errors.New("workflow is in use")
+)
+
+// WorkflowService manages the workflows of organizations and which teams
+// follow them. Every method is scoped to one organization; workflows of other
+// organizations are reported as not found.
+//
+// Tickets whose status is not part of their workflow, e.g. after a status was
+// removed or their team switched workflows, may only move to its initial status.
+type WorkflowService struct {
+	db *gorm.DB
+}
+
+func NewWorkflowService(db *gorm.DB) *WorkflowService {
+	return &WorkflowService{db: db}
+}
+
+// CreateWorkflow adds a workflow to the organization. Tickets start in the
+// first status.
+func (s *WorkflowService) CreateWorkflow(orgID uuid.UUID, name, description string, statuses []models.WorkflowStatus, transitions []models.TicketTransition) (*models.Workflow, error) {
+	if err := validateWorkflow(name, statuses, transitions); err != nil {
+		return nil, err
+	}
+
+	workflow := &models.Workflow{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Name:           strings.TrimSpace(name),
+		Description:    description,
+		Statuses:       statuses,
+		Transitions:    transitions,
+	}
+	if err := s.db.Create(workflow).Error; err != nil {
+		return nil, fmt.Errorf("failed to create workflow: %w", err)
+	}
+	return workflow, nil
+}
+
+func (s *WorkflowService) GetWorkflow(orgID, id uuid.UUID) (*models.Workflow, error) {
+	var workflow models.Workflow
+	if err := s.db.First(&workflow, "id = ? AND organization_id = ?", id, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkflowNotFound
+		}
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+	return &workflow, nil
+}
+
+func (s *WorkflowService) ListWorkflows(orgID uuid.UUID) ([]models.Workflow, error) {
+	var workflows []models.Workflow
+	if err := s.db.Where("organization_id = ?", orgID).Order("name").Find(&workflows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list workflows: %w", err)
+	}
+	return workflows, nil
+}
+
+// UpdateWorkflow replaces the definition of the workflow
+func (s *WorkflowService) UpdateWorkflow(orgID, id uuid.UUID, name, description string, statuses []models.WorkflowStatus, transitions []models.TicketTransition) (*models.Workflow, error) {
+	if err := validateWorkflow(name, statuses, transitions); err != nil {
+		return nil, err
+	}
+	workflow, err := s.GetWorkflow(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow.Name = strings.TrimSpace(name)
+	workflow.Description = description
+	workflow.Statuses = statuses
+	workflow.Transitions = transitions
+	if err := s.db.Save(workflow).Error; err != nil {
+		return nil, fmt.Errorf("failed to update workflow: %w", err)
+	}
+	return workflow, nil
+}
+
+// DeleteWorkflow removes a workflow that neither the organization nor any of
+// its teams follow
+func (s *WorkflowService) DeleteWorkflow(orgID, id uuid.UUID) error {
+	workflow, err := s.GetWorkflow(orgID, id)
+	if err != nil {
+		return err
+	}
+	if workflow.IsDefault {
+		return fmt.Errorf("%w: it is the organization's default workflow", ErrWorkflowInUse)
+	}
+
+	var teams int64
+	if err := s.db.Model(&models.Team{}).Where("organization_id = ? AND workflow_id = ?", orgID, id).Count(&teams).Error; err != nil {
+		return fmt.Errorf("failed to count teams: %w", err)
+	}
+	if teams > 0 {
+		return fmt.Errorf("%w: %d teams follow it", ErrWorkflowInUse, teams)
+	}
+
+	if err := s.db.Delete(workflow).Error; err != nil {
+		return fmt.Errorf("failed to delete workflow: %w", err)
+	}
+	return nil
+}
+
+// SetDefaultWorkflow makes the workflow the one followed by tickets without a
+// team or whose team has none; nil goes back to models.DefaultWorkflow
+func (s *WorkflowService) SetDefaultWorkflow(orgID uuid.UUID, id *uuid.UUID) error {
+	if id != nil {
+		if _, err := s.GetWorkflow(orgID, *id); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Workflow{}).Where("organization_id = ? AND is_default = ?", orgID, true).
+			Update("is_default", false).Error; err != nil {
+			return fmt.Errorf("failed to clear default workflow: %w", err)
+		}
+		if id == nil {
+			return nil
+		}
+		if err := tx.Model(&models.Workflow{}).Where("id = ? AND organization_id = ?", *id, orgID).
+			Update("is_default", true).Error; err != nil {
+			return fmt.Errorf("failed to set default workflow: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetTeamWorkflow makes the tickets of the team follow the workflow; nil
+// follows the organization's default workflow
+func (s *WorkflowService) SetTeamWorkflow(orgID, teamID uuid.UUID, workflowID *uuid.UUID) (*models.Team, error) {
+	var team models.Team
+	if err := s.db.First(&team, "id = ? AND organization_id = ?", teamID, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	if workflowID != nil {
+		if _, err := s.GetWorkflow(orgID, *workflowID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Model(&team).Update("workflow_id", workflowID).Error; err != nil {
+		return nil, fmt.Errorf("failed to set team workflow: %w", err)
+	}
+	team.WorkflowID = workflowID
+	return &team, nil
+}
+
+func validateWorkflow(name string, statuses []models.WorkflowStatus, transitions []models.TicketTransition) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWorkflow)
+	}
+	if len(statuses) == 0 {
+		return fmt.Errorf("%w: at least one status is required", ErrInvalidWorkflow)
+	}
+
+	keys := make(map[models.Status]bool, len(statuses))
+	for _, status := range statuses {
+		if !status.Key.IsValid() {
+			return fmt.Errorf("%w: status key %q must be at most %d lower case letters, digits and underscores, starting with a letter",
+				ErrInvalidWorkflow, status.Key, models.MaxStatusLength)
+		}
+		if keys[status.Key] {
+			return fmt.Errorf("%w: duplicate status %s", ErrInvalidWorkflow, status.Key)
+		}
+		keys[status.Key] = true
+		if strings.TrimSpace(status.Name) == "" {
+			return fmt.Errorf("%w: status %s needs a name", ErrInvalidWorkflow, status.Key)
+		}
+		if !status.Category.IsValid() {
+			return fmt.Errorf("%w: status %s has invalid category %q", ErrInvalidWorkflow, status.Key, status.Category)
+		}
+	}
+
+	seen := make(map[[2]models.Status]bool, len(transitions))
+	for _, transition := range transitions {
+		if !keys[transition.From] || !keys[transition.To] {
+			return fmt.Errorf("%w: transition %s -> %s uses an unknown status", ErrInvalidWorkflow, transition.From, transition.To)
+		}
+		if transition.From == transition.To {
+			return fmt.Errorf("%w: transition %s -> %s does not change the status", ErrInvalidWorkflow, transition.From, transition.To)
+		}
+		pair := [2]models.Status{transition.From, transition.To}
+		if seen[pair] {
+			return fmt.Errorf("%w: duplicate transition %s -> %s", ErrInvalidWorkflow, transition.From, transition.To)
+		}
+		seen[pair] = true
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"testing"
+
+	"fix-ticket-system/config"
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWorkflowService shares the database of a ticket service
+func setupWorkflowService(t *testing.T) (*WorkflowService, *TicketService) {
+	tickets := setupService(t)
+	return NewWorkflowService(config.DB), tickets
+}
+
+var supportStatuses = []models.WorkflowStatus{
+	{Key: "triage", Name: "Triage", Category: models.CategoryTodo},
+	{Key: "waiting_on_customer", Name: "Waiting on customer", Category: models.CategoryInProgress},
+	{Key: "in_review", Name: "In review", Category: models.CategoryInProgress},
+	{Key: "done", Name: "Done", Category: models.CategoryDone},
+}
+
+var supportTransitions = []models.TicketTransition{
+	{From: "triage", To: "waiting_on_customer"},
+	{From: "triage", To: "in_review", RequiresAssignee: true},
+	{From: "waiting_on_customer", To: "in_review", RequiresAssignee: true},
+	{From: "in_review", To: "done"},
+	{From: "done", To: "triage", RequiresReason: true},
+}
+
+func TestWorkflowService_CRUD(t *testing.T) {
+	svc, _ := setupWorkflowService(t)
+
+	workflow, err := svc.CreateWorkflow(testOrgID, " Support ", "Customer requests", supportStatuses, supportTransitions)
+	require.NoError(t, err)
+	assert.Equal(t, "Support", workflow.Name)
+
+	found, err := svc.GetWorkflow(testOrgID, workflow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, supportStatuses, found.Statuses)
+	assert.Equal(t, supportTransitions, found.Transitions)
+	assert.Equal(t, models.Status("triage"), found.InitialStatus())
+
+	_, err = svc.GetWorkflow(uuid.New(), workflow.ID)
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+
+	updated, err := svc.UpdateWorkflow(testOrgID, workflow.ID, "Support", "", supportStatuses[:2], supportTransitions[:1])
+	require.NoError(t, err)
+	assert.Len(t, updated.Statuses, 2)
+
+	workflows, err := svc.ListWorkflows(testOrgID)
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+	assert.Len(t, workflows[0].Transitions, 1)
+
+	require.NoError(t, svc.DeleteWorkflow(testOrgID, workflow.ID))
+	assert.ErrorIs(t, svc.DeleteWorkflow(testOrgID, workflow.ID), ErrWorkflowNotFound)
+}
+
+func TestWorkflowService_Validation(t *testing.T) {
+	svc, _ := setupWorkflowService(t)
+	todo := models.WorkflowStatus{Key: "todo", Name: "To do", Category: models.CategoryTodo}
+	done := models.WorkflowStatus{Key: "done", Name: "Done", Category: models.CategoryDone}
+
+	tests := []struct {
+		name        string
+		workflow    string
+		statuses    []models.WorkflowStatus
+		transitions []models.TicketTransition
+	}{
+		{"no name", " ", []models.WorkflowStatus{todo}, nil},
+		{"no statuses", "Flow", nil, nil},
+		{"malformed key", "Flow", []models.WorkflowStatus{{Key: "To Do", Name: "To do", Category: models.CategoryTodo}}, nil},
+		{"duplicate status", "Flow", []models.WorkflowStatus{todo, todo}, nil},
+		{"unnamed status", "Flow", []models.WorkflowStatus{{Key: "todo", Category: models.CategoryTodo}}, nil},
+		{"unknown category", "Flow", []models.WorkflowStatus{{Key: "todo", Name: "To do", Category: "later"}}, nil},
+		{"unknown status", "Flow", []models.WorkflowStatus{todo, done}, []models.TicketTransition{{From: "todo", To: "doing"}}},
+		{"no change", "Flow", []models.WorkflowStatus{todo, done}, []models.TicketTransition{{From: "todo", To: "todo"}}},
+		{"duplicate transition", "Flow", []models.WorkflowStatus{todo, done}, []models.TicketTransition{{From: "todo", To: "done"}, {From: "todo", To: "done"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateWorkflow(testOrgID, tt.workflow, "", tt.statuses, tt.transitions)
+			assert.ErrorIs(t, err, ErrInvalidWorkflow)
+		})
+	}
+}
+
+func TestWorkflowService_DefaultAndTeams(t *testing.T) {
+	svc, tickets := setupWorkflowService(t)
+	workflow, err := svc.CreateWorkflow(testOrgID, "Support", "", supportStatuses, supportTransitions)
+	require.NoError(t, err)
+	team := &models.Team{ID: uuid.New(), OrganizationID: testOrgID, Name: "Network"}
+	require.NoError(t, config.DB.Create(team).Error)
+
+	// Without a workflow of their own, organizations follow the default one
+	current, err := tickets.GetWorkflow(testOrgID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultWorkflow.Name, current.Name)
+
+	require.NoError(t, svc.SetDefaultWorkflow(testOrgID, &workflow.ID))
+	current, err = tickets.GetWorkflow(testOrgID, &team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, workflow.ID, current.ID)
+	assert.ErrorIs(t, svc.DeleteWorkflow(testOrgID, workflow.ID), ErrWorkflowInUse)
+
+	// Teams can follow another workflow than the organization
+	require.NoError(t, svc.SetDefaultWorkflow(testOrgID, nil))
+	updated, err := svc.SetTeamWorkflow(testOrgID, team.ID, &workflow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &workflow.ID, updated.WorkflowID)
+	current, err = tickets.GetWorkflow(testOrgID, &team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, workflow.ID, current.ID)
+	current, err = tickets.GetWorkflow(testOrgID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultWorkflow.Name, current.Name)
+	assert.ErrorIs(t, svc.DeleteWorkflow(testOrgID, workflow.ID), ErrWorkflowInUse)
+
+	_, err = svc.SetTeamWorkflow(testOrgID, team.ID, idOf(uuid.New()))
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+	_, err = svc.SetTeamWorkflow(testOrgID, uuid.New(), &workflow.ID)
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+	assert.ErrorIs(t, svc.SetDefaultWorkflow(uuid.New(), &workflow.ID), ErrWorkflowNotFound)
+
+	// Teams of other organizations do not lend them their workflow
+	current, err = tickets.GetWorkflow(uuid.New(), &team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultWorkflow.Name, current.Name)
+}
+
+func TestTicketService_CustomWorkflow(t *testing.T) {
+	svc, tickets := setupWorkflowService(t)
+	assignee := createTicketUser(t, "assignee@example.com")
+	workflow, err := svc.CreateWorkflow(testOrgID, "Support", "", supportStatuses, supportTransitions)
+	require.NoError(t, err)
+	team := &models.Team{ID: uuid.New(), OrganizationID: testOrgID, Name: "Support"}
+	require.NoError(t, config.DB.Create(team).Error)
+	_, err = svc.SetTeamWorkflow(testOrgID, team.ID, &workflow.ID)
+	require.NoError(t, err)
+
+	// Moving to the team switches workflows; the ticket enters the new one at
+	// its initial status
+	ticket, err := tickets.CreateTicket(testOrgID, "Refund", "Order 42", uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusOpen, ticket.Status)
+	_, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam},
+		TeamID: &team.ID,
+	})
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	_, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam, models.TicketFieldStatus},
+		TeamID: &team.ID,
+		Status: models.StatusInProgress,
+	})
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	_, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam, models.TicketFieldStatus},
+		TeamID: &team.ID,
+		Status: "in_review",
+	})
+	assert.ErrorIs(t, err, ErrTransitionNotAllowed)
+	ticket, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam, models.TicketFieldStatus},
+		TeamID: &team.ID,
+		Status: "triage",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.Status("triage"), ticket.Status)
+	ticket, err = tickets.TransitionTicket(testOrgID, ticket.ID, "waiting_on_customer", "")
+	require.NoError(t, err)
+
+	// Team changes keep the status only if the new workflow has it
+	other := &models.Team{ID: uuid.New(), OrganizationID: testOrgID, Name: "Billing"}
+	require.NoError(t, config.DB.Create(other).Error)
+	_, err = svc.SetTeamWorkflow(testOrgID, other.ID, &workflow.ID)
+	require.NoError(t, err)
+	ticket, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam},
+		TeamID: &other.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.Status("waiting_on_customer"), ticket.Status)
+	_, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam},
+		TeamID: nil,
+	})
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	ticket, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields: []models.TicketField{models.TicketFieldTeam},
+		TeamID: &team.ID,
+	})
+	require.NoError(t, err)
+
+	// From then on the workflow's transitions and guards apply
+	_, err = tickets.TransitionTicket(testOrgID, ticket.ID, "done", "")
+	assert.ErrorIs(t, err, ErrTransitionNotAllowed)
+	_, err = tickets.TransitionTicket(testOrgID, ticket.ID, "in_review", "")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	ticket, err = tickets.PatchTicket(testOrgID, ticket.ID, TicketPatch{
+		Fields:     []models.TicketField{models.TicketFieldAssignedTo, models.TicketFieldStatus},
+		AssignedTo: &assignee.ID,
+		Status:     "in_review",
+	})
+	require.NoError(t, err)
+	ticket, err = tickets.TransitionTicket(testOrgID, ticket.ID, "done", "")
+	require.NoError(t, err)
+	_, err = tickets.TransitionTicket(testOrgID, ticket.ID, "triage", "")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+	_, err = tickets.TransitionTicket(testOrgID, ticket.ID, models.StatusOpen, "Wrong queue")
+	assert.ErrorIs(t, err, ErrTransitionRejected)
+
+	// New tickets start in the default workflow's first status
+	require.NoError(t, svc.SetDefaultWorkflow(testOrgID, &workflow.ID))
+	created, err := tickets.CreateTicket(testOrgID, "Invoice", "Missing", uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, models.Status("triage"), created.Status)
+}
+
+func idOf(id uuid.UUID) *uuid.UUID {
+	return &id
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"fix-ticket-system/models"
+	"fix-ticket-system/service"
+
+	"github.com/google/uuid"
+)
+
+// Media types accepted by PATCH /api/v1/tickets/:id
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	// errMalformedPatch is a patch document that cannot be read
+	errMalformedPatch = errors.New("malformed patch")
+	// errUnprocessablePatch is a well-formed patch that cannot be applied to the ticket
+	errUnprocessablePatch = errors.New("patch cannot be applied")
+	// errPatchTestFailed is a JSON Patch whose test operation did not hold
+	errPatchTestFailed = errors.New("patch test failed")
+)
+
+// ticketDocument is the JSON document patches apply to: the editable fields of
+// a ticket, with the assignee and team as IDs or null
+type ticketDocument map[models.TicketField]interface{}
+
+func newTicketDocument(ticket *models.Ticket) ticketDocument {
+	doc := ticketDocument{
+		models.TicketFieldTitle:       ticket.Title,
+		models.TicketFieldDescription: ticket.Description,
+		models.TicketFieldStatus:      string(ticket.Status),
+		models.TicketFieldPriority:    string(ticket.Priority),
+		models.TicketFieldAssignedTo:  nil,
+		models.TicketFieldTeam:        nil,
+	}
+	if ticket.AssignedToID != nil {
+		doc[models.TicketFieldAssignedTo] = ticket.AssignedToID.String()
+	}
+	if ticket.TeamID != nil {
+		doc[models.TicketFieldTeam] = ticket.TeamID.String()
+	}
+	return doc
+}
+
+// applyMergePatch applies an RFC 7396 JSON Merge Patch. Members set to null
+// unassign the assignee or team.
+func applyMergePatch(doc ticketDocument, body []byte) (service.TicketPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return service.TicketPatch{}, fmt.Errorf("%w: a merge patch must be a JSON object", errMalformedPatch)
+	}
+
+	var changed []models.TicketField
+	for name, raw := range members {
+		field := models.TicketField(name)
+		if !field.IsEditable() {
+			return service.TicketPatch{}, fmt.Errorf("%w: %s cannot be changed", errUnprocessablePatch, name)
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return service.TicketPatch{}, fmt.Errorf("%w: %v", errMalformedPatch, err)
+		}
+		doc[field] = value
+		changed = append(changed, field)
+	}
+	return doc.toPatch(changed)
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch. The operations are applied in
+// order and either all of them or none take effect. Removing the assignee or
+// team unassigns it; the other fields cannot be removed.
+func applyJSONPatch(doc ticketDocument, body []byte) (service.TicketPatch, error) {
+	var operations []jsonPatchOperation
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&operations); err != nil {
+		return service.TicketPatch{}, fmt.Errorf("%w: a JSON patch must be an array of operations", errMalformedPatch)
+	}
+
+	changed := make(map[models.TicketField]bool)
+	for i, operation := range operations {
+		path, err := patchPointer(operation.Path)
+		if err != nil {
+			return service.TicketPatch{}, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch operation.Op {
+		case "add", "replace":
+			var value interface{}
+			if len(operation.Value) == 0 || json.Unmarshal(operation.Value, &value) != nil {
+				return service.TicketPatch{}, fmt.Errorf("%w: operation %d needs a value", errMalformedPatch, i)
+			}
+			doc[path] = value
+			changed[path] = true
+		case "remove":
+			doc[path] = nil
+			changed[path] = true
+		case "copy", "move":
+			from, err := patchPointer(operation.From)
+			if err != nil {
+				return service.TicketPatch{}, fmt.Errorf("operation %d: %w", i, err)
+			}
+			doc[path] = doc[from]
+			changed[path] = true
+			if operation.Op == "move" && from != path {
+				doc[from] = nil
+				changed[from] = true
+			}
+		case "test":
+			var value interface{}
+			if len(operation.Value) == 0 || json.Unmarshal(operation.Value, &value) != nil {
+				return service.TicketPatch{}, fmt.Errorf("%w: operation %d needs a value", errMalformedPatch, i)
+			}
+			if !reflect.DeepEqual(doc[path], value) {
+				return service.TicketPatch{}, fmt.Errorf("%w: %s is not %s", errPatchTestFailed, path, operation.Value)
+			}
+		default:
+			return service.TicketPatch{}, fmt.Errorf("%w: unknown operation %q", errMalformedPatch, operation.Op)
+		}
+	}
+
+	fields := make([]models.TicketField, 0, len(changed))
+	for _, field := range models.EditableTicketFields {
+		if changed[field] {
+			fields = append(fields, field)
+		}
+	}
+	return doc.toPatch(fields)
+}
+
+// patchPointer resolves a JSON Pointer (RFC 6901) to the field it names
+func patchPointer(pointer string) (models.TicketField, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("%w: invalid path %q", errMalformedPatch, pointer)
+	}
+	name := strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:])
+	field := models.TicketField(name)
+	if !field.IsEditable() {
+		return "", fmt.Errorf("%w: %s cannot be changed", errUnprocessablePatch, pointer)
+	}
+	return field, nil
+}
+
+// toPatch reads the changed fields of the patched document
+func (doc ticketDocument) toPatch(fields []models.TicketField) (service.TicketPatch, error) {
+	patch := service.TicketPatch{Fields: fields}
+	for _, field := range fields {
+		value := doc[field]
+		switch field {
+		case models.TicketFieldAssignedTo, models.TicketFieldTeam:
+			id, err := patchID(field, value)
+			if err != nil {
+				return service.TicketPatch{}, err
+			}
+			if field == models.TicketFieldAssignedTo {
+				patch.AssignedTo = id
+			} else {
+				patch.TeamID = id
+			}
+			continue
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			return service.TicketPatch{}, fmt.Errorf("%w: %s must be a string", errUnprocessablePatch, field)
+		}
+		switch field {
+		case models.TicketFieldTitle:
+			patch.Title = text
+		case models.TicketFieldDescription:
+			patch.Description = text
+		case models.TicketFieldStatus:
+			patch.Status = models.Status(text)
+		case models.TicketFieldPriority:
+			patch.Priority = models.Priority(text)
+		}
+	}
+	return patch, nil
+}
+
+func patchID(field models.TicketField, value interface{}) (*uuid.UUID, error) {
+	if value == nil {
+		return nil, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be an ID or null", errUnprocessablePatch, field)
+	}
+	id, err := uuid.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an ID or null", errUnprocessablePatch, field)
+	}
+	return &id, nil
+}
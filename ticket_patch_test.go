@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"fix-ticket-system/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchTestTicket() *models.Ticket {
+	assignee := uuid.New()
+	return &models.Ticket{
+		Title: "Printer jam", Description: "Tray 2", Status: models.StatusOpen,
+		Priority: models.PriorityLow, AssignedToID: &assignee,
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	team := uuid.New()
+	patch, err := applyMergePatch(newTicketDocument(patchTestTicket()),
+		[]byte(`{"title": "Printer on fire", "assigned_to_id": null, "team_id": "`+team.String()+`"}`))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.TicketField{models.TicketFieldTitle, models.TicketFieldAssignedTo, models.TicketFieldTeam}, patch.Fields)
+	assert.Equal(t, "Printer on fire", patch.Title)
+	assert.Nil(t, patch.AssignedTo)
+	assert.Equal(t, &team, patch.TeamID)
+
+	_, err = applyMergePatch(newTicketDocument(patchTestTicket()), []byte(`{"team_id": "not-an-id"}`))
+	assert.ErrorIs(t, err, errUnprocessablePatch)
+	_, err = applyMergePatch(newTicketDocument(patchTestTicket()), []byte(`"title"`))
+	assert.ErrorIs(t, err, errMalformedPatch)
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	ticket := patchTestTicket()
+	patch, err := applyJSONPatch(newTicketDocument(ticket), []byte(`[
+		{"op": "test", "path": "/status", "value": "open"},
+		{"op": "copy", "from": "/title", "path": "/description"},
+		{"op": "replace", "path": "/title", "value": "Printer on fire"},
+		{"op": "move", "from": "/assigned_to_id", "path": "/team_id"},
+		{"op": "remove", "path": "/team_id"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []models.TicketField{
+		models.TicketFieldTitle, models.TicketFieldDescription, models.TicketFieldAssignedTo, models.TicketFieldTeam,
+	}, patch.Fields)
+	assert.Equal(t, "Printer on fire", patch.Title)
+	assert.Equal(t, "Printer jam", patch.Description)
+	assert.Nil(t, patch.AssignedTo)
+	assert.Nil(t, patch.TeamID)
+}
+
+func TestApplyJSONPatch_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"not an array", `{"op": "remove", "path": "/title"}`, errMalformedPatch},
+		{"unknown member", `[{"op": "remove", "path": "/team_id", "extra": 1}]`, errMalformedPatch},
+		{"missing value", `[{"op": "replace", "path": "/title"}]`, errMalformedPatch},
+		{"relative path", `[{"op": "remove", "path": "team_id"}]`, errMalformedPatch},
+		{"read-only path", `[{"op": "replace", "path": "/id", "value": "x"}]`, errUnprocessablePatch},
+		{"escaped path", `[{"op": "remove", "path": "/team~1id"}]`, errUnprocessablePatch},
+		{"removing a required field", `[{"op": "remove", "path": "/title"}]`, errUnprocessablePatch},
+		{"failed test", `[{"op": "test", "path": "/priority", "value": "high"}]`, errPatchTestFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyJSONPatch(newTicketDocument(patchTestTicket()), []byte(tt.body))
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}